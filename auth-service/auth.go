@@ -1,11 +1,18 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -20,94 +27,600 @@ type LoginCredentials struct {
 	Password string `json:"password"`
 }
 
-type User struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ForgotPassword struct {
+	Email string `json:"email"`
+}
+
+type ResetPassword struct {
+	Token    string `json:"token"`
 	Password string `json:"password"`
 }
 
+type User struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Email         string   `json:"email"`
+	Password      string   `json:"password"`
+	EmailVerified bool     `json:"email_verified"`
+	Roles         []string `json:"roles"`
+	Permissions   []string `json:"permissions"`
+}
+
 type IAuthService interface {
-	Register(RegisterCredentials, http.ResponseWriter) (*Tokens, error)
-	Login(LoginCredentials, http.ResponseWriter) (*Tokens, error)
-	Refresh(Tokens, http.ResponseWriter) (*Tokens, error)
+	Register(RegisterCredentials, ClientInfo, http.ResponseWriter) (*Tokens, error)
+	Login(LoginCredentials, ClientInfo, http.ResponseWriter) (*Tokens, *MFAChallenge, error)
+	CheckCredentials(LoginCredentials, ClientInfo) (*User, *MFAChallenge, error)
+	CompleteMFALogin(MFALogin, ClientInfo, http.ResponseWriter) (*Tokens, error)
+	CheckSecondFactor(MFALogin, ClientInfo) (*User, error)
+	Refresh(Tokens, ClientInfo, http.ResponseWriter) (*Tokens, error)
+	StartClientSession(*User, string, string, ClientInfo) (*Tokens, error)
+	RefreshClientSession(string, string, ClientInfo) (*Tokens, *Session, error)
 	Logout(Tokens, http.ResponseWriter) error
+	Authenticate(string) (*Claims, error)
+	GetSessions(*Claims) ([]Session, error)
+	RevokeSession(*Claims, string) error
+	LogoutAll(*Claims, http.ResponseWriter) error
+	ChangePassword(*Claims, ChangePassword, http.ResponseWriter) error
+	RevokeToken(string) error
+	InspectToken(string) (*TokenInfo, error)
+	RevokeInspectedToken(*TokenInfo) error
+	RevokeUserSessions(string) error
+	ForgotPassword(ForgotPassword) error
+	ResetPassword(ResetPassword) error
+	VerifyEmail(string) error
+	ResendVerification(*Claims) error
+	EnrollTOTP(*Claims) (*TOTPEnrollment, error)
+	ConfirmTOTP(*Claims, MFACode) (*RecoveryCodes, error)
+	RegenerateRecoveryCodes(*Claims, MFACode) (*RecoveryCodes, error)
+	UnlockLogin(string, string) error
+}
+
+const (
+	accessTokenTTL  = time.Minute * 15
+	refreshTokenTTL = time.Hour * 24 * 7
+)
+
+var (
+	ErrSessionNotFound          = errors.New("session not found")
+	ErrInvalidPassword          = errors.New("invalid password")
+	ErrInvalidResetToken        = errors.New("invalid or expired reset token")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified     = errors.New("email already verified")
+)
+
+// RetryAfterError is returned when a caller has to wait before trying again.
+type RetryAfterError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("too many requests, retry after %s", e.RetryAfter.Round(time.Second))
 }
 
 type AuthService struct {
-	redisRepository IRedisRepository
-	jwtService      IJWTService
+	redisRepository    IRedisRepository
+	sessionRepository  ISessionRepository
+	passwordResets     IOneTimeTokenRepository
+	emailVerifications IOneTimeTokenRepository
+	mfaChallenges      IOneTimeTokenRepository
+	mfaRepository      IMFARepository
+	loginGuard         *LoginGuard
+	jwtService         IJWTService
+	securityEvents     ISecurityEventPublisher
+	notifier           INotifier
+	userService        IUserServiceClient
+	passwordReset      PasswordResetConfig
+	emailVerification  EmailVerificationConfig
+	mfa                MFAConfig
 }
 
-func NewAuthService(redisRepository IRedisRepository, jwtService IJWTService) *AuthService {
+func NewAuthService(redisRepository IRedisRepository, sessionRepository ISessionRepository,
+	passwordResets IOneTimeTokenRepository, emailVerifications IOneTimeTokenRepository,
+	mfaChallenges IOneTimeTokenRepository, mfaRepository IMFARepository, loginGuard *LoginGuard, jwtService IJWTService,
+	securityEvents ISecurityEventPublisher, notifier INotifier, userService IUserServiceClient,
+	passwordReset PasswordResetConfig, emailVerification EmailVerificationConfig, mfa MFAConfig) *AuthService {
 	return &AuthService{
-		redisRepository: redisRepository,
-		jwtService:      jwtService,
+		redisRepository:    redisRepository,
+		sessionRepository:  sessionRepository,
+		passwordResets:     passwordResets,
+		emailVerifications: emailVerifications,
+		mfaChallenges:      mfaChallenges,
+		mfaRepository:      mfaRepository,
+		loginGuard:         loginGuard,
+		jwtService:         jwtService,
+		securityEvents:     securityEvents,
+		notifier:           notifier,
+		userService:        userService,
+		passwordReset:      passwordReset,
+		emailVerification:  emailVerification,
+		mfa:                mfa,
 	}
 }
 
-func (s *AuthService) Register(creds RegisterCredentials, w http.ResponseWriter) (*Tokens, error) {
+// Register creates the user and logs them in right away. The account stays
+// unverified, which the email_verified claim tells the gateway and services,
+// until the link sent to the address is opened.
+func (s *AuthService) Register(creds RegisterCredentials, client ClientInfo, w http.ResponseWriter) (*Tokens, error) {
 	if err := s.createUser(creds); err != nil {
 		return nil, err
 	}
 
-	return s.createAndSetTokens(creds.Email, w)
+	user, err := s.getUserByEmail(creds.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sendVerificationEmail(user); err != nil {
+		log.Printf("Could not send verification email to %s: %v", user.Email, err)
+	}
+
+	return s.startSession(user, client, w)
 }
 
-func (s *AuthService) Login(creds LoginCredentials, w http.ResponseWriter) (*Tokens, error) {
+// Login checks the password. Users with two factor authentication get an
+// MFAChallenge instead of tokens, to be completed with CompleteMFALogin.
+func (s *AuthService) Login(creds LoginCredentials, client ClientInfo, w http.ResponseWriter) (*Tokens, *MFAChallenge, error) {
+	user, challenge, err := s.CheckCredentials(creds, client)
+	if err != nil || challenge != nil {
+		return nil, challenge, err
+	}
+
+	tokens, err := s.startSession(user, client, w)
+	return tokens, nil, err
+}
+
+// CheckCredentials checks the password without starting a session. Repeated
+// failures for the email or client IP are throttled, and users with two factor
+// authentication get an MFAChallenge instead of being authenticated.
+func (s *AuthService) CheckCredentials(creds LoginCredentials, client ClientInfo) (*User, *MFAChallenge, error) {
+	if err := s.loginGuard.Check(creds.Email, client.IP); err != nil {
+		return nil, nil, err
+	}
+
 	user, err := s.getUserByEmail(creds.Email)
 	if err != nil {
-		return nil, fmt.Errorf("user not found")
+		s.loginGuard.Fail(creds.Email, client.IP, "unknown email")
+		return nil, nil, fmt.Errorf("user not found")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password)); err != nil {
-		return nil, fmt.Errorf("invalid password")
+		s.loginGuard.Fail(creds.Email, client.IP, "invalid password")
+		return nil, nil, fmt.Errorf("invalid password")
 	}
 
-	return s.createAndSetTokens(creds.Email, w)
+	// The failures are only cleared once every factor passed, otherwise the
+	// password alone would reset the limit on guessing the second factor.
+	mfa, err := s.getMFA(user.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error checking two-factor authentication")
+	}
+	if mfa != nil && mfa.TOTPEnabled {
+		challenge, err := s.createMFAChallenge(user)
+		return nil, challenge, err
+	}
+	s.loginGuard.Succeed(creds.Email)
+
+	return user, nil, nil
 }
 
-func (s *AuthService) Refresh(tokenReq Tokens, w http.ResponseWriter) (*Tokens, error) {
-	email, err := s.redisRepository.GetToken(tokenReq.RefreshToken)
+// Refresh rotates the refresh token within its family. Presenting a token
+// that was already rotated means it has been copied, so the whole family is
+// revoked and every session derived from the original login ends.
+func (s *AuthService) Refresh(tokenReq Tokens, client ClientInfo, w http.ResponseWriter) (*Tokens, error) {
+	user, session, err := s.rotateRefreshToken(tokenReq.RefreshToken, "", client)
 	if err != nil {
-		return nil, fmt.Errorf("invalid refresh token")
+		return nil, err
 	}
-	s.redisRepository.DeleteToken(tokenReq.RefreshToken)
-	return s.createAndSetTokens(email, w)
+
+	return s.createAndSetTokens(user, session, w)
+}
+
+// StartClientSession starts a session granted to an OpenID Connect client.
+// Its tokens are returned to the client rather than set as a cookie.
+func (s *AuthService) StartClientSession(user *User, clientId string, scope string, client ClientInfo) (*Tokens, error) {
+	session := s.newSession(user, client)
+	session.ClientID = clientId
+	session.Scope = scope
+
+	return s.issueTokens(user, &session)
+}
+
+// RefreshClientSession rotates a refresh token the way Refresh does, for a
+// session that was granted to the given client.
+func (s *AuthService) RefreshClientSession(refreshToken string, clientId string, client ClientInfo) (*Tokens, *Session, error) {
+	user, session, err := s.rotateRefreshToken(refreshToken, clientId, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.issueTokens(user, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, session, nil
+}
+
+// rotateRefreshToken consumes a refresh token of a session belonging to the
+// given client, where an empty client id stands for auth-service's own
+// login.
+func (s *AuthService) rotateRefreshToken(token string, clientId string, client ClientInfo) (*User, *Session, error) {
+	refreshToken, err := s.redisRepository.ConsumeToken(token, refreshTokenTTL)
+	if err != nil {
+		s.detectReuse(token)
+		return nil, nil, fmt.Errorf("invalid refresh token")
+	}
+
+	session, err := s.sessionRepository.FindById(refreshToken.FamilyID)
+	if err != nil {
+		s.redisRepository.RevokeFamily(refreshToken.FamilyID)
+		return nil, nil, fmt.Errorf("invalid refresh token")
+	}
+	if session.ClientID != clientId {
+		return nil, nil, fmt.Errorf("invalid refresh token")
+	}
+
+	user, err := s.getUserByEmail(refreshToken.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	session.IP = client.IP
+	session.LastUsedAt = now
+	session.ExpiresAt = now.Add(refreshTokenTTL)
+
+	return user, session, nil
+}
+
+func (s *AuthService) detectReuse(token string) {
+	familyId, err := s.redisRepository.GetUsedToken(token)
+	if err != nil {
+		return
+	}
+
+	if err := s.redisRepository.RevokeFamily(familyId); err != nil {
+		log.Printf("Could not revoke refresh token family %s: %v", familyId, err)
+	}
+
+	event := SecurityEvent{
+		Type:     RefreshTokenReuseEvent,
+		FamilyID: familyId,
+		Detail:   "rotated refresh token presented again, token family revoked",
+	}
+	if session, err := s.sessionRepository.FindById(familyId); err == nil {
+		event.Email = session.Email
+		s.endSession(*session)
+	}
+	s.securityEvents.Publish(event)
 }
 
+// Logout ends the session the refresh token belongs to and revokes the
+// access token the request was made with.
 func (s *AuthService) Logout(tokenReq Tokens, w http.ResponseWriter) error {
+	if claims, err := s.jwtService.VerifyToken(tokenReq.AccessToken); err == nil {
+		if err := s.jwtService.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+			return fmt.Errorf("error revoking access token")
+		}
+	}
+	if refreshToken, err := s.redisRepository.GetToken(tokenReq.RefreshToken); err == nil {
+		if session, err := s.sessionRepository.FindById(refreshToken.FamilyID); err == nil {
+			s.endSession(*session)
+		}
+	}
 	s.redisRepository.DeleteToken(tokenReq.RefreshToken)
 	s.deleteRefreshTokenCookie(w)
 	return nil
 }
 
+// Authenticate verifies an access token and checks that the session it was
+// issued for still exists, so that tokens of revoked sessions stop working
+// before they expire.
+func (s *AuthService) Authenticate(accessToken string) (*Claims, error) {
+	claims, err := s.jwtService.VerifyToken(accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access token")
+	}
+	if claims.ClientID != "" {
+		return nil, fmt.Errorf("service tokens do not authenticate users")
+	}
+	if claims.SessionID != "" {
+		if _, err := s.sessionRepository.FindById(claims.SessionID); err != nil {
+			return nil, fmt.Errorf("session has been revoked")
+		}
+	}
+	return claims, nil
+}
+
+func (s *AuthService) GetSessions(claims *Claims) ([]Session, error) {
+	sessions, err := s.sessionRepository.FindAllByEmail(claims.Email)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching sessions")
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+		sessions[i].AccessToken = nil
+	}
+	return sessions, nil
+}
+
+func (s *AuthService) RevokeSession(claims *Claims, sessionId string) error {
+	session, err := s.sessionRepository.FindById(sessionId)
+	if err != nil || session.Email != claims.Email {
+		return ErrSessionNotFound
+	}
+	return s.endSession(*session)
+}
+
+// LogoutAll ends every session of the user, which also invalidates all of the
+// user's outstanding access tokens.
+func (s *AuthService) LogoutAll(claims *Claims, w http.ResponseWriter) error {
+	if err := s.endAllSessions(claims.Email); err != nil {
+		return err
+	}
+	s.deleteRefreshTokenCookie(w)
+	return nil
+}
+
+// ChangePassword checks the current password, stores the new one and logs
+// the user out everywhere, including the session that made the change.
+func (s *AuthService) ChangePassword(claims *Claims, change ChangePassword, w http.ResponseWriter) error {
+	user, err := s.getUserByEmail(claims.Email)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(change.CurrentPassword)); err != nil {
+		return ErrInvalidPassword
+	}
+
+	if err := s.updatePassword(user.ID, change.NewPassword); err != nil {
+		return err
+	}
+
+	if err := s.jwtService.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return fmt.Errorf("error revoking access token")
+	}
+	return s.LogoutAll(claims, w)
+}
+
+// RevokeToken puts an access token id on the revocation list. The caller does
+// not know when the token expires, so it is kept for the longest lifetime an
+// access token can have.
+func (s *AuthService) RevokeToken(jti string) error {
+	if err := s.jwtService.Revoke(jti, time.Now().Add(accessTokenTTL)); err != nil {
+		return fmt.Errorf("error revoking access token")
+	}
+	return nil
+}
+
+func (s *AuthService) RevokeUserSessions(email string) error {
+	return s.endAllSessions(email)
+}
+
+// ForgotPassword sends a single-use reset link when the email belongs to a
+// user. Unknown addresses are not reported, so callers cannot probe for
+// accounts.
+func (s *AuthService) ForgotPassword(req ForgotPassword) error {
+	user, err := s.getUserByEmail(req.Email)
+	if err != nil {
+		return nil
+	}
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("error creating reset token")
+	}
+
+	reset := OneTimeToken{UserID: user.ID, Email: user.Email}
+	if err := s.passwordResets.Save(tokenHash, reset, s.passwordReset.TokenTTL); err != nil {
+		return fmt.Errorf("error saving reset token")
+	}
+
+	return s.notifier.Notify(Notification{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use the link below to choose a new password. It expires in %s.\n\n%s?token=%s",
+			s.passwordReset.TokenTTL, s.passwordReset.ResetURL, url.QueryEscape(token)),
+	})
+}
+
+// ResetPassword sets a new password with a reset token and ends every
+// session of the user.
+func (s *AuthService) ResetPassword(req ResetPassword) error {
+	reset, err := s.passwordResets.Consume(hashOpaqueToken(req.Token))
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.updatePassword(reset.UserID, req.Password); err != nil {
+		return err
+	}
+	if err := s.endAllSessions(reset.Email); err != nil {
+		return err
+	}
+
+	s.securityEvents.Publish(SecurityEvent{
+		Type:   PasswordResetEvent,
+		Email:  reset.Email,
+		Detail: "password reset with emailed token, all sessions revoked",
+	})
+	return nil
+}
+
+// VerifyEmail marks the address verified. A link sent before the user
+// changed their email does not verify the new address. Tokens issued before
+// carry email_verified false until they are refreshed.
+func (s *AuthService) VerifyEmail(token string) error {
+	verification, err := s.emailVerifications.Consume(hashOpaqueToken(token))
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := s.getUserById(verification.UserID)
+	if err != nil || !strings.EqualFold(user.Email, verification.Email) {
+		return ErrInvalidVerificationToken
+	}
+	return s.markEmailVerified(user.ID)
+}
+
+func (s *AuthService) ResendVerification(claims *Claims) error {
+	user, err := s.getUserByEmail(claims.Email)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	wait, err := s.emailVerifications.Throttle(user.Email, s.emailVerification.ResendInterval)
+	if err != nil {
+		return fmt.Errorf("error checking resend throttle")
+	}
+	if wait > 0 {
+		return &RetryAfterError{RetryAfter: wait}
+	}
+
+	return s.sendVerificationEmail(user)
+}
+
+func (s *AuthService) sendVerificationEmail(user *User) error {
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("error creating verification token")
+	}
+
+	verification := OneTimeToken{UserID: user.ID, Email: user.Email}
+	if err := s.emailVerifications.Save(tokenHash, verification, s.emailVerification.TokenTTL); err != nil {
+		return fmt.Errorf("error saving verification token")
+	}
+
+	return s.notifier.Notify(Notification{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Open the link below to verify your email address. It expires in %s.\n\n%s?token=%s",
+			s.emailVerification.TokenTTL, s.emailVerification.VerifyURL, url.QueryEscape(token)),
+	})
+}
+
+func (s *AuthService) UnlockLogin(email string, ip string) error {
+	return s.loginGuard.Unlock(email, ip)
+}
+
+func (s *AuthService) startSession(user *User, client ClientInfo, w http.ResponseWriter) (*Tokens, error) {
+	session := s.newSession(user, client)
+	return s.createAndSetTokens(user, &session, w)
+}
+
+func (s *AuthService) newSession(user *User, client ClientInfo) Session {
+	now := time.Now().UTC()
+	return Session{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		Email:      user.Email,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(refreshTokenTTL),
+	}
+}
+
+func (s *AuthService) endSession(session Session) error {
+	if err := s.redisRepository.RevokeFamily(session.ID); err != nil {
+		return fmt.Errorf("error revoking session tokens")
+	}
+	if session.AccessToken != nil {
+		if err := s.jwtService.Revoke(session.AccessToken.ID, session.AccessToken.ExpiresAt); err != nil {
+			return fmt.Errorf("error revoking access token")
+		}
+	}
+	if err := s.sessionRepository.Delete(session); err != nil {
+		return fmt.Errorf("error deleting session")
+	}
+	return nil
+}
+
+func (s *AuthService) endAllSessions(email string) error {
+	sessions, err := s.sessionRepository.FindAllByEmail(email)
+	if err != nil {
+		return fmt.Errorf("error fetching sessions")
+	}
+	for _, session := range sessions {
+		if err := s.endSession(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *AuthService) createUser(creds RegisterCredentials) error {
-	userServiceURL := "http://localhost:8080/users"
-	jsonData, _ := json.Marshal(creds)
-	resp, err := http.Post(userServiceURL, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil || resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to register user:" + err.Error())
+	if _, err := s.userService.Do(http.MethodPost, "/users", creds, nil); err != nil {
+		return fmt.Errorf("failed to register user: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthService) updatePassword(userId string, password string) error {
+	_, err := s.userService.Do(http.MethodPut, "/users/"+userId+"/password", map[string]string{"password": password}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthService) markEmailVerified(userId string) error {
+	if _, err := s.userService.Do(http.MethodPut, "/users/"+userId+"/email-verified", nil, nil); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
 	}
 	return nil
 }
 
-func (s *AuthService) createAndSetTokens(email string, w http.ResponseWriter) (*Tokens, error) {
-	accessToken, err := s.jwtService.CreateToken(email, time.Minute*15)
+func (s *AuthService) createAndSetTokens(user *User, session *Session, w http.ResponseWriter) (*Tokens, error) {
+	tokens, err := s.issueTokens(user, session)
+	if err != nil {
+		return nil, err
+	}
+
+	s.setRefreshTokenCookie(w, tokens.RefreshToken, refreshTokenTTL)
+	return tokens, nil
+}
+
+// issueTokens issues a token pair for the session and saves it. The refresh
+// token is opaque, so it cannot be used as an access token; everything about
+// it is in the stored entry. The access token it replaces is revoked, so a
+// session never has more than one live access token and ending it leaves
+// none behind.
+func (s *AuthService) issueTokens(user *User, session *Session) (*Tokens, error) {
+	accessToken, accessClaims, err := s.jwtService.CreateToken(user, session, accessTokenTTL)
 	if err != nil {
 		return nil, fmt.Errorf("error creating access token")
 	}
 
-	refreshToken, err := s.jwtService.CreateToken(email, time.Hour*24*7)
+	refreshToken, _, err := newOpaqueToken()
 	if err != nil {
 		return nil, fmt.Errorf("error creating refresh token")
 	}
 
-	if err := s.redisRepository.SetToken(refreshToken, email, time.Hour*24*7); err != nil {
-		return nil, fmt.Errorf("error saving refresh token")
+	previous := session.AccessToken
+	session.AccessToken = &TokenRef{ID: accessClaims.Id, ExpiresAt: time.Unix(accessClaims.ExpiresAt, 0).UTC()}
+	if err := s.sessionRepository.Save(*session); err != nil {
+		return nil, fmt.Errorf("error saving session")
+	}
+	if previous != nil {
+		if err := s.jwtService.Revoke(previous.ID, previous.ExpiresAt); err != nil {
+			log.Printf("Could not revoke access token %s: %v", previous.ID, err)
+		}
 	}
 
-	s.setRefreshTokenCookie(w, refreshToken, time.Hour*24*7)
+	stored := RefreshToken{Email: user.Email, FamilyID: session.ID}
+	if err := s.redisRepository.SetToken(refreshToken, stored, refreshTokenTTL); err != nil {
+		return nil, fmt.Errorf("error saving refresh token")
+	}
 
 	return &Tokens{
 		AccessToken:  accessToken,
@@ -115,18 +628,19 @@ func (s *AuthService) createAndSetTokens(email string, w http.ResponseWriter) (*
 	}, nil
 }
 
-func (s *AuthService) getUserByEmail(email string) (*User, error) {
-	userServiceURL := "http://localhost:8080/users/email/" + email
-	resp, err := http.Get(userServiceURL)
-	if err != nil || resp.StatusCode != http.StatusOK {
+func (s *AuthService) getUserById(userId string) (*User, error) {
+	var user User
+	if _, err := s.userService.Do(http.MethodGet, "/internal/users/"+url.PathEscape(userId), nil, &user); err != nil {
 		return nil, fmt.Errorf("user not found")
 	}
+	return &user, nil
+}
 
+func (s *AuthService) getUserByEmail(email string) (*User, error) {
 	var user User
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, fmt.Errorf("error decoding response")
+	if _, err := s.userService.Do(http.MethodGet, "/users/email/"+url.PathEscape(email), nil, &user); err != nil {
+		return nil, fmt.Errorf("user not found")
 	}
-
 	return &user, nil
 }
 
@@ -151,3 +665,19 @@ func (s *AuthService) deleteRefreshTokenCookie(w http.ResponseWriter) {
 		MaxAge:   -1,
 	})
 }
+
+// newOpaqueToken returns a random token for links sent to users together with
+// the hash it is stored under.
+func newOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashOpaqueToken(token), nil
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
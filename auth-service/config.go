@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/spf13/viper"
 	"os"
+	"time"
 )
 
 type Config struct {
@@ -10,18 +11,130 @@ type Config struct {
 }
 
 type ApplicationConfig struct {
-	Server ServerConfig `yaml:"server"`
-	Redis  RedisConfig  `yaml:"redis"`
+	Server            ServerConfig            `yaml:"server"`
+	Redis             RedisConfig             `yaml:"redis"`
+	JWT               JWTConfig               `yaml:"jwt"`
+	Notifier          NotifierConfig          `yaml:"notifier"`
+	PasswordReset     PasswordResetConfig     `yaml:"passwordReset"`
+	EmailVerification EmailVerificationConfig `yaml:"emailVerification"`
+	MFA               MFAConfig               `yaml:"mfa"`
+	BruteForce        BruteForceConfig        `yaml:"bruteForce"`
+	OAuth             OAuthConfig             `yaml:"oauth"`
+	OIDC              OIDCConfig              `yaml:"oidc"`
+	Services          ServicesConfig          `yaml:"services"`
 }
 
 type ServerConfig struct {
 	Port string `yaml:"port"`
+	// TrustedProxies lists the addresses, IPs or CIDR ranges, of the proxies
+	// whose X-Forwarded-For header is believed. Usually only the gateway.
+	TrustedProxies []string `yaml:"trustedProxies"`
 }
 
 type RedisConfig struct {
 	Addr string `yaml:"addr"`
 }
 
+type JWTConfig struct {
+	Issuer       string      `yaml:"issuer"`
+	SigningKeyID string      `yaml:"signingKeyId"`
+	Keys         []KeyConfig `yaml:"keys"`
+}
+
+// NotifierConfig selects how messages reach users: "log" or "file".
+type NotifierConfig struct {
+	Type string `yaml:"type"`
+	File string `yaml:"file"`
+}
+
+// PasswordResetConfig sets how long reset links stay valid and the page they
+// point at. The token is appended as the token query parameter.
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `yaml:"tokenTtl"`
+	ResetURL string        `yaml:"resetUrl"`
+}
+
+// EmailVerificationConfig sets how long verification links stay valid, the
+// page they point at and how often a user may ask for a new one.
+type EmailVerificationConfig struct {
+	TokenTTL       time.Duration `yaml:"tokenTtl"`
+	VerifyURL      string        `yaml:"verifyUrl"`
+	ResendInterval time.Duration `yaml:"resendInterval"`
+}
+
+// MFAConfig sets the issuer shown in authenticator apps and how long the
+// challenge returned by a password login can be completed.
+type MFAConfig struct {
+	Issuer       string        `yaml:"issuer"`
+	ChallengeTTL time.Duration `yaml:"challengeTtl"`
+}
+
+// BruteForceConfig throttles failed logins. Failures are counted per email
+// and per client IP within Window. From DelayAfter failures on, attempts must
+// be spaced BaseDelay apart, doubling with each failure up to MaxDelay, and
+// reaching the max failures locks the key for LockoutDuration.
+type BruteForceConfig struct {
+	Window           time.Duration `yaml:"window"`
+	EmailMaxFailures int           `yaml:"emailMaxFailures"`
+	IPMaxFailures    int           `yaml:"ipMaxFailures"`
+	LockoutDuration  time.Duration `yaml:"lockoutDuration"`
+	DelayAfter       int           `yaml:"delayAfter"`
+	BaseDelay        time.Duration `yaml:"baseDelay"`
+	MaxDelay         time.Duration `yaml:"maxDelay"`
+}
+
+// OAuthConfig registers the clients allowed to use the token endpoint. ClientID
+// is the id auth-service uses for the service tokens it issues to itself.
+type OAuthConfig struct {
+	ClientID        string              `yaml:"clientId"`
+	ServiceTokenTTL time.Duration       `yaml:"serviceTokenTtl"`
+	Clients         []OAuthClientConfig `yaml:"clients"`
+}
+
+// OAuthClientConfig registers a client with the grant types and scopes it may
+// use. Confidential clients authenticate with a secret, of which only the
+// bcrypt hash is configured. Public clients, such as single page apps, have
+// no secret and rely on PKCE. Clients using the authorization code grant must
+// register every redirect URI, and SkipConsent is meant for our own apps.
+type OAuthClientConfig struct {
+	ID           string   `yaml:"id"`
+	Name         string   `yaml:"name"`
+	SecretHash   string   `yaml:"secretHash"`
+	Public       bool     `yaml:"public"`
+	GrantTypes   []string `yaml:"grantTypes"`
+	Scopes       []string `yaml:"scopes"`
+	RedirectURIs []string `yaml:"redirectUris"`
+	SkipConsent  bool     `yaml:"skipConsent"`
+}
+
+// OIDCConfig sets the login page the authorization endpoint sends users to,
+// with the pending request id as the request query parameter, and how long
+// requests, authorization codes and ID tokens stay valid.
+type OIDCConfig struct {
+	LoginURL   string        `yaml:"loginUrl"`
+	RequestTTL time.Duration `yaml:"requestTtl"`
+	CodeTTL    time.Duration `yaml:"codeTtl"`
+	IDTokenTTL time.Duration `yaml:"idTokenTtl"`
+}
+
+// ServicesConfig holds base URLs of the services auth-service calls.
+type ServicesConfig struct {
+	UserServiceURL string `yaml:"userServiceUrl"`
+}
+
+// KeyConfig describes one signing key. The key material is given either
+// inline as PEM or as a path to a PEM file. NotAfter (RFC 3339) stops a
+// retired key from verifying tokens and from being published in the JWKS.
+type KeyConfig struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"`
+	PrivateKey     string `yaml:"privateKey"`
+	PrivateKeyFile string `yaml:"privateKeyFile"`
+	PublicKey      string `yaml:"publicKey"`
+	PublicKeyFile  string `yaml:"publicKeyFile"`
+	NotAfter       string `yaml:"notAfter"`
+}
+
 func NewConfiguration() *Config {
 	applicationConfig := &ApplicationConfig{}
 	applicationConfig.readApplicationConfig()
@@ -2,19 +2,37 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"idempotency"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 type AuthController struct {
 	authService IAuthService
+	clients     *ClientInfoResolver
+	idempotency *idempotency.Middleware
 }
 
-func NewAuthController(authService IAuthService) *AuthController {
+type RevokeTokenRequest struct {
+	JTI string `json:"jti"`
+}
+
+type UnlockLoginRequest struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+func NewAuthController(authService IAuthService, clients *ClientInfoResolver, idempotency *idempotency.Middleware) *AuthController {
 	return &AuthController{
 		authService: authService,
+		clients:     clients,
+		idempotency: idempotency,
 	}
 }
 
@@ -25,7 +43,7 @@ func (c *AuthController) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokens, err := c.authService.Register(creds, w)
+	tokens, err := c.authService.Register(creds, c.clients.ClientInfo(r), w)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -42,7 +60,34 @@ func (c *AuthController) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokens, err := c.authService.Login(creds, w)
+	tokens, challenge, err := c.authService.Login(creds, c.clients.ClientInfo(r), w)
+	if c.writeRetryAfter(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if challenge != nil {
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (c *AuthController) loginMFA(w http.ResponseWriter, r *http.Request) {
+	var login MFALogin
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil || login.ChallengeToken == "" || login.Code == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := c.authService.CompleteMFALogin(login, c.clients.ClientInfo(r), w)
+	if c.writeRetryAfter(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -59,7 +104,7 @@ func (c *AuthController) refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokens, err := c.authService.Refresh(tokenReq, w)
+	tokens, err := c.authService.Refresh(tokenReq, c.clients.ClientInfo(r), w)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -85,6 +130,307 @@ func (c *AuthController) logout(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (c *AuthController) getSessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := c.authService.GetSessions(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func (c *AuthController) revokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	err = c.authService.RevokeSession(claims, mux.Vars(r)["id"])
+	if errors.Is(err, ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *AuthController) logoutAll(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.authService.LogoutAll(claims, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *AuthController) changePassword(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var change ChangePassword
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil || change.NewPassword == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err = c.authService.ChangePassword(claims, change, w)
+	if errors.Is(err, ErrInvalidPassword) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *AuthController) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPassword
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// The response never depends on the outcome, otherwise it would tell
+	// whether the email is registered.
+	if err := c.authService.ForgotPassword(req); err != nil {
+		log.Printf("Password reset request failed: %v", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (c *AuthController) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPassword
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := c.authService.ResetPassword(req)
+	if errors.Is(err, ErrInvalidResetToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *AuthController) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	err := c.authService.VerifyEmail(token)
+	if errors.Is(err, ErrInvalidVerificationToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Email verified\n"))
+}
+
+func (c *AuthController) resendVerification(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	err = c.authService.ResendVerification(claims)
+	if c.writeRetryAfter(w, err) {
+		return
+	}
+	if errors.Is(err, ErrEmailAlreadyVerified) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (c *AuthController) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := c.authService.EnrollTOTP(claims)
+	if err != nil {
+		c.handleMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+func (c *AuthController) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var code MFACode
+	if err := json.NewDecoder(r.Body).Decode(&code); err != nil || code.Code == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := c.authService.ConfirmTOTP(claims, code)
+	if err != nil {
+		c.handleMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(codes)
+}
+
+func (c *AuthController) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var code MFACode
+	if err := json.NewDecoder(r.Body).Decode(&code); err != nil || code.Code == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := c.authService.RegenerateRecoveryCodes(claims, code)
+	if err != nil {
+		c.handleMFAError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(codes)
+}
+
+func (c *AuthController) handleMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrTOTPAlreadyEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrTOTPNotEnrolled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (c *AuthController) revokeToken(w http.ResponseWriter, r *http.Request) {
+	var req RevokeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.JTI == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.authService.RevokeToken(req.JTI); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *AuthController) unlockLogin(w http.ResponseWriter, r *http.Request) {
+	var req UnlockLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Email == "" && req.IP == "") {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.authService.UnlockLogin(req.Email, req.IP); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *AuthController) revokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	if err := c.authService.RevokeUserSessions(mux.Vars(r)["email"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeRetryAfter answers 429 with a Retry-After header when err asks the
+// caller to wait, and reports whether it did.
+func (c *AuthController) writeRetryAfter(w http.ResponseWriter, err error) bool {
+	var retryAfter *RetryAfterError
+	if !errors.As(err, &retryAfter) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.RetryAfter.Seconds()))))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+	return true
+}
+
+func (c *AuthController) authenticate(r *http.Request) (*Claims, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, fmt.Errorf("Missing or invalid Authorization header")
+	}
+	claims, err := c.authService.Authenticate(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return nil, err
+	}
+	// Tokens granted to a client do not manage the user's account.
+	if claims.Audience != "" {
+		return nil, fmt.Errorf("tokens granted to a client are not accepted")
+	}
+	return claims, nil
+}
+
 func (c *AuthController) getTokens(r *http.Request) (Tokens, error) {
 	var tokenReq Tokens
 
@@ -107,8 +453,26 @@ func (c *AuthController) getTokens(r *http.Request) (Tokens, error) {
 }
 
 func (c *AuthController) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/auth/register", c.register).Methods("POST")
+	router.HandleFunc("/auth/register", c.idempotency.Handler(c.register)).Methods("POST")
 	router.HandleFunc("/auth/login", c.login).Methods("POST")
+	router.HandleFunc("/auth/login/mfa", c.loginMFA).Methods("POST")
 	router.HandleFunc("/auth/refresh", c.refresh).Methods("POST")
 	router.HandleFunc("/auth/logout", c.logout).Methods("POST")
+	router.HandleFunc("/auth/logout-all", c.logoutAll).Methods("POST")
+	router.HandleFunc("/auth/sessions", c.getSessions).Methods("GET")
+	router.HandleFunc("/auth/sessions/{id}", c.revokeSession).Methods("DELETE")
+	router.HandleFunc("/auth/password/change", c.changePassword).Methods("POST")
+	router.HandleFunc("/auth/password/forgot", c.forgotPassword).Methods("POST")
+	router.HandleFunc("/auth/password/reset", c.resetPassword).Methods("POST")
+	router.HandleFunc("/auth/verify-email", c.verifyEmail).Methods("GET")
+	router.HandleFunc("/auth/verify-email/resend", c.resendVerification).Methods("POST")
+	router.HandleFunc("/auth/mfa/totp/enroll", c.enrollTOTP).Methods("POST")
+	router.HandleFunc("/auth/mfa/totp/confirm", c.confirmTOTP).Methods("POST")
+	router.HandleFunc("/auth/mfa/recovery-codes", c.regenerateRecoveryCodes).Methods("POST")
+
+	revoke := RequirePermissions(c.authService, "sessions:revoke")
+	unlock := RequirePermissions(c.authService, "logins:unlock")
+	router.Handle("/auth/admin/revocations", revoke(http.HandlerFunc(c.revokeToken))).Methods("POST")
+	router.Handle("/auth/admin/login-lockouts/unlock", unlock(http.HandlerFunc(c.unlockLogin))).Methods("POST")
+	router.Handle("/auth/admin/users/{email}/sessions", revoke(http.HandlerFunc(c.revokeUserSessions))).Methods("DELETE")
 }
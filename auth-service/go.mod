@@ -4,6 +4,7 @@ go 1.22.3
 
 require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
 	github.com/redis/go-redis/v9 v9.6.0
 	github.com/spf13/viper v1.19.0
@@ -33,3 +34,7 @@ require (
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+require idempotency v0.0.0
+
+replace idempotency => ../idempotency
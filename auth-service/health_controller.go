@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"time"
+)
+
+// HealthController reports whether the service can reach Redis. The gateway
+// uses it for its active health checks.
+type HealthController struct {
+	client *redis.Client
+}
+
+func NewHealthController(client *redis.Client) *HealthController {
+	return &HealthController{client: client}
+}
+
+func (c *HealthController) health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status, code := "up", http.StatusOK
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		status, code = "down", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+func (c *HealthController) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/health", c.health).Methods("GET")
+}
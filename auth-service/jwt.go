@@ -3,44 +3,191 @@ package main
 import (
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"strings"
 	"time"
 )
 
+// accessTokenClaimType is the typ claim of access tokens. ID tokens are
+// signed with the same keys and must not be accepted in their place.
+const accessTokenClaimType = "access"
+
 type Tokens struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
 
 type Claims struct {
-	Email string `json:"email"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Roles         []string `json:"roles,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	SessionID     string   `json:"sid,omitempty"`
+	ClientID      string   `json:"client_id,omitempty"`
+	Scope         string   `json:"scope,omitempty"`
+	TokenType     string   `json:"typ"`
+	jwt.StandardClaims
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. The email and
+// name claims are only filled in when the matching scope was granted.
+type IDTokenClaims struct {
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
 	jwt.StandardClaims
 }
 
+func (c *Claims) HasScope(scope string) bool {
+	return contains(strings.Fields(c.Scope), scope)
+}
+
+func (c *Claims) HasPermissions(permissions ...string) bool {
+	for _, required := range permissions {
+		found := false
+		for _, granted := range c.Permissions {
+			if granted == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 type IJWTService interface {
-	CreateToken(string, time.Duration) (string, error)
+	CreateToken(*User, *Session, time.Duration) (string, *Claims, error)
+	CreateServiceToken(string, []string, time.Duration) (string, *Claims, error)
+	CreateIDToken(IDTokenClaims, time.Duration) (string, error)
 	VerifyToken(string) (*Claims, error)
+	Revoke(string, time.Time) error
+	JWKS() JWKSet
 }
 
+// JWTService signs tokens with the active key of its key ring and verifies
+// them with whichever key the token's kid header names. Rotating keys means
+// adding a new key, making it the signing key and keeping the old one in the
+// ring (optionally with notAfter) until every token it signed has expired.
 type JWTService struct {
+	keys        map[string]*SigningKey
+	signingKey  *SigningKey
+	issuer      string
+	revocations IRevocationStore
 }
 
-func NewJWTService() *JWTService {
-	return &JWTService{}
+func NewJWTService(cfg JWTConfig, revocations IRevocationStore) (*JWTService, error) {
+	keys, err := loadSigningKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &JWTService{
+		keys:        make(map[string]*SigningKey, len(keys)),
+		issuer:      cfg.Issuer,
+		revocations: revocations,
+	}
+	for _, key := range keys {
+		if _, ok := s.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		s.keys[key.ID] = key
+	}
+
+	signingKeyId := cfg.SigningKeyID
+	if signingKeyId == "" {
+		signingKeyId = keys[0].ID
+	}
+	signingKey, ok := s.keys[signingKeyId]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not configured", signingKeyId)
+	}
+	if signingKey.PrivateKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKeyId)
+	}
+	s.signingKey = signingKey
+
+	return s, nil
 }
 
-var jwtKey = []byte("my_secret_key")
+// CreateToken issues a user token for the session. Tokens of sessions granted
+// to an OpenID Connect client name it as audience and carry the granted scope
+// instead of the user's roles, with only the permissions the scope names.
+func (s *JWTService) CreateToken(user *User, session *Session, expirationTime time.Duration) (string, *Claims, error) {
+	expiration := time.Now().Add(expirationTime)
+	claims := &Claims{
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Roles:         user.Roles,
+		Permissions:   user.Permissions,
+		SessionID:     session.ID,
+		Scope:         session.Scope,
+		TokenType:     accessTokenClaimType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New().String(),
+			Audience:  session.ClientID,
+			Issuer:    s.issuer,
+			Subject:   user.ID,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiration.Unix(),
+		},
+	}
+	if session.ClientID != "" {
+		claims.Roles = nil
+		claims.Permissions = scopedPermissions(user.Permissions, session.Scope)
+	}
+
+	return s.sign(claims)
+}
 
-func (s *JWTService) CreateToken(email string, expirationTime time.Duration) (string, error) {
+// CreateServiceToken issues a token to an OAuth client rather than a user.
+// The client id is the subject and the granted scopes are space separated in
+// the scope claim.
+func (s *JWTService) CreateServiceToken(clientId string, scopes []string, expirationTime time.Duration) (string, *Claims, error) {
 	expiration := time.Now().Add(expirationTime)
 	claims := &Claims{
-		Email: email,
+		ClientID:  clientId,
+		Scope:     strings.Join(scopes, " "),
+		TokenType: accessTokenClaimType,
 		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New().String(),
+			Issuer:    s.issuer,
+			Subject:   clientId,
+			IssuedAt:  time.Now().Unix(),
 			ExpiresAt: expiration.Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(jwtKey)
+	return s.sign(claims)
+}
+
+// CreateIDToken fills in the id, issuer and lifetime of an ID token and
+// signs it. Subject, audience and the user claims are up to the caller.
+func (s *JWTService) CreateIDToken(claims IDTokenClaims, expirationTime time.Duration) (string, error) {
+	claims.Id = uuid.New().String()
+	claims.Issuer = s.issuer
+	claims.IssuedAt = time.Now().Unix()
+	claims.ExpiresAt = time.Now().Add(expirationTime).Unix()
+
+	return s.signClaims(claims)
+}
+
+func (s *JWTService) sign(claims *Claims) (string, *Claims, error) {
+	signedToken, err := s.signClaims(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signedToken, claims, nil
+}
+
+func (s *JWTService) signClaims(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.signingKey.Method, claims)
+	token.Header["kid"] = s.signingKey.ID
+	signedToken, err := token.SignedString(s.signingKey.PrivateKey)
 
 	if err != nil {
 		return "", fmt.Errorf("error signing token: %w", err)
@@ -51,14 +198,73 @@ func (s *JWTService) CreateToken(email string, expirationTime time.Duration) (st
 
 func (s *JWTService) VerifyToken(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, claims, s.keyFunc)
 	if err != nil {
 		return nil, err
 	}
 	if !token.Valid {
 		return nil, fmt.Errorf("invalid token")
 	}
+	if claims.TokenType != accessTokenClaimType {
+		return nil, fmt.Errorf("not an access token")
+	}
+
+	revoked, err := s.revocations.IsRevoked(claims.Id)
+	if err != nil {
+		return nil, fmt.Errorf("error checking token revocation: %w", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("token has been revoked")
+	}
 	return claims, nil
 }
+
+// Revoke puts a token id on the revocation list until the token expires.
+func (s *JWTService) Revoke(jti string, expiresAt time.Time) error {
+	remaining := time.Until(expiresAt)
+	if jti == "" || remaining <= 0 {
+		return nil
+	}
+	return s.revocations.Revoke(jti, remaining)
+}
+
+// scopedPermissions keeps the user's permissions that the granted scope
+// names.
+func scopedPermissions(permissions []string, scope string) []string {
+	scopes := strings.Fields(scope)
+	var granted []string
+	for _, permission := range permissions {
+		if contains(scopes, permission) {
+			granted = append(granted, permission)
+		}
+	}
+	return granted
+}
+
+// keyFunc selects the verification key by kid and refuses tokens whose alg
+// header does not match the key, which rules out algorithm confusion attacks.
+func (s *JWTService) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok || key.expired(time.Now()) {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.PublicKey, nil
+}
+
+// JWKS returns the public half of every key that may still have signed a
+// valid token.
+func (s *JWTService) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	now := time.Now()
+	for _, key := range s.keys {
+		if key.expired(now) {
+			continue
+		}
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set
+}
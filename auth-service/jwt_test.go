@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestJWTService(t *testing.T) *JWTService {
+	t.Helper()
+	jwtService, err := NewJWTService(JWTConfig{Issuer: "http://localhost:8081"}, NewMemoryRevocationStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwtService
+}
+
+func TestJWTServiceRevoke(t *testing.T) {
+	user := &User{ID: "u1", Email: "a@example.com"}
+
+	tests := []struct {
+		name        string
+		revoke      func(*Claims) (string, time.Time)
+		wantRevoked bool
+	}{
+		{
+			name:        "revoked token",
+			revoke:      func(c *Claims) (string, time.Time) { return c.Id, time.Unix(c.ExpiresAt, 0) },
+			wantRevoked: true,
+		},
+		{
+			name:   "another token revoked",
+			revoke: func(c *Claims) (string, time.Time) { return "other", time.Unix(c.ExpiresAt, 0) },
+		},
+		{
+			name:   "already expired revocation is skipped",
+			revoke: func(c *Claims) (string, time.Time) { return c.Id, time.Now().Add(-time.Second) },
+		},
+		{
+			name:   "empty id is skipped",
+			revoke: func(c *Claims) (string, time.Time) { return "", time.Unix(c.ExpiresAt, 0) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwtService := newTestJWTService(t)
+			token, claims, err := jwtService.CreateToken(user, &Session{ID: "s1"}, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := jwtService.Revoke(tt.revoke(claims)); err != nil {
+				t.Fatalf("Revoke() = %v", err)
+			}
+			_, err = jwtService.VerifyToken(token)
+			if revoked := err != nil; revoked != tt.wantRevoked {
+				t.Errorf("VerifyToken() = %v, want revoked %t", err, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStoreExpiry(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	store.Revoke("expired", -time.Second)
+	store.Revoke("live", time.Minute)
+
+	tests := []struct {
+		jti  string
+		want bool
+	}{
+		{"expired", false},
+		{"live", true},
+		{"unknown", false},
+	}
+	for _, tt := range tests {
+		if got, _ := store.IsRevoked(tt.jti); got != tt.want {
+			t.Errorf("IsRevoked(%q) = %t, want %t", tt.jti, got, tt.want)
+		}
+	}
+}
+
+func TestJWTServiceVerifyTokenType(t *testing.T) {
+	jwtService := newTestJWTService(t)
+	user := &User{ID: "u1", Email: "a@example.com"}
+
+	accessToken, _, err := jwtService.CreateToken(user, &Session{ID: "s1"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceToken, _, err := jwtService.CreateServiceToken("worker", []string{"users:read"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := jwtService.CreateIDToken(IDTokenClaims{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"access token", accessToken, false},
+		{"service token", serviceToken, false},
+		{"id token", idToken, true},
+		{"garbage", "not-a-token", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := jwtService.VerifyToken(tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("VerifyToken() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTServiceClientSessionPermissions(t *testing.T) {
+	jwtService := newTestJWTService(t)
+	user := &User{
+		ID:          "u1",
+		Email:       "a@example.com",
+		Roles:       []string{"admin"},
+		Permissions: []string{"orders:read", "users:write"},
+	}
+
+	tests := []struct {
+		name            string
+		session         *Session
+		wantRoles       int
+		wantPermissions []string
+	}{
+		{"own session", &Session{ID: "s1"}, 1, []string{"orders:read", "users:write"}},
+		{"client session", &Session{ID: "s2", ClientID: "web", Scope: "openid email"}, 0, nil},
+		{"client session with a permission scope", &Session{ID: "s3", ClientID: "web", Scope: "openid orders:read"}, 0, []string{"orders:read"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, claims, err := jwtService.CreateToken(user, tt.session, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(claims.Roles) != tt.wantRoles {
+				t.Errorf("roles = %v, want %d", claims.Roles, tt.wantRoles)
+			}
+			if strings.Join(claims.Permissions, ",") != strings.Join(tt.wantPermissions, ",") {
+				t.Errorf("permissions = %v, want %v", claims.Permissions, tt.wantPermissions)
+			}
+			if claims.Audience != tt.session.ClientID {
+				t.Errorf("audience = %q, want %q", claims.Audience, tt.session.ClientID)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"log"
+	"math/big"
+	"os"
+	"time"
+)
+
+// SigningKey is one entry of the key ring. Only the active key has to hold a
+// private key; retired keys may be configured with just their public key so
+// that tokens they signed keep verifying until NotAfter.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	NotAfter   time.Time
+}
+
+func (k *SigningKey) expired(now time.Time) bool {
+	return !k.NotAfter.IsZero() && now.After(k.NotAfter)
+}
+
+func loadSigningKeys(cfg JWTConfig) ([]*SigningKey, error) {
+	if len(cfg.Keys) == 0 {
+		log.Println("No JWT signing keys configured, generating an ephemeral RS256 key")
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		return []*SigningKey{{
+			ID:         "ephemeral-" + time.Now().UTC().Format("20060102150405"),
+			Method:     jwt.SigningMethodRS256,
+			PrivateKey: privateKey,
+			PublicKey:  privateKey.Public(),
+		}}, nil
+	}
+
+	keys := make([]*SigningKey, 0, len(cfg.Keys))
+	for _, keyConfig := range cfg.Keys {
+		key, err := loadSigningKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %q: %w", keyConfig.ID, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func loadSigningKey(cfg KeyConfig) (*SigningKey, error) {
+	if cfg.ID == "" {
+		return nil, fmt.Errorf("key id is required")
+	}
+
+	var method jwt.SigningMethod
+	switch cfg.Algorithm {
+	case "RS256":
+		method = jwt.SigningMethodRS256
+	case "ES256":
+		method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	key := &SigningKey{ID: cfg.ID, Method: method}
+
+	if cfg.NotAfter != "" {
+		notAfter, err := time.Parse(time.RFC3339, cfg.NotAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notAfter: %w", err)
+		}
+		key.NotAfter = notAfter
+	}
+
+	switch {
+	case cfg.PrivateKey != "" || cfg.PrivateKeyFile != "":
+		data, err := readPEM(cfg.PrivateKey, cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = privateKey
+		key.PublicKey = privateKey.Public()
+	case cfg.PublicKey != "" || cfg.PublicKeyFile != "":
+		data, err := readPEM(cfg.PublicKey, cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := parsePublicKey(data)
+		if err != nil {
+			return nil, err
+		}
+		key.PublicKey = publicKey
+	default:
+		return nil, fmt.Errorf("either a private or a public key is required")
+	}
+
+	switch key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("RSA key configured for %s", cfg.Algorithm)
+		}
+	case *ecdsa.PublicKey:
+		if method != jwt.SigningMethodES256 || key.PublicKey.(*ecdsa.PublicKey).Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ES256 requires a P-256 key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.PublicKey)
+	}
+
+	return key, nil
+}
+
+func readPEM(inline, file string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return data, nil
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{
+		Kid: k.ID,
+		Use: "sig",
+		Alg: k.Method.Alg(),
+	}
+
+	switch publicKey := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = publicKey.Curve.Params().Name
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, size)))
+	}
+
+	return jwk
+}
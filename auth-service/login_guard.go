@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// ILoginAttemptStore counts failed logins per key in a sliding window and
+// holds temporary lockouts.
+type ILoginAttemptStore interface {
+	AddFailure(string, time.Time, time.Duration) (int, error)
+	Failures(string, time.Time, time.Duration) (int, time.Time, error)
+	Lock(string, time.Duration) error
+	LockedFor(string) (time.Duration, error)
+	Reset(string) error
+}
+
+// LoginGuard throttles password and second factor attempts by email and by
+// client IP. After DelayAfter failures every further attempt has to wait
+// twice as long as the previous one, and MaxFailures within the window locks
+// the key until the lockout expires or an admin unlocks it.
+type LoginGuard struct {
+	store  ILoginAttemptStore
+	events ISecurityEventPublisher
+	cfg    BruteForceConfig
+}
+
+func NewLoginGuard(store ILoginAttemptStore, events ISecurityEventPublisher, cfg BruteForceConfig) *LoginGuard {
+	return &LoginGuard{
+		store:  store,
+		events: events,
+		cfg:    cfg,
+	}
+}
+
+type loginKey struct {
+	key         string
+	maxFailures int
+}
+
+// Check returns a *RetryAfterError when the email or the IP has to wait.
+func (g *LoginGuard) Check(email string, ip string) error {
+	now := time.Now()
+	var wait time.Duration
+
+	for _, k := range g.keys(email, ip) {
+		locked, err := g.store.LockedFor(k.key)
+		if err != nil {
+			return fmt.Errorf("error checking login lockout")
+		}
+		if locked > wait {
+			wait = locked
+		}
+
+		failures, last, err := g.store.Failures(k.key, now, g.cfg.Window)
+		if err != nil {
+			return fmt.Errorf("error checking login attempts")
+		}
+		if remaining := last.Add(g.delay(failures)).Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	if wait > 0 {
+		g.events.Publish(SecurityEvent{
+			Type:   LoginBlockedEvent,
+			Email:  email,
+			IP:     ip,
+			Detail: fmt.Sprintf("login attempt rejected, retry after %s", wait.Round(time.Second)),
+		})
+		return &RetryAfterError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// Fail records a failed attempt and locks every key that reached its limit.
+func (g *LoginGuard) Fail(email string, ip string, reason string) {
+	now := time.Now()
+	g.events.Publish(SecurityEvent{
+		Type:   LoginFailedEvent,
+		Email:  email,
+		IP:     ip,
+		Detail: reason,
+	})
+
+	for _, k := range g.keys(email, ip) {
+		failures, err := g.store.AddFailure(k.key, now, g.cfg.Window)
+		if err != nil {
+			log.Printf("Could not record failed login for %s: %v", k.key, err)
+			continue
+		}
+		if failures < k.maxFailures {
+			continue
+		}
+
+		if err := g.store.Lock(k.key, g.cfg.LockoutDuration); err != nil {
+			log.Printf("Could not lock %s: %v", k.key, err)
+			continue
+		}
+		g.events.Publish(SecurityEvent{
+			Type:   LoginLockedEvent,
+			Email:  email,
+			IP:     ip,
+			Detail: fmt.Sprintf("%s locked for %s after %d failed attempts", k.key, g.cfg.LockoutDuration, failures),
+		})
+	}
+}
+
+// Succeed clears the failures of the email. The IP keeps its count, otherwise
+// one valid account would let an attacker reset the IP limit at will.
+func (g *LoginGuard) Succeed(email string) {
+	if err := g.store.Reset(emailLoginKey(email)); err != nil {
+		log.Printf("Could not reset failed logins for %s: %v", email, err)
+	}
+}
+
+// Unlock lifts the lockout and failures of an email and/or an IP.
+func (g *LoginGuard) Unlock(email string, ip string) error {
+	for _, k := range g.keys(email, ip) {
+		if err := g.store.Reset(k.key); err != nil {
+			return fmt.Errorf("error unlocking %s", k.key)
+		}
+	}
+	return nil
+}
+
+func (g *LoginGuard) keys(email string, ip string) []loginKey {
+	var keys []loginKey
+	if email != "" {
+		keys = append(keys, loginKey{key: emailLoginKey(email), maxFailures: g.cfg.EmailMaxFailures})
+	}
+	if ip != "" {
+		keys = append(keys, loginKey{key: "ip:" + ip, maxFailures: g.cfg.IPMaxFailures})
+	}
+	return keys
+}
+
+func (g *LoginGuard) delay(failures int) time.Duration {
+	if failures < g.cfg.DelayAfter || g.cfg.BaseDelay <= 0 {
+		return 0
+	}
+	delay := time.Duration(float64(g.cfg.BaseDelay) * math.Pow(2, float64(failures-g.cfg.DelayAfter)))
+	if delay > g.cfg.MaxDelay || delay <= 0 {
+		return g.cfg.MaxDelay
+	}
+	return delay
+}
+
+func emailLoginKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type recordedEvents struct {
+	events []SecurityEvent
+}
+
+func (r *recordedEvents) Publish(event SecurityEvent) {
+	r.events = append(r.events, event)
+}
+
+func (r *recordedEvents) count(eventType string) int {
+	n := 0
+	for _, event := range r.events {
+		if event.Type == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+func testBruteForceConfig() BruteForceConfig {
+	return BruteForceConfig{
+		Window:           15 * time.Minute,
+		EmailMaxFailures: 5,
+		IPMaxFailures:    8,
+		LockoutDuration:  time.Hour,
+		DelayAfter:       3,
+		BaseDelay:        time.Second,
+		MaxDelay:         10 * time.Second,
+	}
+}
+
+func TestLoginGuardDelay(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryLoginAttemptStore(), &recordedEvents{}, testBruteForceConfig())
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{7, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := guard.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuardCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		emails     []string
+		ip         string
+		checkEmail string
+		checkIP    string
+		wantWait   bool
+		wantLocks  int
+	}{
+		{
+			name:       "below the delay threshold",
+			emails:     []string{"a@example.com", "a@example.com"},
+			ip:         "10.0.0.1",
+			checkEmail: "a@example.com",
+			checkIP:    "10.0.0.1",
+		},
+		{
+			name:       "delayed after the threshold",
+			emails:     []string{"a@example.com", "a@example.com", "a@example.com"},
+			ip:         "10.0.0.1",
+			checkEmail: "a@example.com",
+			checkIP:    "10.0.0.2",
+			wantWait:   true,
+		},
+		{
+			name:       "email is matched case insensitively",
+			emails:     []string{"A@example.com", "a@example.com", "a@EXAMPLE.com"},
+			ip:         "10.0.0.1",
+			checkEmail: "a@example.com",
+			checkIP:    "10.0.0.2",
+			wantWait:   true,
+		},
+		{
+			name:       "email locked at its limit",
+			emails:     []string{"a@example.com", "a@example.com", "a@example.com", "a@example.com", "a@example.com"},
+			ip:         "10.0.0.1",
+			checkEmail: "a@example.com",
+			checkIP:    "10.0.0.2",
+			wantWait:   true,
+			wantLocks:  1,
+		},
+		{
+			name:       "ip throttled across emails",
+			emails:     []string{"a@example.com", "b@example.com", "c@example.com"},
+			ip:         "10.0.0.1",
+			checkEmail: "d@example.com",
+			checkIP:    "10.0.0.1",
+			wantWait:   true,
+		},
+		{
+			name:       "other email and ip are not affected",
+			emails:     []string{"a@example.com", "a@example.com", "a@example.com", "a@example.com", "a@example.com"},
+			ip:         "10.0.0.1",
+			checkEmail: "b@example.com",
+			checkIP:    "10.0.0.2",
+			wantLocks:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := &recordedEvents{}
+			guard := NewLoginGuard(NewMemoryLoginAttemptStore(), events, testBruteForceConfig())
+			for _, email := range tt.emails {
+				guard.Fail(email, tt.ip, "invalid credentials")
+			}
+
+			err := guard.Check(tt.checkEmail, tt.checkIP)
+			var retry *RetryAfterError
+			if waited := errors.As(err, &retry); waited != tt.wantWait {
+				t.Fatalf("Check() = %v, want wait %t", err, tt.wantWait)
+			}
+			if got := events.count(LoginLockedEvent); got != tt.wantLocks {
+				t.Errorf("%d lock events, want %d", got, tt.wantLocks)
+			}
+		})
+	}
+}
+
+func TestLoginGuardLockoutOutlastsDelay(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryLoginAttemptStore(), &recordedEvents{}, testBruteForceConfig())
+	for i := 0; i < 5; i++ {
+		guard.Fail("a@example.com", "10.0.0.1", "invalid credentials")
+	}
+
+	var retry *RetryAfterError
+	if err := guard.Check("a@example.com", ""); !errors.As(err, &retry) {
+		t.Fatalf("Check() = %v, want a RetryAfterError", err)
+	}
+	if retry.RetryAfter <= 59*time.Minute {
+		t.Errorf("RetryAfter = %s, want the lockout duration", retry.RetryAfter)
+	}
+}
+
+func TestLoginGuardSucceedKeepsIPFailures(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryLoginAttemptStore(), &recordedEvents{}, testBruteForceConfig())
+	for i := 0; i < 3; i++ {
+		guard.Fail("a@example.com", "10.0.0.1", "invalid credentials")
+	}
+	guard.Succeed("A@example.com")
+
+	if err := guard.Check("a@example.com", ""); err != nil {
+		t.Errorf("Check(email) after success = %v, want nil", err)
+	}
+	if err := guard.Check("", "10.0.0.1"); err == nil {
+		t.Error("Check(ip) after success = nil, want the ip to stay throttled")
+	}
+}
+
+func TestLoginGuardUnlock(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryLoginAttemptStore(), &recordedEvents{}, testBruteForceConfig())
+	for i := 0; i < 8; i++ {
+		guard.Fail("a@example.com", "10.0.0.1", "invalid credentials")
+	}
+
+	if err := guard.Unlock("a@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Unlock() = %v", err)
+	}
+	if err := guard.Check("a@example.com", "10.0.0.1"); err != nil {
+		t.Errorf("Check() after unlock = %v, want nil", err)
+	}
+}
+
+func TestMemoryLoginAttemptStoreWindow(t *testing.T) {
+	window := time.Minute
+	start := time.UnixMilli(1700000000000)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want int
+	}{
+		{"within the window", start.Add(window - time.Millisecond), 1},
+		{"exactly one window old", start.Add(window), 0},
+		{"past the window", start.Add(window + time.Millisecond), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryLoginAttemptStore()
+			store.AddFailure("email:a@example.com", start, window)
+
+			count, _, err := store.Failures("email:a@example.com", tt.now, window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Errorf("Failures() = %d, want %d", count, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatScore(t *testing.T) {
+	start := time.UnixMilli(1700000000000)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"inclusive bound in milliseconds", start, "1700000000000"},
+		{"sub-millisecond part is dropped", start.Add(999 * time.Microsecond), "1700000000000"},
+		{"next millisecond", start.Add(time.Millisecond), "1700000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatScore(tt.at); got != tt.want {
+				t.Errorf("formatScore() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"github.com/gorilla/mux"
+	"idempotency"
 	"log"
 	"net/http"
+	"time"
 )
 
 func main() {
@@ -11,12 +13,49 @@ func main() {
 	redisClient := InitializeRedis(cfg.Redis)
 
 	redisRepository := NewRedisRepository(redisClient)
-	jwtService := NewJWTService()
-	authService := NewAuthService(redisRepository, jwtService)
-	authController := NewAuthController(authService)
+	revocationStore := NewRedisRevocationStore(redisClient)
+	jwtService, err := NewJWTService(cfg.JWT, revocationStore)
+	if err != nil {
+		log.Fatalf("Error initializing JWT service: %v", err)
+	}
+	securityEvents := NewRedisSecurityEventPublisher(redisClient, "security-events")
+	sessionRepository := NewRedisSessionRepository(redisClient)
+	passwordResets := NewRedisOneTimeTokenRepository(redisClient, passwordResetPurpose)
+	emailVerifications := NewRedisOneTimeTokenRepository(redisClient, emailVerificationPurpose)
+	mfaChallenges := NewRedisOneTimeTokenRepository(redisClient, mfaChallengePurpose)
+	mfaRepository := NewRedisMFARepository(redisClient)
+	loginGuard := NewLoginGuard(NewRedisLoginAttemptStore(redisClient), securityEvents, cfg.BruteForce)
+	notifier, err := NewNotifier(cfg.Notifier)
+	if err != nil {
+		log.Fatalf("Error initializing notifier: %v", err)
+	}
+	serviceTokens := NewServiceTokenSource(jwtService, cfg.OAuth.ClientID, userServiceScopes, cfg.OAuth.ServiceTokenTTL)
+	userService := NewUserServiceClient(cfg.Services.UserServiceURL, serviceTokens)
+	authService := NewAuthService(redisRepository, sessionRepository, passwordResets, emailVerifications,
+		mfaChallenges, mfaRepository, loginGuard, jwtService, securityEvents, notifier, userService, cfg.PasswordReset,
+		cfg.EmailVerification, cfg.MFA)
+	clients, err := NewClientInfoResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Error loading trusted proxies: %v", err)
+	}
+	idempotencyMiddleware := idempotency.NewMiddleware(idempotency.NewRedisStore(redisClient), time.Hour*24, clients.IP)
+	authController := NewAuthController(authService, clients, idempotencyMiddleware)
 
 	router := mux.NewRouter()
 	authController.RegisterRoutes(router)
+	wellKnownController := NewWellKnownController(jwtService, cfg.JWT.Issuer)
+	wellKnownController.RegisterRoutes(router)
+
+	oauthClients, err := NewConfigOAuthClientRepository(cfg.OAuth.Clients)
+	if err != nil {
+		log.Fatalf("Error loading oauth clients: %v", err)
+	}
+	oauthService := NewOAuthService(oauthClients, NewRedisOIDCRepository(redisClient), authService, jwtService,
+		userService, cfg.OAuth, cfg.OIDC)
+	oauthController := NewOAuthController(oauthService, authService, clients)
+	oauthController.RegisterRoutes(router)
+	healthController := NewHealthController(redisClient)
+	healthController.RegisterRoutes(router)
 
 	log.Printf("Server is running on port %s", cfg.Server.Port)
 	if err := http.ListenAndServe(":"+cfg.Server.Port, router); err != nil {
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryLoginAttemptStore keeps failures in process memory. It is meant for
+// tests and single-instance local runs.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	locks    map[string]time.Time
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		failures: make(map[string][]time.Time),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryLoginAttemptStore) AddFailure(key string, at time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures := append(s.prune(key, at, window), at)
+	s.failures[key] = failures
+	return len(failures), nil
+}
+
+func (s *MemoryLoginAttemptStore) Failures(key string, now time.Time, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures := s.prune(key, now, window)
+	if len(failures) == 0 {
+		return 0, time.Time{}, nil
+	}
+	return len(failures), failures[len(failures)-1], nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = time.Now().Add(duration)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) LockedFor(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	remaining := time.Until(s.locks[key])
+	if remaining <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	delete(s.locks, key)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) prune(key string, now time.Time, window time.Duration) []time.Time {
+	failures := s.failures[key]
+	start := 0
+	for start < len(failures) && !failures[start].After(now.Add(-window)) {
+		start++
+	}
+	failures = failures[start:]
+	if len(failures) == 0 {
+		delete(s.failures, key)
+	} else {
+		s.failures[key] = failures
+	}
+	return failures
+}
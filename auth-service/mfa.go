@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication already enabled")
+	ErrTOTPNotEnrolled     = errors.New("two-factor authentication not enrolled")
+	ErrInvalidMFACode      = errors.New("invalid code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired mfa challenge")
+)
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAChallenge is returned by login instead of tokens when the user has two
+// factor authentication enabled.
+type MFAChallenge struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+type MFALogin struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// UserMFA is the second factor data kept by user-service.
+type UserMFA struct {
+	TOTPSecret  string `json:"totp_secret"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+}
+
+// EnrollTOTP creates a new secret. It only takes effect once confirmed with a
+// code, so enrolling again before that simply replaces the secret.
+func (s *AuthService) EnrollTOTP(claims *Claims) (*TOTPEnrollment, error) {
+	mfa, err := s.getMFA(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if mfa != nil && mfa.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("error creating totp secret")
+	}
+
+	status, err := s.userService.Do(http.MethodPut, "/internal/users/"+claims.Subject+"/mfa/totp",
+		map[string]string{"totp_secret": secret}, nil)
+	if status == http.StatusConflict {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totpURI(s.mfa.Issuer, claims.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two factor authentication with the first code from the
+// authenticator app and hands out the recovery codes.
+func (s *AuthService) ConfirmTOTP(claims *Claims, code MFACode) (*RecoveryCodes, error) {
+	mfa, err := s.getMFA(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if mfa.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	if err := s.verifyTOTP(claims.Subject, mfa, code.Code); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.userService.Do(http.MethodPut, "/internal/users/"+claims.Subject+"/mfa/totp/enabled", nil, nil); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(claims.Subject)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not. It asks
+// for a current code so a stolen access token alone cannot do it.
+func (s *AuthService) RegenerateRecoveryCodes(claims *Claims, code MFACode) (*RecoveryCodes, error) {
+	mfa, err := s.getMFA(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil || !mfa.TOTPEnabled {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	if err := s.verifyTOTP(claims.Subject, mfa, code.Code); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(claims.Subject)
+}
+
+// CompleteMFALogin exchanges a login challenge and a TOTP or recovery code
+// for tokens.
+func (s *AuthService) CompleteMFALogin(login MFALogin, client ClientInfo, w http.ResponseWriter) (*Tokens, error) {
+	user, err := s.CheckSecondFactor(login, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startSession(user, client, w)
+}
+
+// CheckSecondFactor checks the code for a login challenge without starting a
+// session. A challenge can only be tried once, a wrong code means logging in
+// with the password again.
+func (s *AuthService) CheckSecondFactor(login MFALogin, client ClientInfo) (*User, error) {
+	challenge, err := s.mfaChallenges.Consume(hashOpaqueToken(login.ChallengeToken))
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	if err := s.loginGuard.Check(challenge.Email, client.IP); err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUserByEmail(challenge.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.getMFA(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil || !mfa.TOTPEnabled {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	if len(login.Code) == totpDigits {
+		err = s.verifyTOTP(user.ID, mfa, login.Code)
+	} else {
+		err = s.useRecoveryCode(user.ID, login.Code)
+	}
+	if errors.Is(err, ErrInvalidMFACode) {
+		s.loginGuard.Fail(user.Email, client.IP, "invalid second factor code")
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.loginGuard.Succeed(user.Email)
+
+	return user, nil
+}
+
+func (s *AuthService) createMFAChallenge(user *User) (*MFAChallenge, error) {
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("error creating mfa challenge")
+	}
+
+	challenge := OneTimeToken{UserID: user.ID, Email: user.Email}
+	if err := s.mfaChallenges.Save(tokenHash, challenge, s.mfa.ChallengeTTL); err != nil {
+		return nil, fmt.Errorf("error saving mfa challenge")
+	}
+
+	return &MFAChallenge{
+		MFARequired:    true,
+		ChallengeToken: token,
+		ExpiresIn:      int(s.mfa.ChallengeTTL.Seconds()),
+	}, nil
+}
+
+func (s *AuthService) verifyTOTP(userId string, mfa *UserMFA, code string) error {
+	step, ok := validateTOTP(mfa.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	fresh, err := s.mfaRepository.UseTOTPStep(userId, step, time.Duration(2*totpSkew+1)*totpPeriod*time.Second)
+	if err != nil {
+		return fmt.Errorf("error checking totp code")
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *AuthService) useRecoveryCode(userId string, code string) error {
+	status, err := s.userService.Do(http.MethodPost, "/internal/users/"+userId+"/mfa/recovery-codes/consume",
+		map[string]string{"code_hash": hashRecoveryCode(code)}, nil)
+	if status == http.StatusNotFound {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+func (s *AuthService) replaceRecoveryCodes(userId string) (*RecoveryCodes, error) {
+	codes, hashes, err := newRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("error creating recovery codes")
+	}
+
+	_, err = s.userService.Do(http.MethodPut, "/internal/users/"+userId+"/mfa/recovery-codes",
+		map[string][]string{"code_hashes": hashes}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// getMFA returns nil when the user never enrolled.
+func (s *AuthService) getMFA(userId string) (*UserMFA, error) {
+	var mfa UserMFA
+	status, err := s.userService.Do(http.MethodGet, "/internal/users/"+userId+"/mfa", nil, &mfa)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const totpUsedPrefix = "totp-used:"
+
+// IMFARepository remembers which TOTP steps a user has already logged in with,
+// because RFC 6238 forbids accepting the same code twice.
+type IMFARepository interface {
+	UseTOTPStep(string, int64, time.Duration) (bool, error)
+}
+
+type RedisMFARepository struct {
+	client *redis.Client
+}
+
+func NewRedisMFARepository(client *redis.Client) *RedisMFARepository {
+	return &RedisMFARepository{client: client}
+}
+
+func (r *RedisMFARepository) UseTOTPStep(userId string, step int64, expiration time.Duration) (bool, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%s:%d", totpUsedPrefix, userId, step)
+	return r.client.SetNX(ctx, key, "1", expiration).Result()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notification is a message for a user, such as a password reset link.
+type Notification struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type INotifier interface {
+	Notify(Notification) error
+}
+
+// NewNotifier picks the notifier named in the config. Only local development
+// notifiers exist so far, a real mail or SMS sender plugs in here.
+func NewNotifier(cfg NotifierConfig) (INotifier, error) {
+	switch cfg.Type {
+	case "", "log":
+		return NewLogNotifier(), nil
+	case "file":
+		return NewFileNotifier(cfg.File), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+	}
+}
+
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Notify(notification Notification) error {
+	log.Printf("Notification to %s: %s\n%s", notification.To, notification.Subject, notification.Body)
+	return nil
+}
+
+// FileNotifier appends every notification to a file, which is handy for
+// picking up links locally without a mail server.
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening notification file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "--- %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().UTC().Format(time.RFC3339), notification.To, notification.Subject, notification.Body)
+	if err != nil {
+		return fmt.Errorf("error writing notification: %w", err)
+	}
+	return nil
+}
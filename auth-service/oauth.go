@@ -0,0 +1,206 @@
+package main
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// dummySecretHash is compared against when the client id is unknown, so the
+// response time does not reveal which clients exist.
+var dummySecretHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-client-secret"), bcrypt.DefaultCost)
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Introspection is a token introspection response as defined in RFC 7662.
+// Inactive tokens only report active as false.
+type Introspection struct {
+	Active        bool     `json:"active"`
+	Scope         string   `json:"scope,omitempty"`
+	ClientID      string   `json:"client_id,omitempty"`
+	Username      string   `json:"username,omitempty"`
+	TokenType     string   `json:"token_type,omitempty"`
+	Exp           int64    `json:"exp,omitempty"`
+	Iat           int64    `json:"iat,omitempty"`
+	Sub           string   `json:"sub,omitempty"`
+	Aud           string   `json:"aud,omitempty"`
+	Iss           string   `json:"iss,omitempty"`
+	Jti           string   `json:"jti,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	SessionID     string   `json:"sid,omitempty"`
+}
+
+// OAuthError is an error response as defined in RFC 6749 section 5.2.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(status int, code string, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description, Status: status}
+}
+
+type IOAuthService interface {
+	AuthenticateClient(string, string) (*OAuthClient, error)
+	ClientCredentials(*OAuthClient, string) (*OAuthTokenResponse, error)
+	Authorize(AuthorizationParams) (string, error)
+	GetAuthorization(string) (*AuthorizationStatus, error)
+	LoginAuthorization(string, LoginCredentials, ClientInfo) (*AuthorizationStatus, *MFAChallenge, error)
+	LoginAuthorizationMFA(string, MFALogin, ClientInfo) (*AuthorizationStatus, error)
+	ConsentAuthorization(string, bool) (*AuthorizationStatus, error)
+	ExchangeCode(*OAuthClient, string, string, string, ClientInfo) (*OAuthTokenResponse, error)
+	RefreshToken(*OAuthClient, string, ClientInfo) (*OAuthTokenResponse, error)
+	Introspect(*OAuthClient, string) (*Introspection, error)
+	Revoke(*OAuthClient, string) error
+	UserInfo(string) (map[string]interface{}, error)
+	GetConsents(*Claims) ([]Consent, error)
+	RevokeConsent(*Claims, string) error
+}
+
+type OAuthService struct {
+	clients     IOAuthClientRepository
+	oidc        IOIDCRepository
+	authService IAuthService
+	jwtService  IJWTService
+	userService IUserServiceClient
+	cfg         OAuthConfig
+	oidcCfg     OIDCConfig
+}
+
+func NewOAuthService(clients IOAuthClientRepository, oidc IOIDCRepository, authService IAuthService,
+	jwtService IJWTService, userService IUserServiceClient, cfg OAuthConfig, oidcCfg OIDCConfig) *OAuthService {
+	return &OAuthService{
+		clients:     clients,
+		oidc:        oidc,
+		authService: authService,
+		jwtService:  jwtService,
+		userService: userService,
+		cfg:         cfg,
+		oidcCfg:     oidcCfg,
+	}
+}
+
+// AuthenticateClient checks the secret of a confidential client. Public
+// clients only identify themselves and must not send a secret.
+func (s *OAuthService) AuthenticateClient(clientId string, clientSecret string) (*OAuthClient, error) {
+	client, err := s.clients.FindById(clientId)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummySecretHash, []byte(clientSecret))
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+	if client.Public {
+		if clientSecret != "" {
+			return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		}
+		return client, nil
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)); err != nil {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+// ClientCredentials issues a service token for the requested scopes, or for
+// every scope the client is allowed when none are requested.
+func (s *OAuthService) ClientCredentials(client *OAuthClient, scope string) (*OAuthTokenResponse, error) {
+	if !client.AllowsGrant("client_credentials") {
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "client may not use this grant type")
+	}
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, requested := range scopes {
+		if !client.AllowsScope(requested) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "scope "+requested+" is not allowed for this client")
+		}
+	}
+
+	token, _, err := s.jwtService.CreateServiceToken(client.ID, scopes, s.cfg.ServiceTokenTTL)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error creating access token")
+	}
+
+	return &OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.cfg.ServiceTokenTTL / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// Introspect tells a confidential client whether a token is active, and if
+// so what it was issued for.
+func (s *OAuthService) Introspect(client *OAuthClient, token string) (*Introspection, error) {
+	if client.Public {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "public clients cannot introspect tokens")
+	}
+	if token == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	info, err := s.authService.InspectToken(token)
+	if err != nil {
+		return &Introspection{Active: false}, nil
+	}
+
+	claims := info.Claims
+	introspection := &Introspection{
+		Active:        true,
+		Scope:         claims.Scope,
+		ClientID:      info.ClientID(),
+		Username:      claims.Email,
+		Exp:           claims.ExpiresAt,
+		Iat:           claims.IssuedAt,
+		Sub:           claims.Subject,
+		Aud:           claims.Audience,
+		Iss:           claims.Issuer,
+		Jti:           claims.Id,
+		EmailVerified: claims.EmailVerified,
+		Roles:         claims.Roles,
+		Permissions:   claims.Permissions,
+		SessionID:     claims.SessionID,
+	}
+	if info.Type == accessTokenType {
+		introspection.TokenType = "Bearer"
+	}
+	return introspection, nil
+}
+
+// Revoke revokes an access or refresh token issued to the client, following
+// RFC 7009. Tokens that are invalid or no longer active are ignored, as the
+// outcome for the client is the same.
+func (s *OAuthService) Revoke(client *OAuthClient, token string) error {
+	if token == "" {
+		return newOAuthError(http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	info, err := s.authService.InspectToken(token)
+	if err != nil {
+		return nil
+	}
+	if info.ClientID() != client.ID {
+		return newOAuthError(http.StatusBadRequest, "unauthorized_client", "token was not issued to this client")
+	}
+
+	if err := s.authService.RevokeInspectedToken(info); err != nil {
+		return newOAuthError(http.StatusServiceUnavailable, "temporarily_unavailable", "error revoking token")
+	}
+	return nil
+}
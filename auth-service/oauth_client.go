@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrOAuthClientNotFound = errors.New("oauth client not found")
+
+// OAuthClient is a registered OAuth client. Only the bcrypt hash of its
+// secret is kept.
+type OAuthClient struct {
+	ID           string
+	Name         string
+	SecretHash   string
+	Public       bool
+	GrantTypes   []string
+	Scopes       []string
+	RedirectURIs []string
+	SkipConsent  bool
+}
+
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	return contains(c.GrantTypes, grantType)
+}
+
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	return contains(c.Scopes, scope)
+}
+
+// AllowsRedirectURI only accepts exact matches of a registered URI.
+func (c *OAuthClient) AllowsRedirectURI(redirectURI string) bool {
+	return contains(c.RedirectURIs, redirectURI)
+}
+
+type IOAuthClientRepository interface {
+	FindById(string) (*OAuthClient, error)
+}
+
+// ConfigOAuthClientRepository serves the clients registered in the
+// application config.
+type ConfigOAuthClientRepository struct {
+	clients map[string]*OAuthClient
+}
+
+func NewConfigOAuthClientRepository(cfg []OAuthClientConfig) (*ConfigOAuthClientRepository, error) {
+	r := &ConfigOAuthClientRepository{clients: make(map[string]*OAuthClient, len(cfg))}
+	for _, c := range cfg {
+		if c.ID == "" {
+			return nil, fmt.Errorf("oauth client needs an id")
+		}
+		if c.Public == (c.SecretHash != "") {
+			return nil, fmt.Errorf("oauth client %q needs a secret hash unless it is public", c.ID)
+		}
+		if _, ok := r.clients[c.ID]; ok {
+			return nil, fmt.Errorf("duplicate oauth client %q", c.ID)
+		}
+		client := &OAuthClient{
+			ID:           c.ID,
+			Name:         c.Name,
+			SecretHash:   c.SecretHash,
+			Public:       c.Public,
+			GrantTypes:   c.GrantTypes,
+			Scopes:       c.Scopes,
+			RedirectURIs: c.RedirectURIs,
+			SkipConsent:  c.SkipConsent,
+		}
+		if client.Public && client.AllowsGrant("client_credentials") {
+			return nil, fmt.Errorf("public oauth client %q cannot use client_credentials", c.ID)
+		}
+		if client.AllowsGrant("authorization_code") && len(client.RedirectURIs) == 0 {
+			return nil, fmt.Errorf("oauth client %q needs a redirect uri", c.ID)
+		}
+		r.clients[c.ID] = client
+	}
+	return r, nil
+}
+
+func (r *ConfigOAuthClientRepository) FindById(id string) (*OAuthClient, error) {
+	client, ok := r.clients[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrOAuthClientNotFound, id)
+	}
+	return client, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type OAuthController struct {
+	oauthService IOAuthService
+	authService  IAuthService
+	clients      *ClientInfoResolver
+}
+
+type ConsentDecision struct {
+	Approve bool `json:"approve"`
+}
+
+func NewOAuthController(oauthService IOAuthService, authService IAuthService, clients *ClientInfoResolver) *OAuthController {
+	return &OAuthController{
+		oauthService: oauthService,
+		authService:  authService,
+		clients:      clients,
+	}
+}
+
+func (c *OAuthController) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	location, err := c.oauthService.Authorize(AuthorizationParams{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	})
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+func (c *OAuthController) getAuthorization(w http.ResponseWriter, r *http.Request) {
+	status, err := c.oauthService.GetAuthorization(mux.Vars(r)["request"])
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, status)
+}
+
+func (c *OAuthController) loginAuthorization(w http.ResponseWriter, r *http.Request) {
+	var creds LoginCredentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		c.writeError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "invalid request payload"))
+		return
+	}
+
+	status, challenge, err := c.oauthService.LoginAuthorization(mux.Vars(r)["request"], creds, c.clients.ClientInfo(r))
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	if challenge != nil {
+		c.writeJSON(w, http.StatusOK, challenge)
+		return
+	}
+	c.writeJSON(w, http.StatusOK, status)
+}
+
+func (c *OAuthController) loginAuthorizationMFA(w http.ResponseWriter, r *http.Request) {
+	var login MFALogin
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil || login.ChallengeToken == "" || login.Code == "" {
+		c.writeError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "invalid request payload"))
+		return
+	}
+
+	status, err := c.oauthService.LoginAuthorizationMFA(mux.Vars(r)["request"], login, c.clients.ClientInfo(r))
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, status)
+}
+
+func (c *OAuthController) consentAuthorization(w http.ResponseWriter, r *http.Request) {
+	var decision ConsentDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		c.writeError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "invalid request payload"))
+		return
+	}
+
+	status, err := c.oauthService.ConsentAuthorization(mux.Vars(r)["request"], decision.Approve)
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, status)
+}
+
+func (c *OAuthController) token(w http.ResponseWriter, r *http.Request) {
+	client, ok := c.parseClientRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var response *OAuthTokenResponse
+	var err error
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "client_credentials":
+		response, err = c.oauthService.ClientCredentials(client, r.PostForm.Get("scope"))
+	case "authorization_code":
+		response, err = c.oauthService.ExchangeCode(client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"), c.clients.ClientInfo(r))
+	case "refresh_token":
+		response, err = c.oauthService.RefreshToken(client, r.PostForm.Get("refresh_token"), c.clients.ClientInfo(r))
+	case "":
+		err = newOAuthError(http.StatusBadRequest, "invalid_request", "grant_type is required")
+	default:
+		err = newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant type "+grantType+" is not supported")
+	}
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, response)
+}
+
+// introspect and revoke accept a token_type_hint but do not need it, as the
+// token type is found out from the token itself.
+func (c *OAuthController) introspect(w http.ResponseWriter, r *http.Request) {
+	client, ok := c.parseClientRequest(w, r)
+	if !ok {
+		return
+	}
+
+	introspection, err := c.oauthService.Introspect(client, r.PostForm.Get("token"))
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, introspection)
+}
+
+func (c *OAuthController) revoke(w http.ResponseWriter, r *http.Request) {
+	client, ok := c.parseClientRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.oauthService.Revoke(client, r.PostForm.Get("token")); err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *OAuthController) parseClientRequest(w http.ResponseWriter, r *http.Request) (*OAuthClient, bool) {
+	if err := r.ParseForm(); err != nil {
+		c.writeError(w, newOAuthError(http.StatusBadRequest, "invalid_request", "invalid form body"))
+		return nil, false
+	}
+
+	client, err := c.authenticateClient(r)
+	if err != nil {
+		c.writeError(w, err)
+		return nil, false
+	}
+	return client, true
+}
+
+func (c *OAuthController) userInfo(w http.ResponseWriter, r *http.Request) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		c.writeJSON(w, http.StatusUnauthorized, newOAuthError(http.StatusUnauthorized, "invalid_token", "bearer token is required"))
+		return
+	}
+
+	info, err := c.oauthService.UserInfo(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Status != http.StatusInternalServerError {
+			w.Header().Set("WWW-Authenticate", `Bearer error="`+oauthErr.Code+`"`)
+		}
+		c.writeError(w, err)
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, info)
+}
+
+func (c *OAuthController) getConsents(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	consents, err := c.oauthService.GetConsents(claims)
+	if err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, consents)
+}
+
+func (c *OAuthController) revokeConsent(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := c.oauthService.RevokeConsent(claims, mux.Vars(r)["client_id"]); err != nil {
+		c.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *OAuthController) authenticate(r *http.Request) (*Claims, error) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, errors.New("Missing or invalid Authorization header")
+	}
+	claims, err := c.authService.Authenticate(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return nil, err
+	}
+	// Tokens granted to a client do not manage the user's consents.
+	if claims.Audience != "" {
+		return nil, errors.New("tokens granted to a client are not accepted")
+	}
+	return claims, nil
+}
+
+// authenticateClient accepts the client credentials either as HTTP Basic
+// authentication or as client_id and client_secret form parameters.
+func (c *OAuthController) authenticateClient(r *http.Request) (*OAuthClient, error) {
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientId == "" {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication is required")
+	}
+	return c.oauthService.AuthenticateClient(clientId, clientSecret)
+}
+
+// writeError writes an OAuth error response. Failed logins during an
+// authorization request are reported as access_denied, and throttled ones
+// with a Retry-After header.
+func (c *OAuthController) writeError(w http.ResponseWriter, err error) {
+	var oauthErr *OAuthError
+	var retryAfter *RetryAfterError
+	switch {
+	case errors.As(err, &oauthErr):
+	case errors.As(err, &retryAfter):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.RetryAfter.Seconds()))))
+		oauthErr = newOAuthError(http.StatusTooManyRequests, "access_denied", err.Error())
+	default:
+		c.writeJSON(w, http.StatusUnauthorized, newOAuthError(http.StatusUnauthorized, "access_denied", err.Error()))
+		return
+	}
+	if oauthErr.Code == "invalid_client" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.writeJSON(w, oauthErr.Status, oauthErr)
+}
+
+func (c *OAuthController) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (c *OAuthController) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/oauth/authorize", c.authorize).Methods("GET")
+	router.HandleFunc("/oauth/authorize/{request}", c.getAuthorization).Methods("GET")
+	router.HandleFunc("/oauth/authorize/{request}/login", c.loginAuthorization).Methods("POST")
+	router.HandleFunc("/oauth/authorize/{request}/login/mfa", c.loginAuthorizationMFA).Methods("POST")
+	router.HandleFunc("/oauth/authorize/{request}/consent", c.consentAuthorization).Methods("POST")
+	router.HandleFunc("/oauth/token", c.token).Methods("POST")
+	router.HandleFunc("/oauth/introspect", c.introspect).Methods("POST")
+	router.HandleFunc("/oauth/revoke", c.revoke).Methods("POST")
+	router.HandleFunc("/oauth/consents", c.getConsents).Methods("GET")
+	router.HandleFunc("/oauth/consents/{client_id}", c.revokeConsent).Methods("DELETE")
+	router.HandleFunc("/userinfo", c.userInfo).Methods("GET", "POST")
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scopes the OpenID Connect endpoints understand. A client can only request
+// the ones it is registered with.
+var oidcScopes = []string{"openid", "email", "profile"}
+
+// AuthorizationParams are the query parameters of an authorization request.
+// Only the code flow with an S256 PKCE challenge is supported.
+type AuthorizationParams struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizationStatus tells the login page what a pending authorization
+// request needs next. Once RedirectTo is set the browser is sent back to the
+// client with it.
+type AuthorizationStatus struct {
+	ClientID        string `json:"client_id"`
+	ClientName      string `json:"client_name,omitempty"`
+	Scope           string `json:"scope"`
+	LoginRequired   bool   `json:"login_required"`
+	ConsentRequired bool   `json:"consent_required"`
+	RedirectTo      string `json:"redirect_to,omitempty"`
+}
+
+type Consent struct {
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name,omitempty"`
+	Scope      string `json:"scope"`
+}
+
+// Authorize validates an authorization request and returns where to send the
+// browser: the login page with the pending request, or back to the client
+// with an error. Requests naming an unknown client or an unregistered
+// redirect URI are answered directly, as redirecting them would be unsafe.
+func (s *OAuthService) Authorize(params AuthorizationParams) (string, error) {
+	client, err := s.clients.FindById(params.ClientID)
+	if err != nil {
+		return "", newOAuthError(http.StatusBadRequest, "invalid_request", "unknown client")
+	}
+	redirectURI := params.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.AllowsRedirectURI(redirectURI) {
+		return "", newOAuthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	fail := func(code string, description string) (string, error) {
+		return withQuery(redirectURI, url.Values{"error": {code}, "error_description": {description}, "state": {params.State}}), nil
+	}
+	if params.ResponseType != "code" {
+		return fail("unsupported_response_type", "only the code response type is supported")
+	}
+	if !client.AllowsGrant("authorization_code") {
+		return fail("unauthorized_client", "client may not use the authorization code flow")
+	}
+	scopes := strings.Fields(params.Scope)
+	if !contains(scopes, "openid") {
+		return fail("invalid_scope", "the openid scope is required")
+	}
+	for _, scope := range scopes {
+		if !contains(oidcScopes, scope) || !client.AllowsScope(scope) {
+			return fail("invalid_scope", "scope "+scope+" is not allowed for this client")
+		}
+	}
+	if params.CodeChallenge == "" || params.CodeChallengeMethod != "S256" {
+		return fail("invalid_request", "a S256 code_challenge is required")
+	}
+
+	requestId, requestHash, err := newOpaqueToken()
+	if err != nil {
+		return fail("server_error", "error creating authorization request")
+	}
+	request := AuthorizationRequest{
+		ID:            requestHash,
+		ClientID:      client.ID,
+		RedirectURI:   redirectURI,
+		Scope:         strings.Join(scopes, " "),
+		State:         params.State,
+		Nonce:         params.Nonce,
+		CodeChallenge: params.CodeChallenge,
+	}
+	if err := s.oidc.SaveRequest(request, s.oidcCfg.RequestTTL); err != nil {
+		return fail("server_error", "error saving authorization request")
+	}
+
+	return withQuery(s.oidcCfg.LoginURL, url.Values{"request": {requestId}}), nil
+}
+
+func (s *OAuthService) GetAuthorization(requestId string) (*AuthorizationStatus, error) {
+	request, client, err := s.findRequest(requestId)
+	if err != nil {
+		return nil, err
+	}
+	return s.status(request, client), nil
+}
+
+// LoginAuthorization checks the user's password for a pending request. Users
+// with two factor authentication get an MFAChallenge to complete with
+// LoginAuthorizationMFA first.
+func (s *OAuthService) LoginAuthorization(requestId string, creds LoginCredentials, client ClientInfo) (*AuthorizationStatus, *MFAChallenge, error) {
+	request, oauthClient, err := s.findRequest(requestId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, challenge, err := s.authService.CheckCredentials(creds, client)
+	if err != nil || challenge != nil {
+		return nil, challenge, err
+	}
+
+	status, err := s.authenticated(request, oauthClient, user)
+	return status, nil, err
+}
+
+func (s *OAuthService) LoginAuthorizationMFA(requestId string, login MFALogin, client ClientInfo) (*AuthorizationStatus, error) {
+	request, oauthClient, err := s.findRequest(requestId)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.authService.CheckSecondFactor(login, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authenticated(request, oauthClient, user)
+}
+
+// ConsentAuthorization records the user's answer for a request that needed
+// consent. Either way the request ends and the browser goes back to the
+// client, with a code or with access_denied.
+func (s *OAuthService) ConsentAuthorization(requestId string, approve bool) (*AuthorizationStatus, error) {
+	request, client, err := s.findRequest(requestId)
+	if err != nil {
+		return nil, err
+	}
+	if request.UserID == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "login is required first")
+	}
+
+	if !approve {
+		s.oidc.DeleteRequest(request.ID)
+		status := s.status(request, client)
+		status.ConsentRequired = false
+		status.RedirectTo = withQuery(request.RedirectURI, url.Values{
+			"error": {"access_denied"}, "error_description": {"the user denied the request"}, "state": {request.State}})
+		return status, nil
+	}
+
+	if err := s.oidc.SaveConsent(request.UserID, client.ID, request.Scope); err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error saving consent")
+	}
+	return s.issueCode(request, client)
+}
+
+// ExchangeCode redeems an authorization code for a session granted to the
+// client, returning its tokens together with an ID token.
+func (s *OAuthService) ExchangeCode(client *OAuthClient, code string, redirectURI string, codeVerifier string, clientInfo ClientInfo) (*OAuthTokenResponse, error) {
+	if !client.AllowsGrant("authorization_code") {
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "client may not use this grant type")
+	}
+	if code == "" || codeVerifier == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+	}
+
+	request, err := s.oidc.ConsumeCode(hashOpaqueToken(code))
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+	}
+	if request.ClientID != client.ID || request.RedirectURI != redirectURI || !verifyCodeChallenge(codeVerifier, request.CodeChallenge) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+	}
+
+	user, err := s.getUser(request.Email)
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "user no longer exists")
+	}
+
+	tokens, err := s.authService.StartClientSession(user, client.ID, request.Scope, clientInfo)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error starting session")
+	}
+
+	idToken, err := s.createIDToken(user, client.ID, request)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error creating id token")
+	}
+
+	return &OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL / time.Second),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      idToken,
+		Scope:        request.Scope,
+	}, nil
+}
+
+// RefreshToken rotates a refresh token issued to the client. No new ID token
+// is issued.
+func (s *OAuthService) RefreshToken(client *OAuthClient, refreshToken string, clientInfo ClientInfo) (*OAuthTokenResponse, error) {
+	if !client.AllowsGrant("refresh_token") {
+		return nil, newOAuthError(http.StatusBadRequest, "unauthorized_client", "client may not use this grant type")
+	}
+	if refreshToken == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+
+	tokens, session, err := s.authService.RefreshClientSession(refreshToken, client.ID, clientInfo)
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+	}
+
+	return &OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL / time.Second),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        session.Scope,
+	}, nil
+}
+
+// UserInfo returns the claims about the user the access token was granted
+// for, limited to the scopes it carries.
+func (s *OAuthService) UserInfo(accessToken string) (map[string]interface{}, error) {
+	claims, err := s.authService.Authenticate(accessToken)
+	if err != nil {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_token", err.Error())
+	}
+	if !claims.HasScope("openid") {
+		return nil, newOAuthError(http.StatusForbidden, "insufficient_scope", "the openid scope is required")
+	}
+
+	user, err := s.getUser(claims.Email)
+	if err != nil {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_token", "user no longer exists")
+	}
+
+	info := map[string]interface{}{"sub": user.ID}
+	if claims.HasScope("email") {
+		info["email"] = user.Email
+		info["email_verified"] = user.EmailVerified
+	}
+	if claims.HasScope("profile") {
+		info["name"] = user.Name
+	}
+	return info, nil
+}
+
+func (s *OAuthService) GetConsents(claims *Claims) ([]Consent, error) {
+	stored, err := s.oidc.GetConsents(claims.Subject)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error fetching consents")
+	}
+
+	consents := []Consent{}
+	for clientId, scope := range stored {
+		consent := Consent{ClientID: clientId, Scope: scope}
+		if client, err := s.clients.FindById(clientId); err == nil {
+			consent.ClientName = client.Name
+		}
+		consents = append(consents, consent)
+	}
+	sort.Slice(consents, func(i, j int) bool { return consents[i].ClientID < consents[j].ClientID })
+	return consents, nil
+}
+
+// RevokeConsent makes the client ask for consent again on the next login.
+// Sessions already granted to it are not ended.
+func (s *OAuthService) RevokeConsent(claims *Claims, clientId string) error {
+	if err := s.oidc.DeleteConsent(claims.Subject, clientId); err != nil {
+		return newOAuthError(http.StatusInternalServerError, "server_error", "error revoking consent")
+	}
+	return nil
+}
+
+func (s *OAuthService) findRequest(requestId string) (*AuthorizationRequest, *OAuthClient, error) {
+	request, err := s.oidc.FindRequest(hashOpaqueToken(requestId))
+	if errors.Is(err, ErrAuthorizationRequestNotFound) {
+		return nil, nil, newOAuthError(http.StatusNotFound, "invalid_request", "authorization request not found or expired")
+	}
+	if err != nil {
+		return nil, nil, newOAuthError(http.StatusInternalServerError, "server_error", "error fetching authorization request")
+	}
+
+	client, err := s.clients.FindById(request.ClientID)
+	if err != nil {
+		return nil, nil, newOAuthError(http.StatusBadRequest, "invalid_request", "unknown client")
+	}
+	return request, client, nil
+}
+
+// authenticated attaches the logged in user to the request and issues the
+// code right away when the user already consented to every requested scope.
+func (s *OAuthService) authenticated(request *AuthorizationRequest, client *OAuthClient, user *User) (*AuthorizationStatus, error) {
+	request.UserID = user.ID
+	request.Email = user.Email
+	request.AuthTime = time.Now().UTC()
+
+	if client.SkipConsent {
+		return s.issueCode(request, client)
+	}
+	consents, err := s.oidc.GetConsents(user.ID)
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error fetching consents")
+	}
+	if covers(strings.Fields(consents[client.ID]), strings.Fields(request.Scope)) {
+		return s.issueCode(request, client)
+	}
+
+	if err := s.oidc.SaveRequest(*request, s.oidcCfg.RequestTTL); err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error saving authorization request")
+	}
+	return s.status(request, client), nil
+}
+
+func (s *OAuthService) issueCode(request *AuthorizationRequest, client *OAuthClient) (*AuthorizationStatus, error) {
+	code, codeHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error creating authorization code")
+	}
+	if err := s.oidc.SaveCode(codeHash, *request, s.oidcCfg.CodeTTL); err != nil {
+		return nil, newOAuthError(http.StatusInternalServerError, "server_error", "error saving authorization code")
+	}
+	s.oidc.DeleteRequest(request.ID)
+
+	status := s.status(request, client)
+	status.ConsentRequired = false
+	status.RedirectTo = withQuery(request.RedirectURI, url.Values{"code": {code}, "state": {request.State}})
+	return status, nil
+}
+
+func (s *OAuthService) status(request *AuthorizationRequest, client *OAuthClient) *AuthorizationStatus {
+	return &AuthorizationStatus{
+		ClientID:        client.ID,
+		ClientName:      client.Name,
+		Scope:           request.Scope,
+		LoginRequired:   request.UserID == "",
+		ConsentRequired: request.UserID != "",
+	}
+}
+
+func (s *OAuthService) createIDToken(user *User, clientId string, request *AuthorizationRequest) (string, error) {
+	scopes := strings.Fields(request.Scope)
+	claims := IDTokenClaims{
+		Nonce:    request.Nonce,
+		AuthTime: request.AuthTime.Unix(),
+	}
+	claims.Subject = user.ID
+	claims.Audience = clientId
+	if contains(scopes, "email") {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.EmailVerified
+	}
+	if contains(scopes, "profile") {
+		claims.Name = user.Name
+	}
+	return s.jwtService.CreateIDToken(claims, s.oidcCfg.IDTokenTTL)
+}
+
+func (s *OAuthService) getUser(email string) (*User, error) {
+	var user User
+	if _, err := s.userService.Do(http.MethodGet, "/users/email/"+url.PathEscape(email), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against its S256 challenge.
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func covers(granted []string, requested []string) bool {
+	for _, scope := range requested {
+		if !contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// withQuery adds parameters to a URL, leaving out empty ones.
+func withQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
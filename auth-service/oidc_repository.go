@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	authorizationRequestPrefix = "oidc-request:"
+	authorizationCodePrefix    = "oidc-code:"
+	consentPrefix              = "oidc-consent:"
+)
+
+var ErrAuthorizationRequestNotFound = errors.New("authorization request not found")
+
+// AuthorizationRequest is a validated request to the authorization endpoint.
+// The user is filled in once they logged in, and the same data is stored
+// under the hash of the authorization code issued for it.
+type AuthorizationRequest struct {
+	ID            string    `json:"id"`
+	ClientID      string    `json:"client_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	State         string    `json:"state,omitempty"`
+	Nonce         string    `json:"nonce,omitempty"`
+	CodeChallenge string    `json:"code_challenge"`
+	UserID        string    `json:"user_id,omitempty"`
+	Email         string    `json:"email,omitempty"`
+	AuthTime      time.Time `json:"auth_time,omitempty"`
+}
+
+type IOIDCRepository interface {
+	SaveRequest(AuthorizationRequest, time.Duration) error
+	FindRequest(string) (*AuthorizationRequest, error)
+	DeleteRequest(string) error
+	SaveCode(string, AuthorizationRequest, time.Duration) error
+	ConsumeCode(string) (*AuthorizationRequest, error)
+	GetConsents(string) (map[string]string, error)
+	SaveConsent(string, string, string) error
+	DeleteConsent(string, string) error
+}
+
+// RedisOIDCRepository keeps pending authorization requests and codes with a
+// TTL, and the scopes each user consented to per client in a hash.
+type RedisOIDCRepository struct {
+	client *redis.Client
+}
+
+func NewRedisOIDCRepository(client *redis.Client) *RedisOIDCRepository {
+	return &RedisOIDCRepository{client: client}
+}
+
+func (r *RedisOIDCRepository) SaveRequest(request AuthorizationRequest, expiration time.Duration) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(context.Background(), authorizationRequestPrefix+request.ID, data, expiration).Err()
+}
+
+func (r *RedisOIDCRepository) FindRequest(id string) (*AuthorizationRequest, error) {
+	data, err := r.client.Get(context.Background(), authorizationRequestPrefix+id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAuthorizationRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var request AuthorizationRequest
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *RedisOIDCRepository) DeleteRequest(id string) error {
+	return r.client.Del(context.Background(), authorizationRequestPrefix+id).Err()
+}
+
+func (r *RedisOIDCRepository) SaveCode(codeHash string, request AuthorizationRequest, expiration time.Duration) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(context.Background(), authorizationCodePrefix+codeHash, data, expiration).Err()
+}
+
+// ConsumeCode returns the request a code was issued for and deletes it in
+// one step, so a code can only be exchanged once.
+func (r *RedisOIDCRepository) ConsumeCode(codeHash string) (*AuthorizationRequest, error) {
+	data, err := r.client.GetDel(context.Background(), authorizationCodePrefix+codeHash).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var request AuthorizationRequest
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetConsents maps client ids to the space separated scopes the user
+// consented to.
+func (r *RedisOIDCRepository) GetConsents(userId string) (map[string]string, error) {
+	return r.client.HGetAll(context.Background(), consentPrefix+userId).Result()
+}
+
+func (r *RedisOIDCRepository) SaveConsent(userId string, clientId string, scope string) error {
+	return r.client.HSet(context.Background(), consentPrefix+userId, clientId, scope).Err()
+}
+
+func (r *RedisOIDCRepository) DeleteConsent(userId string, clientId string) error {
+	return r.client.HDel(context.Background(), consentPrefix+userId, clientId).Err()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// savedRequests keeps the authorization requests Authorize saves. Other
+// repository methods are not used by these tests.
+type savedRequests struct {
+	IOIDCRepository
+	requests []AuthorizationRequest
+}
+
+func (r *savedRequests) SaveRequest(request AuthorizationRequest, _ time.Duration) error {
+	r.requests = append(r.requests, request)
+	return nil
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// The example from RFC 7636, appendix B.
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"matching verifier", verifier, challenge, true},
+		{"other verifier", verifier + "x", challenge, false},
+		{"plain challenge", verifier, verifier, false},
+		{"padded challenge", verifier, challenge + "=", false},
+		{"empty verifier", "", challenge, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCodeChallenge(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("verifyCodeChallenge() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequiresPKCE(t *testing.T) {
+	clients, err := NewConfigOAuthClientRepository([]OAuthClientConfig{{
+		ID:           "web",
+		Public:       true,
+		GrantTypes:   []string{"authorization_code"},
+		Scopes:       []string{"openid", "email"},
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		wantError string
+	}{
+		{"S256 challenge", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", ""},
+		{"plain challenge", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", "plain", "invalid_request"},
+		{"no method", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "", "invalid_request"},
+		{"no challenge", "", "S256", "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oidc := &savedRequests{}
+			s := NewOAuthService(clients, oidc, nil, nil, nil, OAuthConfig{},
+				OIDCConfig{LoginURL: "https://app.example.com/login"})
+
+			location, err := s.Authorize(AuthorizationParams{
+				ResponseType:        "code",
+				ClientID:            "web",
+				Scope:               "openid email",
+				State:               "xyz",
+				CodeChallenge:       tt.challenge,
+				CodeChallengeMethod: tt.method,
+			})
+			if err != nil {
+				t.Fatalf("Authorize() = %v", err)
+			}
+			redirect, err := url.Parse(location)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := redirect.Query().Get("error"); got != tt.wantError {
+				t.Errorf("error = %q, want %q (redirect %s)", got, tt.wantError, location)
+			}
+			if saved := len(oidc.requests) == 1; saved != (tt.wantError == "") {
+				t.Errorf("request saved %t, want %t", saved, tt.wantError == "")
+			}
+			if tt.wantError == "" && oidc.requests[0].CodeChallenge != tt.challenge {
+				t.Errorf("saved challenge %q, want %q", oidc.requests[0].CodeChallenge, tt.challenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	passwordResetPurpose     = "password-reset"
+	emailVerificationPurpose = "email-verification"
+	mfaChallengePurpose      = "mfa-challenge"
+)
+
+// OneTimeToken is what a token sent to a user, such as a password reset or
+// email verification link, stands for. It is stored under the hash of the
+// token, never the token itself.
+type OneTimeToken struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+type IOneTimeTokenRepository interface {
+	Save(string, OneTimeToken, time.Duration) error
+	Consume(string) (*OneTimeToken, error)
+	Throttle(string, time.Duration) (time.Duration, error)
+}
+
+// RedisOneTimeTokenRepository keeps the tokens of one purpose, which is used
+// as the key prefix.
+type RedisOneTimeTokenRepository struct {
+	client  *redis.Client
+	purpose string
+}
+
+func NewRedisOneTimeTokenRepository(client *redis.Client, purpose string) *RedisOneTimeTokenRepository {
+	return &RedisOneTimeTokenRepository{client: client, purpose: purpose}
+}
+
+// Save stores a token under its hash and drops the user's previous token, so
+// only the most recently sent link works.
+func (r *RedisOneTimeTokenRepository) Save(tokenHash string, token OneTimeToken, expiration time.Duration) error {
+	ctx := context.Background()
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	indexKey := r.userKey(token.Email)
+	previous, err := r.client.Get(ctx, indexKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if previous != "" {
+			pipe.Del(ctx, r.tokenKey(previous))
+		}
+		pipe.Set(ctx, r.tokenKey(tokenHash), data, expiration)
+		pipe.Set(ctx, indexKey, tokenHash, expiration)
+		return nil
+	})
+	return err
+}
+
+// Consume returns the token and deletes it in one step, so a token can only
+// be used once even when it is presented concurrently.
+func (r *RedisOneTimeTokenRepository) Consume(tokenHash string) (*OneTimeToken, error) {
+	ctx := context.Background()
+	data, err := r.client.GetDel(ctx, r.tokenKey(tokenHash)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var token OneTimeToken
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return nil, err
+	}
+	r.client.Del(ctx, r.userKey(token.Email))
+	return &token, nil
+}
+
+// Throttle allows one send per interval for an email. It returns how long the
+// caller has to wait, or zero when sending is allowed.
+func (r *RedisOneTimeTokenRepository) Throttle(email string, interval time.Duration) (time.Duration, error) {
+	ctx := context.Background()
+	key := r.purpose + "-throttle:" + email
+
+	ok, err := r.client.SetNX(ctx, key, "1", interval).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return 0, nil
+	}
+
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		ttl = interval
+	}
+	return ttl, nil
+}
+
+func (r *RedisOneTimeTokenRepository) tokenKey(tokenHash string) string {
+	return r.purpose + ":" + tokenHash
+}
+
+func (r *RedisOneTimeTokenRepository) userKey(email string) string {
+	return "user-" + r.purpose + ":" + email
+}
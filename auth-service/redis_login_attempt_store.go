@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+const (
+	loginFailuresPrefix = "login-failures:"
+	loginLockPrefix     = "login-lock:"
+)
+
+// RedisLoginAttemptStore keeps one sorted set of failure timestamps per key,
+// so every auth-service instance sees the same window.
+type RedisLoginAttemptStore struct {
+	client *redis.Client
+}
+
+func NewRedisLoginAttemptStore(client *redis.Client) *RedisLoginAttemptStore {
+	return &RedisLoginAttemptStore{client: client}
+}
+
+func (s *RedisLoginAttemptStore) AddFailure(key string, at time.Time, window time.Duration) (int, error) {
+	ctx := context.Background()
+	setKey := loginFailuresPrefix + key
+
+	var count *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, setKey, "-inf", formatScore(at.Add(-window)))
+		pipe.ZAdd(ctx, setKey, redis.Z{Score: float64(at.UnixMilli()), Member: uuid.New().String()})
+		count = pipe.ZCard(ctx, setKey)
+		pipe.Expire(ctx, setKey, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(count.Val()), nil
+}
+
+func (s *RedisLoginAttemptStore) Failures(key string, now time.Time, window time.Duration) (int, time.Time, error) {
+	ctx := context.Background()
+	setKey := loginFailuresPrefix + key
+
+	var count *redis.IntCmd
+	var last *redis.ZSliceCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, setKey, "-inf", formatScore(now.Add(-window)))
+		count = pipe.ZCard(ctx, setKey)
+		last = pipe.ZRangeWithScores(ctx, setKey, -1, -1)
+		return nil
+	})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var lastAt time.Time
+	if members := last.Val(); len(members) > 0 {
+		lastAt = time.UnixMilli(int64(members[0].Score))
+	}
+	return int(count.Val()), lastAt, nil
+}
+
+func (s *RedisLoginAttemptStore) Lock(key string, duration time.Duration) error {
+	ctx := context.Background()
+	return s.client.Set(ctx, loginLockPrefix+key, "1", duration).Err()
+}
+
+func (s *RedisLoginAttemptStore) LockedFor(key string) (time.Duration, error) {
+	ctx := context.Background()
+	ttl, err := s.client.PTTL(ctx, loginLockPrefix+key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisLoginAttemptStore) Reset(key string) error {
+	ctx := context.Background()
+	return s.client.Del(ctx, loginFailuresPrefix+key, loginLockPrefix+key).Err()
+}
+
+// formatScore is the inclusive upper bound of failures to remove, so a
+// failure exactly one window old has left the window, as in
+// MemoryLoginAttemptStore.
+func formatScore(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
@@ -6,14 +6,30 @@ import (
 	"time"
 )
 
+const (
+	refreshTokenPrefix  = "refresh:"
+	usedTokenPrefix     = "refresh-used:"
+	refreshFamilyPrefix = "refresh-family:"
+)
+
+// RefreshToken is what is stored for every live refresh token. All tokens
+// created by rotating the one issued at login share a FamilyID.
+type RefreshToken struct {
+	Email    string `redis:"email"`
+	FamilyID string `redis:"family"`
+}
+
 type RedisRepository struct {
 	client *redis.Client
 }
 
 type IRedisRepository interface {
-	SetToken(string, string, time.Duration) error
-	GetToken(string) (string, error)
+	SetToken(string, RefreshToken, time.Duration) error
+	GetToken(string) (*RefreshToken, error)
+	ConsumeToken(string, time.Duration) (*RefreshToken, error)
+	GetUsedToken(string) (string, error)
 	DeleteToken(string)
+	RevokeFamily(string) error
 	Close()
 }
 
@@ -21,19 +37,91 @@ func NewRedisRepository(client *redis.Client) *RedisRepository {
 	return &RedisRepository{client: client}
 }
 
-func (c *RedisRepository) SetToken(token, email string, expiration time.Duration) error {
+func (c *RedisRepository) SetToken(token string, refreshToken RefreshToken, expiration time.Duration) error {
 	ctx := context.Background()
-	return c.client.Set(ctx, token, email, expiration).Err()
+	familyKey := refreshFamilyPrefix + refreshToken.FamilyID
+
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, refreshTokenPrefix+token, refreshToken)
+		pipe.Expire(ctx, refreshTokenPrefix+token, expiration)
+		pipe.SAdd(ctx, familyKey, token)
+		pipe.Expire(ctx, familyKey, expiration)
+		return nil
+	})
+	return err
 }
 
-func (c *RedisRepository) GetToken(token string) (string, error) {
+func (c *RedisRepository) GetToken(token string) (*RefreshToken, error) {
+	ctx := context.Background()
+	var refreshToken RefreshToken
+	result := c.client.HGetAll(ctx, refreshTokenPrefix+token)
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+	if len(result.Val()) == 0 {
+		return nil, redis.Nil
+	}
+	if err := result.Scan(&refreshToken); err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
+
+// consumeTokenScript removes a live refresh token and remembers it as used in
+// one step, so that two concurrent refreshes with the same token cannot both
+// succeed.
+var consumeTokenScript = redis.NewScript(`
+local data = redis.call('HMGET', KEYS[1], 'email', 'family')
+if not data[1] then
+	return false
+end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], data[2], 'EX', ARGV[2])
+redis.call('SREM', ARGV[3] .. data[2], ARGV[1])
+return data
+`)
+
+func (c *RedisRepository) ConsumeToken(token string, usedExpiration time.Duration) (*RefreshToken, error) {
 	ctx := context.Background()
-	return c.client.Get(ctx, token).Result()
+	keys := []string{refreshTokenPrefix + token, usedTokenPrefix + token}
+	values, err := consumeTokenScript.Run(ctx, c.client, keys, token, int(usedExpiration.Seconds()), refreshFamilyPrefix).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshToken{Email: values[0], FamilyID: values[1]}, nil
+}
+
+// GetUsedToken returns the family of a refresh token that was already rotated.
+func (c *RedisRepository) GetUsedToken(token string) (string, error) {
+	ctx := context.Background()
+	return c.client.Get(ctx, usedTokenPrefix+token).Result()
 }
 
 func (c *RedisRepository) DeleteToken(token string) {
 	ctx := context.Background()
-	c.client.Del(ctx, token)
+	refreshToken, err := c.GetToken(token)
+	if err == nil {
+		c.client.SRem(ctx, refreshFamilyPrefix+refreshToken.FamilyID, token)
+	}
+	c.client.Del(ctx, refreshTokenPrefix+token)
+}
+
+// RevokeFamily deletes every live refresh token of the family.
+func (c *RedisRepository) RevokeFamily(familyId string) error {
+	ctx := context.Background()
+	familyKey := refreshFamilyPrefix + familyId
+
+	tokens, err := c.client.SMembers(ctx, familyKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(tokens)+1)
+	for _, token := range tokens {
+		keys = append(keys, refreshTokenPrefix+token)
+	}
+	keys = append(keys, familyKey)
+	return c.client.Del(ctx, keys...).Err()
 }
 
 func (c *RedisRepository) Close() {
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+const revokedTokenPrefix = "revoked-jti:"
+
+// IRevocationStore remembers revoked token ids (jti) until the tokens would
+// have expired anyway.
+type IRevocationStore interface {
+	Revoke(string, time.Duration) error
+	IsRevoked(string) (bool, error)
+}
+
+type RedisRevocationStore struct {
+	client *redis.Client
+}
+
+func NewRedisRevocationStore(client *redis.Client) *RedisRevocationStore {
+	return &RedisRevocationStore{client: client}
+}
+
+func (s *RedisRevocationStore) Revoke(jti string, expiration time.Duration) error {
+	ctx := context.Background()
+	return s.client.Set(ctx, revokedTokenPrefix+jti, "1", expiration).Err()
+}
+
+func (s *RedisRevocationStore) IsRevoked(jti string) (bool, error) {
+	ctx := context.Background()
+	n, err := s.client.Exists(ctx, revokedTokenPrefix+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// MemoryRevocationStore keeps revoked ids in process memory. It is meant for
+// tests and single-instance local runs.
+type MemoryRevocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{revoked: make(map[string]time.Time)}
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, expiresAt := range s.revoked {
+		if now.After(expiresAt) {
+			delete(s.revoked, id)
+		}
+	}
+	s.revoked[jti] = now.Add(expiration)
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.revoked[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"time"
+)
+
+const (
+	RefreshTokenReuseEvent = "refresh_token_reuse"
+	PasswordResetEvent     = "password_reset"
+	LoginFailedEvent       = "login_failed"
+	LoginLockedEvent       = "login_locked"
+	LoginBlockedEvent      = "login_blocked"
+)
+
+type SecurityEvent struct {
+	Type     string    `json:"type"`
+	Email    string    `json:"email,omitempty"`
+	IP       string    `json:"ip,omitempty"`
+	FamilyID string    `json:"family_id,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+type ISecurityEventPublisher interface {
+	Publish(SecurityEvent)
+}
+
+// RedisSecurityEventPublisher logs security events and appends them to a
+// Redis stream for monitoring and alerting consumers.
+type RedisSecurityEventPublisher struct {
+	client *redis.Client
+	stream string
+}
+
+func NewRedisSecurityEventPublisher(client *redis.Client, stream string) *RedisSecurityEventPublisher {
+	return &RedisSecurityEventPublisher{
+		client: client,
+		stream: stream,
+	}
+}
+
+func (p *RedisSecurityEventPublisher) Publish(event SecurityEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Could not marshal security event: %v", err)
+		return
+	}
+	log.Printf("Security event: %s", data)
+
+	ctx := context.Background()
+	err = p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		Values: map[string]interface{}{
+			"type":  event.Type,
+			"event": string(data),
+		},
+	}).Err()
+	if err != nil {
+		log.Printf("Could not publish security event: %v", err)
+	}
+}
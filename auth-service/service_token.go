@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ServiceTokenSource hands out a service token auth-service issues to
+// itself for calls to other services. The token is reused until shortly
+// before it expires.
+type ServiceTokenSource struct {
+	jwtService IJWTService
+	clientId   string
+	scopes     []string
+	ttl        time.Duration
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewServiceTokenSource(jwtService IJWTService, clientId string, scopes []string, ttl time.Duration) *ServiceTokenSource {
+	return &ServiceTokenSource{
+		jwtService: jwtService,
+		clientId:   clientId,
+		scopes:     scopes,
+		ttl:        ttl,
+	}
+}
+
+func (s *ServiceTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expiresAt) > s.ttl/4 {
+		return s.token, nil
+	}
+
+	token, claims, err := s.jwtService.CreateServiceToken(s.clientId, s.scopes, s.ttl)
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	s.expiresAt = time.Unix(claims.ExpiresAt, 0)
+	return s.token, nil
+}
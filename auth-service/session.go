@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Session is one logged in device. Its id is the family id shared by every
+// refresh token rotated from the same login, and access tokens carry it in
+// the sid claim. The jti of the latest access token is kept so it can be
+// revoked when the session ends. Sessions started through the OpenID Connect
+// flow belong to the client they were granted to and carry its scope.
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Email       string    `json:"email"`
+	ClientID    string    `json:"client_id,omitempty"`
+	Scope       string    `json:"scope,omitempty"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	AccessToken *TokenRef `json:"access_token,omitempty"`
+	Current     bool      `json:"current"`
+}
+
+type TokenRef struct {
+	ID        string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// ClientInfoResolver works out which client a request came from. The
+// X-Forwarded-For header is only believed when the request was sent by one of
+// the trusted proxies, such as the gateway, and then only up to the first
+// address that is not itself a trusted proxy: everything left of it was
+// supplied by the client and may be forged.
+type ClientInfoResolver struct {
+	trustedProxies []*net.IPNet
+}
+
+// NewClientInfoResolver accepts proxy addresses as plain IPs or CIDR ranges.
+func NewClientInfoResolver(trustedProxies []string) (*ClientInfoResolver, error) {
+	resolver := &ClientInfoResolver{}
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			resolver.trustedProxies = append(resolver.trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range %q: %w", proxy, err)
+		}
+		resolver.trustedProxies = append(resolver.trustedProxies, network)
+	}
+	return resolver, nil
+}
+
+func (c *ClientInfoResolver) ClientInfo(r *http.Request) ClientInfo {
+	return ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        c.IP(r),
+	}
+}
+
+func (c *ClientInfoResolver) IP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !c.trusted(ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !c.trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func (c *ClientInfoResolver) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range c.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
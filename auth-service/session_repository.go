@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	sessionPrefix      = "session:"
+	userSessionsPrefix = "user-sessions:"
+)
+
+type ISessionRepository interface {
+	Save(Session) error
+	FindById(string) (*Session, error)
+	FindAllByEmail(string) ([]Session, error)
+	Delete(Session) error
+}
+
+// RedisSessionRepository stores every session as JSON under its own key, which
+// expires with the session, and indexes session ids per user in a set.
+type RedisSessionRepository struct {
+	client *redis.Client
+}
+
+func NewRedisSessionRepository(client *redis.Client) *RedisSessionRepository {
+	return &RedisSessionRepository{client: client}
+}
+
+func (r *RedisSessionRepository) Save(session Session) error {
+	ctx := context.Background()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	expiration := time.Until(session.ExpiresAt)
+	indexKey := userSessionsPrefix + session.Email
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionPrefix+session.ID, data, expiration)
+		pipe.SAdd(ctx, indexKey, session.ID)
+		pipe.Expire(ctx, indexKey, refreshTokenTTL)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisSessionRepository) FindById(id string) (*Session, error) {
+	ctx := context.Background()
+	data, err := r.client.Get(ctx, sessionPrefix+id).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindAllByEmail also prunes ids of sessions that expired from the index.
+func (r *RedisSessionRepository) FindAllByEmail(email string) ([]Session, error) {
+	ctx := context.Background()
+	indexKey := userSessionsPrefix + email
+
+	ids, err := r.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, id := range ids {
+		session, err := r.FindById(id)
+		if err == redis.Nil {
+			r.client.SRem(ctx, indexKey, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+func (r *RedisSessionRepository) Delete(session Session) error {
+	ctx := context.Background()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionPrefix+session.ID)
+		pipe.SRem(ctx, userSessionsPrefix+session.Email, session.ID)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientInfoResolverIP(t *testing.T) {
+	resolver, err := NewClientInfoResolver([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"direct client forging the header", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"through the gateway", "10.0.0.1:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"through a trusted range", "192.168.4.2:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"through an IPv6 proxy", "[::1]:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"forged entries left of the client", "10.0.0.1:4000", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"chain of trusted proxies", "10.0.0.1:4000", []string{"203.0.113.7, 192.168.1.1"}, "203.0.113.7"},
+		{"several headers", "10.0.0.1:4000", []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+		{"only trusted hops", "10.0.0.1:4000", []string{"192.168.1.1"}, "192.168.1.1"},
+		{"garbage entry", "10.0.0.1:4000", []string{"203.0.113.7, unknown"}, "10.0.0.1"},
+		{"proxy without the header", "10.0.0.1:4000", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, forwarded := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+
+			if got := resolver.ClientInfo(r).IP; got != tt.want {
+				t.Errorf("IP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientInfoResolverInvalid(t *testing.T) {
+	for _, proxy := range []string{"gateway", "10.0.0.0/33", ""} {
+		if _, err := NewClientInfoResolver([]string{proxy}); err == nil {
+			t.Errorf("NewClientInfoResolver(%q) accepted an invalid address", proxy)
+		}
+	}
+}
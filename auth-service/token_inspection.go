@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+const (
+	accessTokenType  = "access_token"
+	refreshTokenType = "refresh_token"
+)
+
+var ErrInactiveToken = errors.New("token is not active")
+
+// TokenInfo describes a token auth-service issued that is still active.
+// Session is nil for service tokens.
+type TokenInfo struct {
+	Type    string
+	Claims  *Claims
+	Session *Session
+}
+
+// ClientID returns the OAuth client the token was issued to, or an empty
+// string for tokens of auth-service's own login.
+func (t *TokenInfo) ClientID() string {
+	if t.Session != nil {
+		return t.Session.ClientID
+	}
+	return t.Claims.ClientID
+}
+
+// InspectToken finds out whether a token is an active refresh token or an
+// active access token. A refresh token is opaque and recognised by being
+// stored, and its claims are taken from its session. An access token is
+// active while it is the latest one issued for its session.
+func (s *AuthService) InspectToken(token string) (*TokenInfo, error) {
+	if refreshToken, err := s.redisRepository.GetToken(token); err == nil {
+		session, err := s.sessionRepository.FindById(refreshToken.FamilyID)
+		if err != nil {
+			return nil, ErrInactiveToken
+		}
+		return &TokenInfo{Type: refreshTokenType, Claims: sessionClaims(session), Session: session}, nil
+	}
+
+	claims, err := s.jwtService.VerifyToken(token)
+	if err != nil {
+		return nil, ErrInactiveToken
+	}
+	if claims.ClientID != "" {
+		return &TokenInfo{Type: accessTokenType, Claims: claims}, nil
+	}
+
+	session, err := s.sessionRepository.FindById(claims.SessionID)
+	if err != nil || session.AccessToken == nil || session.AccessToken.ID != claims.Id {
+		return nil, ErrInactiveToken
+	}
+	return &TokenInfo{Type: accessTokenType, Claims: claims, Session: session}, nil
+}
+
+// sessionClaims describes a refresh token by the session it belongs to.
+func sessionClaims(session *Session) *Claims {
+	return &Claims{
+		Email:     session.Email,
+		SessionID: session.ID,
+		Scope:     session.Scope,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  session.ClientID,
+			Subject:   session.UserID,
+			IssuedAt:  session.LastUsedAt.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+		},
+	}
+}
+
+// RevokeInspectedToken revokes an access token on its own. Revoking a
+// refresh token ends its session, which revokes the session's access token
+// as well.
+func (s *AuthService) RevokeInspectedToken(info *TokenInfo) error {
+	if info.Type == refreshTokenType {
+		return s.endSession(*info.Session)
+	}
+	if err := s.jwtService.Revoke(info.Claims.Id, time.Unix(info.Claims.ExpiresAt, 0)); err != nil {
+		return fmt.Errorf("error revoking access token")
+	}
+	return nil
+}
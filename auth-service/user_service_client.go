@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// User service scopes auth-service grants itself. users.credentials covers
+// password hashes and second factor data.
+var userServiceScopes = []string{"users.read", "users.write", "users.credentials"}
+
+type IUserServiceClient interface {
+	Do(string, string, interface{}, interface{}) (int, error)
+}
+
+// UserServiceClient calls user-service with a service token.
+type UserServiceClient struct {
+	baseURL string
+	tokens  *ServiceTokenSource
+	client  *http.Client
+}
+
+func NewUserServiceClient(baseURL string, tokens *ServiceTokenSource) *UserServiceClient {
+	return &UserServiceClient{
+		baseURL: baseURL,
+		tokens:  tokens,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Do sends an optional JSON body to user-service and decodes an optional JSON
+// response. The status code is returned even on error so callers can map it.
+func (c *UserServiceClient) Do(method string, path string, body interface{}, out interface{}) (int, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(jsonData)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("user-service request failed: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token, err := c.tokens.Token()
+	if err != nil {
+		return 0, fmt.Errorf("error creating service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("user-service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("user-service %s %s returned %d", method, path, resp.StatusCode)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("error decoding response")
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+)
+
+type WellKnownController struct {
+	jwtService IJWTService
+	issuer     string
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+func NewWellKnownController(jwtService IJWTService, issuer string) *WellKnownController {
+	return &WellKnownController{
+		jwtService: jwtService,
+		issuer:     issuer,
+	}
+}
+
+func (c *WellKnownController) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(c.jwtService.JWKS())
+}
+
+func (c *WellKnownController) openIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	algorithms := []string{}
+	for _, key := range c.jwtService.JWKS().Keys {
+		if !contains(algorithms, key.Alg) {
+			algorithms = append(algorithms, key.Alg)
+		}
+	}
+	sort.Strings(algorithms)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(OpenIDConfiguration{
+		Issuer:                            c.issuer,
+		AuthorizationEndpoint:             c.issuer + "/oauth/authorize",
+		TokenEndpoint:                     c.issuer + "/oauth/token",
+		UserinfoEndpoint:                  c.issuer + "/userinfo",
+		JWKSURI:                           c.issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   oidcScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name"},
+	})
+}
+
+func (c *WellKnownController) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/.well-known/jwks.json", c.jwks).Methods("GET")
+	router.HandleFunc("/.well-known/openid-configuration", c.openIDConfiguration).Methods("GET")
+}
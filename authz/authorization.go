@@ -0,0 +1,132 @@
+package authz
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The identity headers describe the user of a request. Authenticate sets them
+// from the verified access token and removes any copy the caller sent, so
+// handlers can trust them whether or not the request came through the
+// gateway.
+const (
+	UserIdHeader            = "X-User-Id"
+	UserEmailHeader         = "X-User-Email"
+	UserEmailVerifiedHeader = "X-User-Email-Verified"
+	UserRolesHeader         = "X-User-Roles"
+	PermissionsHeader       = "X-User-Permissions"
+)
+
+var IdentityHeaders = []string{
+	UserIdHeader,
+	UserEmailHeader,
+	UserEmailVerifiedHeader,
+	UserRolesHeader,
+	PermissionsHeader,
+}
+
+// Authenticate sets the identity headers of requests that carry a valid user
+// access token. Other requests go on without an identity and are refused by
+// whatever requires one.
+func Authenticate(verifier *TokenVerifier) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, header := range IdentityHeaders {
+				r.Header.Del(header)
+			}
+
+			authHeader := r.Header.Get("Authorization")
+			if strings.HasPrefix(authHeader, "Bearer ") {
+				if claims, err := verifier.VerifyAccessToken(strings.TrimPrefix(authHeader, "Bearer ")); err == nil {
+					SetIdentityHeaders(r.Header, claims)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetIdentityHeaders describes the user of a verified access token in the
+// identity headers.
+func SetIdentityHeaders(header http.Header, claims *AccessClaims) {
+	header.Set(UserIdHeader, claims.Subject)
+	header.Set(UserEmailHeader, claims.Email)
+	header.Set(UserEmailVerifiedHeader, strconv.FormatBool(claims.EmailVerified))
+	header.Set(UserRolesHeader, strings.Join(claims.Roles, ","))
+	header.Set(PermissionsHeader, strings.Join(claims.Permissions, ","))
+}
+
+// RequirePermissions only lets requests through whose caller holds every one
+// of the given permissions.
+func RequirePermissions(permissions ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(UserIdHeader) == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				http.Error(w, "Missing or invalid access token", http.StatusUnauthorized)
+				return
+			}
+
+			granted := make(map[string]bool)
+			for _, p := range strings.Split(r.Header.Get(PermissionsHeader), ",") {
+				granted[strings.TrimSpace(p)] = true
+			}
+
+			for _, p := range permissions {
+				if !granted[p] {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSelfOrPermissions lets users through to their own {id}, and anyone
+// else only with every one of the given permissions.
+func RequireSelfOrPermissions(permissions ...string) mux.MiddlewareFunc {
+	requirePermissions := RequirePermissions(permissions...)
+	return func(next http.Handler) http.Handler {
+		checked := requirePermissions(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userId := r.Header.Get(UserIdHeader); userId != "" && userId == mux.Vars(r)["id"] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			checked.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScopes only lets requests through that carry a valid service token
+// granting every one of the given scopes.
+func RequireScopes(verifier *TokenVerifier, scopes ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				http.Error(w, "Missing service token", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := verifier.VerifyServiceToken(strings.TrimPrefix(authHeader, "Bearer "))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Invalid service token", http.StatusUnauthorized)
+				return
+			}
+			if !claims.HasScopes(scopes...) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package authz
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testIssuer = "http://localhost:8081"
+
+type revokedIds map[string]bool
+
+func (r revokedIds) IsRevoked(jti string) (bool, error) {
+	return r[jti], nil
+}
+
+// newTestVerifier serves the public half of a fresh RSA key as a JWKS and
+// returns a verifier for it together with the private key.
+func newTestVerifier(t *testing.T, revocations IRevocationList) (*TokenVerifier, *rsa.PrivateKey) {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := JWKSet{Keys: []JWK{{
+		Kty: "RSA",
+		Kid: "k1",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewTokenVerifier(NewJWKSKeySet(server.URL, time.Minute), testIssuer, revocations), privateKey
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testAccessClaims() *AccessClaims {
+	return &AccessClaims{
+		Email:       "a@example.com",
+		Permissions: []string{"orders:read"},
+		TokenType:   accessTokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        "jti-1",
+			Issuer:    testIssuer,
+			Subject:   "u1",
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	verifier, key := newTestVerifier(t, revokedIds{"revoked": true})
+
+	tests := []struct {
+		name        string
+		claims      func(*AccessClaims)
+		noToken     bool
+		wantUserId  string
+		wantGranted string
+	}{
+		{name: "access token", wantUserId: "u1", wantGranted: "orders:read"},
+		{name: "no token", noToken: true},
+		{name: "id token", claims: func(c *AccessClaims) { c.TokenType = "" }},
+		{name: "client token", claims: func(c *AccessClaims) { c.ClientID = "web" }},
+		{name: "token for another audience", claims: func(c *AccessClaims) { c.Audience = "web" }},
+		{name: "other issuer", claims: func(c *AccessClaims) { c.Issuer = "http://evil.example.com" }},
+		{name: "expired", claims: func(c *AccessClaims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() }},
+		{name: "revoked", claims: func(c *AccessClaims) { c.Id = "revoked" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			// A caller reaching the service directly must not be able to
+			// claim an identity through the headers.
+			r.Header.Set(UserIdHeader, "admin")
+			r.Header.Set(PermissionsHeader, "users:write")
+			if !tt.noToken {
+				claims := testAccessClaims()
+				if tt.claims != nil {
+					tt.claims(claims)
+				}
+				r.Header.Set("Authorization", "Bearer "+signTestToken(t, key, claims))
+			}
+
+			var seen http.Header
+			Authenticate(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = r.Header
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got := seen.Get(UserIdHeader); got != tt.wantUserId {
+				t.Errorf("%s = %q, want %q", UserIdHeader, got, tt.wantUserId)
+			}
+			if got := seen.Get(PermissionsHeader); got != tt.wantGranted {
+				t.Errorf("%s = %q, want %q", PermissionsHeader, got, tt.wantGranted)
+			}
+		})
+	}
+}
+
+func TestRequirePermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		userId      string
+		permissions string
+		want        int
+	}{
+		{"anonymous", "", "orders:read", http.StatusUnauthorized},
+		{"missing permission", "u1", "orders:read", http.StatusForbidden},
+		{"all permissions", "u1", "orders:read, orders:write", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/orders", nil)
+			r.Header.Set(UserIdHeader, tt.userId)
+			r.Header.Set(PermissionsHeader, tt.permissions)
+			w := httptest.NewRecorder()
+
+			RequirePermissions("orders:read", "orders:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
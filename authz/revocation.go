@@ -0,0 +1,35 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// revokedTokenPrefix matches the keys auth-service writes when it revokes an
+// access token.
+const revokedTokenPrefix = "revoked-jti:"
+
+// ErrRevocationUnavailable is returned when the revocation list cannot be
+// checked, so callers can answer with a 503 instead of a 401.
+var ErrRevocationUnavailable = errors.New("token revocation list unavailable")
+
+type IRevocationList interface {
+	IsRevoked(string) (bool, error)
+}
+
+type RedisRevocationList struct {
+	client *redis.Client
+}
+
+func NewRedisRevocationList(client *redis.Client) *RedisRevocationList {
+	return &RedisRevocationList{client: client}
+}
+
+func (l *RedisRevocationList) IsRevoked(jti string) (bool, error) {
+	n, err := l.client.Exists(context.Background(), revokedTokenPrefix+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,123 @@
+package authz
+
+import (
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"strings"
+)
+
+// accessTokenType is the typ claim auth-service gives access tokens, as
+// opposed to ID tokens signed with the same keys.
+const accessTokenType = "access"
+
+// AccessClaims are the claims of an access token auth-service issued to a
+// user.
+type AccessClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Roles         []string `json:"roles,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	ClientID      string   `json:"client_id,omitempty"`
+	TokenType     string   `json:"typ"`
+	jwt.StandardClaims
+}
+
+// ServiceClaims are the claims of a token auth-service issued to an OAuth
+// client through the client credentials grant.
+type ServiceClaims struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	jwt.StandardClaims
+}
+
+func (c *ServiceClaims) HasScopes(scopes ...string) bool {
+	granted := make(map[string]bool)
+	for _, s := range strings.Fields(c.Scope) {
+		granted[s] = true
+	}
+	for _, s := range scopes {
+		if !granted[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenVerifier checks tokens against the keys auth-service publishes. Access
+// tokens are also checked against the revocation list when there is one.
+type TokenVerifier struct {
+	keySet      *JWKSKeySet
+	issuer      string
+	revocations IRevocationList
+}
+
+func NewTokenVerifier(keySet *JWKSKeySet, issuer string, revocations IRevocationList) *TokenVerifier {
+	return &TokenVerifier{
+		keySet:      keySet,
+		issuer:      issuer,
+		revocations: revocations,
+	}
+}
+
+// VerifyAccessToken accepts only access tokens of users. Service tokens, ID
+// tokens and tokens granted to an OAuth client are refused.
+func (v *TokenVerifier) VerifyAccessToken(tokenStr string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	if err := v.parse(tokenStr, claims); err != nil {
+		return nil, err
+	}
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if claims.TokenType != accessTokenType || claims.ClientID != "" || claims.Audience != "" {
+		return nil, fmt.Errorf("not a user access token")
+	}
+
+	if v.revocations != nil {
+		revoked, err := v.revocations.IsRevoked(claims.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRevocationUnavailable, err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("token has been revoked")
+		}
+	}
+	return claims, nil
+}
+
+// VerifyServiceToken accepts only tokens issued to an OAuth client. Tokens
+// issued to users are refused.
+func (v *TokenVerifier) VerifyServiceToken(tokenStr string) (*ServiceClaims, error) {
+	claims := &ServiceClaims{}
+	if err := v.parse(tokenStr, claims); err != nil {
+		return nil, err
+	}
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if claims.ClientID == "" {
+		return nil, fmt.Errorf("not a service token")
+	}
+	return claims, nil
+}
+
+func (v *TokenVerifier) parse(tokenStr string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.keySet.key(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.alg {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.publicKey, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"time"
+)
+
+type Config struct {
+	ApplicationConfig
+}
+
+type ApplicationConfig struct {
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Reservation ReservationConfig `yaml:"reservation"`
+	Auth        AuthConfig        `yaml:"auth"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port"`
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+}
+
+// AuthConfig points catalog-service at the JWKS auth-service publishes, which
+// service tokens on the mutating endpoints are verified against.
+type AuthConfig struct {
+	JWKSURL         string        `yaml:"jwksUrl"`
+	Issuer          string        `yaml:"issuer"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+type ReservationConfig struct {
+	DefaultTTL     time.Duration `yaml:"defaultTtl"`
+	MaxTTL         time.Duration `yaml:"maxTtl"`
+	SweepInterval  time.Duration `yaml:"sweepInterval"`
+	SweepBatchSize int           `yaml:"sweepBatchSize"`
+}
+
+func NewConfiguration() *Config {
+	applicationConfig := &ApplicationConfig{}
+	applicationConfig.readApplicationConfig()
+
+	return &Config{ApplicationConfig: *applicationConfig}
+}
+
+func (c *ApplicationConfig) readApplicationConfig() {
+	env, found := os.LookupEnv("ACTIVE_PROFILE")
+
+	if !found {
+		env = "local"
+	}
+
+	print("ACTIVE_PROFILE: ", env, "\n")
+
+	v := viper.New()
+	v.SetTypeByDefaultValue(true)
+	v.SetConfigName("application")
+	v.SetConfigType("yaml")
+	v.AddConfigPath("./")
+
+	readConfigErr := v.ReadInConfig()
+	if readConfigErr != nil {
+		panic("Couldn't load application configuration, cannot start. Terminating. : " + readConfigErr.Error())
+	}
+
+	sub := v.Sub(env)
+
+	unMarshallErr := sub.Unmarshal(c)
+
+	if unMarshallErr != nil {
+		panic("Configuration cannot deserialize. Terminating. : " + unMarshallErr.Error())
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"authz"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// CatalogController serves products to anyone, but only lets callers with a
+// service token change them or reserve stock.
+type CatalogController struct {
+	productService     IProductService
+	reservationService IReservationService
+	serviceTokens      *authz.TokenVerifier
+}
+
+func NewCatalogController(productService IProductService, reservationService IReservationService,
+	serviceTokens *authz.TokenVerifier) *CatalogController {
+	return &CatalogController{
+		productService:     productService,
+		reservationService: reservationService,
+		serviceTokens:      serviceTokens,
+	}
+}
+
+func (c *CatalogController) createProduct(w http.ResponseWriter, r *http.Request) {
+	var product Product
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	created, err := c.productService.Create(product)
+	if err != nil {
+		c.handleError(w, err, "Error creating product")
+		return
+	}
+
+	c.writeJSON(w, http.StatusCreated, created)
+}
+
+func (c *CatalogController) getProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := c.productService.GetAll()
+	if err != nil {
+		c.handleError(w, err, "Error fetching products")
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, products)
+}
+
+func (c *CatalogController) getProduct(w http.ResponseWriter, r *http.Request) {
+	product, err := c.productService.GetBySku(mux.Vars(r)["sku"])
+	if err != nil {
+		c.handleError(w, err, "Error fetching product")
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, product)
+}
+
+func (c *CatalogController) restock(w http.ResponseWriter, r *http.Request) {
+	var restock Restock
+	if err := json.NewDecoder(r.Body).Decode(&restock); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	product, err := c.productService.Restock(mux.Vars(r)["sku"], restock.Quantity)
+	if err != nil {
+		c.handleError(w, err, "Error restocking product")
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, product)
+}
+
+func (c *CatalogController) reserve(w http.ResponseWriter, r *http.Request) {
+	var create CreateReservation
+	if err := json.NewDecoder(r.Body).Decode(&create); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	reservation, err := c.reservationService.Reserve(create)
+	if err != nil {
+		c.handleError(w, err, "Error reserving stock")
+		return
+	}
+
+	c.writeJSON(w, http.StatusCreated, reservation)
+}
+
+func (c *CatalogController) getReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, err := c.reservationService.GetById(mux.Vars(r)["id"])
+	if err != nil {
+		c.handleError(w, err, "Error fetching reservation")
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, reservation)
+}
+
+func (c *CatalogController) confirmReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, err := c.reservationService.Confirm(mux.Vars(r)["id"])
+	if err != nil {
+		c.handleError(w, err, "Error confirming reservation")
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, reservation)
+}
+
+func (c *CatalogController) releaseReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, err := c.reservationService.Release(mux.Vars(r)["id"])
+	if err != nil {
+		c.handleError(w, err, "Error releasing reservation")
+		return
+	}
+
+	c.writeJSON(w, http.StatusOK, reservation)
+}
+
+func (c *CatalogController) releaseOrderReservation(w http.ResponseWriter, r *http.Request) {
+	if err := c.reservationService.ReleaseByOrderId(mux.Vars(r)["orderId"]); err != nil {
+		c.handleError(w, err, "Error releasing reservation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *CatalogController) handleError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, ErrProductNotFound), errors.Is(err, ErrReservationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrProductExists), errors.Is(err, ErrInsufficientStock), errors.Is(err, ErrReservationNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+func (c *CatalogController) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (c *CatalogController) RegisterRoutes(r *mux.Router) {
+	write := authz.RequireScopes(c.serviceTokens, CatalogWriteScope)
+	reserve := authz.RequireScopes(c.serviceTokens, CatalogReserveScope)
+
+	r.Handle("/products", write(http.HandlerFunc(c.createProduct))).Methods("POST")
+	r.HandleFunc("/products", c.getProducts).Methods("GET")
+	r.HandleFunc("/products/{sku}", c.getProduct).Methods("GET")
+	r.Handle("/products/{sku}/restock", write(http.HandlerFunc(c.restock))).Methods("POST")
+	r.Handle("/reservations", reserve(http.HandlerFunc(c.reserve))).Methods("POST")
+	r.HandleFunc("/reservations/{id}", c.getReservation).Methods("GET")
+	r.Handle("/reservations/{id}/confirm", reserve(http.HandlerFunc(c.confirmReservation))).Methods("POST")
+	r.Handle("/reservations/{id}/release", reserve(http.HandlerFunc(c.releaseReservation))).Methods("POST")
+	r.Handle("/reservations/orders/{orderId}/release", reserve(http.HandlerFunc(c.releaseOrderReservation))).Methods("POST")
+}
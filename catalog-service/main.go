@@ -0,0 +1,37 @@
+package main
+
+import (
+	"authz"
+	"context"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+func main() {
+	cfg := NewConfiguration()
+
+	db, err := NewPostgresDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error initializing database: %v", err)
+	}
+
+	router := mux.NewRouter()
+
+	productRepository := NewPostgresProductRepository(db)
+	reservationRepository := NewPostgresReservationRepository(db)
+
+	sweeper := NewReservationSweeper(reservationRepository, cfg.Reservation)
+	sweeper.Start(context.Background())
+
+	productService := NewProductService(productRepository)
+	reservationService := NewReservationService(reservationRepository, cfg.Reservation)
+	serviceTokens := authz.NewTokenVerifier(authz.NewJWKSKeySet(cfg.Auth.JWKSURL, cfg.Auth.RefreshInterval), cfg.Auth.Issuer, nil)
+	catalogController := NewCatalogController(productService, reservationService, serviceTokens)
+	catalogController.RegisterRoutes(router)
+
+	log.Printf("Server is running on port %s", cfg.Server.Port)
+	if err := http.ListenAndServe(":"+cfg.Server.Port, router); err != nil {
+		log.Fatalf("Could not start server: %v\n", err)
+	}
+}
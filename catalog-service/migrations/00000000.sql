@@ -0,0 +1,29 @@
+CREATE TABLE products (
+                          sku VARCHAR(64) PRIMARY KEY,
+                          name VARCHAR(255) NOT NULL,
+                          price BIGINT NOT NULL CHECK (price >= 0),
+                          currency CHAR(3) NOT NULL,
+                          stock INT NOT NULL CHECK (stock >= 0),
+                          created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                          updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE reservations (
+                              id UUID PRIMARY KEY,
+                              order_id UUID NOT NULL,
+                              status VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'confirmed', 'released', 'expired')),
+                              expires_at TIMESTAMPTZ NOT NULL,
+                              created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                              updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- An order holds at most one live reservation.
+CREATE UNIQUE INDEX reservations_active_order_idx ON reservations (order_id) WHERE status IN ('pending', 'confirmed');
+CREATE INDEX reservations_expiry_idx ON reservations (expires_at) WHERE status = 'pending';
+
+CREATE TABLE reservation_items (
+                                   reservation_id UUID NOT NULL REFERENCES reservations (id) ON DELETE CASCADE,
+                                   sku VARCHAR(64) NOT NULL REFERENCES products (sku),
+                                   quantity INT NOT NULL CHECK (quantity > 0),
+                                   PRIMARY KEY (reservation_id, sku)
+);
\ No newline at end of file
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+type PostgresProductRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresProductRepository(db *sql.DB) *PostgresProductRepository {
+	return &PostgresProductRepository{db: db}
+}
+
+func (r *PostgresProductRepository) Save(product Product) error {
+	query := `INSERT INTO products (sku, name, price, currency, stock, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.Exec(query, product.SKU, product.Name, product.Price, product.Currency, product.Stock,
+		product.CreatedAt, product.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w: %s", ErrProductExists, product.SKU)
+		}
+		return fmt.Errorf("failed to save product: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresProductRepository) FindAll() ([]Product, error) {
+	query := `SELECT sku, name, price, currency, stock, created_at, updated_at FROM products ORDER BY sku`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find all products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		var product Product
+		if err := rows.Scan(&product.SKU, &product.Name, &product.Price, &product.Currency, &product.Stock,
+			&product.CreatedAt, &product.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, product)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *PostgresProductRepository) FindBySku(sku string) (Product, error) {
+	query := `SELECT sku, name, price, currency, stock, created_at, updated_at FROM products WHERE sku = $1`
+	row := r.db.QueryRow(query, sku)
+
+	var product Product
+	if err := row.Scan(&product.SKU, &product.Name, &product.Price, &product.Currency, &product.Stock,
+		&product.CreatedAt, &product.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return Product{}, fmt.Errorf("%w: %s", ErrProductNotFound, sku)
+		}
+		return Product{}, fmt.Errorf("failed to find product by sku: %w", err)
+	}
+
+	return product, nil
+}
+
+func (r *PostgresProductRepository) AddStock(sku string, quantity int) (Product, error) {
+	query := `UPDATE products SET stock = stock + $2, updated_at = now() WHERE sku = $1
+		RETURNING sku, name, price, currency, stock, created_at, updated_at`
+	row := r.db.QueryRow(query, sku, quantity)
+
+	var product Product
+	if err := row.Scan(&product.SKU, &product.Name, &product.Price, &product.Currency, &product.Stock,
+		&product.CreatedAt, &product.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return Product{}, fmt.Errorf("%w: %s", ErrProductNotFound, sku)
+		}
+		return Product{}, fmt.Errorf("failed to add stock: %w", err)
+	}
+
+	return product, nil
+}
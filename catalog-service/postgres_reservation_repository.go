@@ -0,0 +1,283 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"time"
+)
+
+type PostgresReservationRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresReservationRepository(db *sql.DB) *PostgresReservationRepository {
+	return &PostgresReservationRepository{db: db}
+}
+
+// Save never oversells: stock is taken with a conditional UPDATE that only
+// succeeds while enough units are left, and the CHECK (stock >= 0) constraint
+// backs it up. Items must be sorted by SKU so that concurrent reservations
+// lock product rows in the same order and cannot deadlock.
+func (r *PostgresReservationRepository) Save(reservation Reservation) (Reservation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO reservations (id, order_id, status, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (order_id) WHERE status IN ('pending', 'confirmed') DO NOTHING`
+	result, err := tx.Exec(query, reservation.ID, reservation.OrderID, reservation.Status, reservation.ExpiresAt,
+		reservation.CreatedAt, reservation.UpdatedAt)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("failed to save reservation: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		tx.Rollback()
+		return r.findActiveByOrderId(reservation.OrderID)
+	}
+
+	for _, item := range reservation.Items {
+		stockQuery := `UPDATE products SET stock = stock - $2, updated_at = now() WHERE sku = $1 AND stock >= $2`
+		result, err := tx.Exec(stockQuery, item.SKU, item.Quantity)
+		if err != nil {
+			return Reservation{}, fmt.Errorf("failed to reserve stock: %w", err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			var exists bool
+			if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM products WHERE sku = $1)`, item.SKU).Scan(&exists); err != nil {
+				return Reservation{}, fmt.Errorf("failed to find product: %w", err)
+			}
+			if !exists {
+				return Reservation{}, fmt.Errorf("%w: %s", ErrProductNotFound, item.SKU)
+			}
+			return Reservation{}, fmt.Errorf("%w: %s", ErrInsufficientStock, item.SKU)
+		}
+
+		itemQuery := `INSERT INTO reservation_items (reservation_id, sku, quantity) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(itemQuery, reservation.ID, item.SKU, item.Quantity); err != nil {
+			return Reservation{}, fmt.Errorf("failed to save reservation item: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Reservation{}, fmt.Errorf("failed to commit reservation: %w", err)
+	}
+	return reservation, nil
+}
+
+// FindById, Confirm, Release and ReleaseByOrderId report ids that are not
+// UUIDs as not found, rather than letting the uuid cast in Postgres fail.
+func (r *PostgresReservationRepository) FindById(id string) (Reservation, error) {
+	if !isUUID(id) {
+		return Reservation{}, fmt.Errorf("%w: %s", ErrReservationNotFound, id)
+	}
+	query := `SELECT id, order_id, status, expires_at, created_at, updated_at FROM reservations WHERE id = $1`
+	return r.findOne(query, id)
+}
+
+func (r *PostgresReservationRepository) findActiveByOrderId(orderId string) (Reservation, error) {
+	query := `SELECT id, order_id, status, expires_at, created_at, updated_at FROM reservations
+		WHERE order_id = $1 AND status IN ('pending', 'confirmed')`
+	return r.findOne(query, orderId)
+}
+
+func (r *PostgresReservationRepository) findOne(query string, arg string) (Reservation, error) {
+	var reservation Reservation
+	if err := r.db.QueryRow(query, arg).Scan(&reservation.ID, &reservation.OrderID, &reservation.Status,
+		&reservation.ExpiresAt, &reservation.CreatedAt, &reservation.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return Reservation{}, fmt.Errorf("%w: %s", ErrReservationNotFound, arg)
+		}
+		return Reservation{}, fmt.Errorf("failed to find reservation: %w", err)
+	}
+
+	items, err := r.findItems(reservation.ID)
+	if err != nil {
+		return Reservation{}, err
+	}
+	reservation.Items = items
+	return reservation, nil
+}
+
+func (r *PostgresReservationRepository) findItems(reservationId string) ([]ReservationItem, error) {
+	rows, err := r.db.Query(`SELECT sku, quantity FROM reservation_items WHERE reservation_id = $1 ORDER BY sku`, reservationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reservation items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []ReservationItem{}
+	for rows.Next() {
+		var item ReservationItem
+		if err := rows.Scan(&item.SKU, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan reservation item: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return items, nil
+}
+
+// Confirm only succeeds for pending reservations that have not expired yet.
+// Confirming an already confirmed reservation is a no-op.
+func (r *PostgresReservationRepository) Confirm(id string) error {
+	if !isUUID(id) {
+		return fmt.Errorf("%w: %s", ErrReservationNotFound, id)
+	}
+	query := `UPDATE reservations SET status = 'confirmed', updated_at = now()
+		WHERE id = $1 AND status = 'pending' AND expires_at > now()`
+	result, err := r.db.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("failed to confirm reservation: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+
+	reservation, err := r.FindById(id)
+	if err != nil {
+		return err
+	}
+	if reservation.Status == ReservationConfirmed {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %s", ErrReservationNotPending, id, reservation.Status)
+}
+
+// Release is idempotent: releasing a reservation that was already released or
+// expired does nothing, because only the transaction that flips the status
+// returns the stock.
+func (r *PostgresReservationRepository) Release(id string) error {
+	if !isUUID(id) {
+		return fmt.Errorf("%w: %s", ErrReservationNotFound, id)
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reservations SET status = 'released', updated_at = now()
+		WHERE id = $1 AND status IN ('pending', 'confirmed') RETURNING id`
+	ids, err := collectIds(tx.Query(query, id))
+	if err != nil {
+		return fmt.Errorf("failed to release reservation: %w", err)
+	}
+	if len(ids) == 0 {
+		if _, err := r.FindById(id); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if err := restoreStock(tx, ids); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit release: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresReservationRepository) ReleaseByOrderId(orderId string) error {
+	if !isUUID(orderId) {
+		return fmt.Errorf("%w: order %s", ErrReservationNotFound, orderId)
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reservations SET status = 'released', updated_at = now()
+		WHERE order_id = $1 AND status IN ('pending', 'confirmed') RETURNING id`
+	ids, err := collectIds(tx.Query(query, orderId))
+	if err != nil {
+		return fmt.Errorf("failed to release reservation: %w", err)
+	}
+
+	if err := restoreStock(tx, ids); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit release: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresReservationRepository) ExpireBefore(before time.Time, limit int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reservations SET status = 'expired', updated_at = now()
+		WHERE id IN (
+			SELECT id FROM reservations
+			WHERE status = 'pending' AND expires_at <= $1
+			ORDER BY expires_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id`
+	ids, err := collectIds(tx.Query(query, before, limit))
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire reservations: %w", err)
+	}
+
+	if err := restoreStock(tx, ids); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit expiry: %w", err)
+	}
+	return len(ids), nil
+}
+
+func restoreStock(tx *sql.Tx, reservationIds []string) error {
+	if len(reservationIds) == 0 {
+		return nil
+	}
+
+	query := `UPDATE products p SET stock = p.stock + s.quantity, updated_at = now()
+		FROM (
+			SELECT sku, SUM(quantity) AS quantity FROM reservation_items
+			WHERE reservation_id = ANY($1)
+			GROUP BY sku
+		) s
+		WHERE p.sku = s.sku`
+	if _, err := tx.Exec(query, pq.Array(reservationIds)); err != nil {
+		return fmt.Errorf("failed to restore stock: %w", err)
+	}
+	return nil
+}
+
+func collectIds(rows *sql.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func isUUID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil && len(id) == 36
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestIsUUID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"3f1c8f0e-6b2a-4c4b-9d5e-0a1b2c3d4e5f", true},
+		{"abc", false},
+		{"", false},
+		{"3f1c8f0e6b2a4c4b9d5e0a1b2c3d4e5f", false},
+		{"{3f1c8f0e-6b2a-4c4b-9d5e-0a1b2c3d4e5f}", false},
+		{"urn:uuid:3f1c8f0e-6b2a-4c4b-9d5e-0a1b2c3d4e5f", false},
+	}
+	for _, tt := range tests {
+		if got := isUUID(tt.id); got != tt.want {
+			t.Errorf("isUUID(%q) = %t, want %t", tt.id, got, tt.want)
+		}
+	}
+}
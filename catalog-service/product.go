@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrProductNotFound       = errors.New("product not found")
+	ErrProductExists         = errors.New("product already exists")
+	ErrInvalidRequest        = errors.New("invalid request")
+	ErrInsufficientStock     = errors.New("insufficient stock")
+	ErrReservationNotFound   = errors.New("reservation not found")
+	ErrReservationNotPending = errors.New("reservation is no longer pending")
+)
+
+// Prices are stored in minor units of the product currency.
+type Product struct {
+	SKU       string    `json:"sku"`
+	Name      string    `json:"name"`
+	Price     int64     `json:"price"`
+	Currency  string    `json:"currency"`
+	Stock     int       `json:"stock"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type IProductService interface {
+	Create(Product) (Product, error)
+	GetAll() ([]Product, error)
+	GetBySku(string) (Product, error)
+	Restock(string, int) (Product, error)
+}
+
+type Restock struct {
+	Quantity int `json:"quantity"`
+}
+
+type ReservationStatus string
+
+const (
+	ReservationPending   ReservationStatus = "pending"
+	ReservationConfirmed ReservationStatus = "confirmed"
+	ReservationReleased  ReservationStatus = "released"
+	ReservationExpired   ReservationStatus = "expired"
+)
+
+type Reservation struct {
+	ID        string            `json:"id"`
+	OrderID   string            `json:"order_id"`
+	Status    ReservationStatus `json:"status"`
+	Items     []ReservationItem `json:"items"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+type ReservationItem struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+type IReservationService interface {
+	Reserve(CreateReservation) (Reservation, error)
+	GetById(string) (Reservation, error)
+	Confirm(string) (Reservation, error)
+	Release(string) (Reservation, error)
+	ReleaseByOrderId(string) error
+}
+
+type CreateReservation struct {
+	OrderID    string            `json:"order_id"`
+	Items      []ReservationItem `json:"items"`
+	TTLSeconds int               `json:"ttl_seconds"`
+}
@@ -0,0 +1,24 @@
+package main
+
+import "time"
+
+type IProductRepository interface {
+	Save(Product) error
+	FindAll() ([]Product, error)
+	FindBySku(string) (Product, error)
+	AddStock(string, int) (Product, error)
+}
+
+type IReservationRepository interface {
+	// Save stores the reservation and takes its items out of stock. If the
+	// order already has a live reservation, that one is returned instead.
+	Save(Reservation) (Reservation, error)
+	FindById(string) (Reservation, error)
+	Confirm(string) error
+	// Release returns the items of a pending or confirmed reservation to stock.
+	Release(string) error
+	ReleaseByOrderId(string) error
+	// ExpireBefore expires at most the given number of pending reservations
+	// whose TTL ran out before the given time and returns their stock.
+	ExpireBefore(time.Time, int) (int, error)
+}
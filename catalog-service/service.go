@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ProductService struct {
+	productRepository IProductRepository
+}
+
+func NewProductService(productRepository IProductRepository) *ProductService {
+	return &ProductService{productRepository: productRepository}
+}
+
+func (s *ProductService) Create(product Product) (Product, error) {
+	if product.SKU == "" || product.Name == "" {
+		return Product{}, fmt.Errorf("%w: sku and name are required", ErrInvalidRequest)
+	}
+	if len(product.Currency) != 3 {
+		return Product{}, fmt.Errorf("%w: currency must be a 3-letter ISO 4217 code", ErrInvalidRequest)
+	}
+	if product.Price < 0 || product.Stock < 0 {
+		return Product{}, fmt.Errorf("%w: price and stock must not be negative", ErrInvalidRequest)
+	}
+
+	now := time.Now().UTC()
+	product.Currency = strings.ToUpper(product.Currency)
+	product.CreatedAt = now
+	product.UpdatedAt = now
+
+	if err := s.productRepository.Save(product); err != nil {
+		return Product{}, err
+	}
+	return product, nil
+}
+
+func (s *ProductService) GetAll() ([]Product, error) {
+	return s.productRepository.FindAll()
+}
+
+func (s *ProductService) GetBySku(sku string) (Product, error) {
+	return s.productRepository.FindBySku(sku)
+}
+
+func (s *ProductService) Restock(sku string, quantity int) (Product, error) {
+	if quantity <= 0 {
+		return Product{}, fmt.Errorf("%w: quantity must be positive", ErrInvalidRequest)
+	}
+	return s.productRepository.AddStock(sku, quantity)
+}
+
+type ReservationService struct {
+	reservationRepository IReservationRepository
+	cfg                   ReservationConfig
+}
+
+func NewReservationService(reservationRepository IReservationRepository, cfg ReservationConfig) *ReservationService {
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = 15 * time.Minute
+	}
+	if cfg.MaxTTL <= 0 {
+		cfg.MaxTTL = time.Hour
+	}
+	return &ReservationService{
+		reservationRepository: reservationRepository,
+		cfg:                   cfg,
+	}
+}
+
+// Reserve is idempotent per order: reserving again for an order that already
+// holds a live reservation returns the existing one.
+func (s *ReservationService) Reserve(create CreateReservation) (Reservation, error) {
+	if _, err := uuid.Parse(create.OrderID); err != nil {
+		return Reservation{}, fmt.Errorf("%w: order_id must be a UUID", ErrInvalidRequest)
+	}
+	items, err := mergeItems(create.Items)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	ttl := s.cfg.DefaultTTL
+	if create.TTLSeconds > 0 {
+		ttl = time.Duration(create.TTLSeconds) * time.Second
+	}
+	if ttl > s.cfg.MaxTTL {
+		ttl = s.cfg.MaxTTL
+	}
+
+	now := time.Now().UTC()
+	reservation := Reservation{
+		ID:        uuid.New().String(),
+		OrderID:   create.OrderID,
+		Status:    ReservationPending,
+		Items:     items,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return s.reservationRepository.Save(reservation)
+}
+
+func (s *ReservationService) GetById(id string) (Reservation, error) {
+	return s.reservationRepository.FindById(id)
+}
+
+func (s *ReservationService) Confirm(id string) (Reservation, error) {
+	if err := s.reservationRepository.Confirm(id); err != nil {
+		return Reservation{}, err
+	}
+	return s.reservationRepository.FindById(id)
+}
+
+func (s *ReservationService) Release(id string) (Reservation, error) {
+	if err := s.reservationRepository.Release(id); err != nil {
+		return Reservation{}, err
+	}
+	return s.reservationRepository.FindById(id)
+}
+
+func (s *ReservationService) ReleaseByOrderId(orderId string) error {
+	return s.reservationRepository.ReleaseByOrderId(orderId)
+}
+
+// mergeItems validates the requested items, folds duplicate SKUs together and
+// sorts them by SKU, which is the lock order the repository relies on.
+func mergeItems(items []ReservationItem) ([]ReservationItem, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: at least one item is required", ErrInvalidRequest)
+	}
+
+	quantities := make(map[string]int, len(items))
+	for _, item := range items {
+		if item.SKU == "" {
+			return nil, fmt.Errorf("%w: item sku is required", ErrInvalidRequest)
+		}
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: item quantity must be positive", ErrInvalidRequest)
+		}
+		quantities[item.SKU] += item.Quantity
+	}
+
+	merged := make([]ReservationItem, 0, len(quantities))
+	for sku, quantity := range quantities {
+		merged = append(merged, ReservationItem{SKU: sku, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].SKU < merged[j].SKU
+	})
+	return merged, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReservationRepository keeps stock and reservations in memory and
+// follows the contract of IReservationRepository.
+type fakeReservationRepository struct {
+	mu           sync.Mutex
+	stock        map[string]int
+	reservations map[string]Reservation
+	expireCalls  int
+}
+
+func newFakeReservationRepository(stock map[string]int) *fakeReservationRepository {
+	return &fakeReservationRepository{
+		stock:        stock,
+		reservations: make(map[string]Reservation),
+	}
+}
+
+func (r *fakeReservationRepository) Save(reservation Reservation) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.reservations {
+		if existing.OrderID == reservation.OrderID && live(existing.Status) {
+			return existing, nil
+		}
+	}
+	for _, item := range reservation.Items {
+		available, ok := r.stock[item.SKU]
+		if !ok {
+			return Reservation{}, fmt.Errorf("%w: %s", ErrProductNotFound, item.SKU)
+		}
+		if available < item.Quantity {
+			return Reservation{}, fmt.Errorf("%w: %s", ErrInsufficientStock, item.SKU)
+		}
+	}
+	for _, item := range reservation.Items {
+		r.stock[item.SKU] -= item.Quantity
+	}
+	r.reservations[reservation.ID] = reservation
+	return reservation, nil
+}
+
+func (r *fakeReservationRepository) FindById(id string) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[id]
+	if !ok {
+		return Reservation{}, fmt.Errorf("%w: %s", ErrReservationNotFound, id)
+	}
+	return reservation, nil
+}
+
+func (r *fakeReservationRepository) Confirm(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reservation, ok := r.reservations[id]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrReservationNotFound, id)
+	case reservation.Status == ReservationConfirmed:
+		return nil
+	case reservation.Status != ReservationPending || !reservation.ExpiresAt.After(time.Now()):
+		return fmt.Errorf("%w: %s is %s", ErrReservationNotPending, id, reservation.Status)
+	}
+	reservation.Status = ReservationConfirmed
+	r.reservations[id] = reservation
+	return nil
+}
+
+func (r *fakeReservationRepository) Release(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.reservations[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrReservationNotFound, id)
+	}
+	r.end(id, ReservationReleased)
+	return nil
+}
+
+func (r *fakeReservationRepository) ReleaseByOrderId(orderId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, reservation := range r.reservations {
+		if reservation.OrderID == orderId {
+			r.end(id, ReservationReleased)
+		}
+	}
+	return nil
+}
+
+func (r *fakeReservationRepository) ExpireBefore(before time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expireCalls++
+	n := 0
+	for id, reservation := range r.reservations {
+		if n == limit {
+			break
+		}
+		if reservation.Status == ReservationPending && !reservation.ExpiresAt.After(before) {
+			r.end(id, ReservationExpired)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// end moves a live reservation to status and returns its stock. Ended
+// reservations are left alone, so releasing twice returns stock once.
+func (r *fakeReservationRepository) end(id string, status ReservationStatus) {
+	reservation := r.reservations[id]
+	if !live(reservation.Status) {
+		return
+	}
+	for _, item := range reservation.Items {
+		r.stock[item.SKU] += item.Quantity
+	}
+	reservation.Status = status
+	r.reservations[id] = reservation
+}
+
+func live(status ReservationStatus) bool {
+	return status == ReservationPending || status == ReservationConfirmed
+}
+
+const testOrderId = "3f1c8f0e-6b2a-4c4b-9d5e-0a1b2c3d4e5f"
+
+func newTestReservationService(stock map[string]int) (*ReservationService, *fakeReservationRepository) {
+	repository := newFakeReservationRepository(stock)
+	return NewReservationService(repository, ReservationConfig{DefaultTTL: 15 * time.Minute, MaxTTL: time.Hour}), repository
+}
+
+func TestReservationServiceReserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		create    CreateReservation
+		wantErr   error
+		wantItems []ReservationItem
+		wantTTL   time.Duration
+		wantStock map[string]int
+	}{
+		{
+			name:      "reserves stock",
+			create:    CreateReservation{OrderID: testOrderId, Items: []ReservationItem{{SKU: "b", Quantity: 2}, {SKU: "a", Quantity: 1}}},
+			wantItems: []ReservationItem{{SKU: "a", Quantity: 1}, {SKU: "b", Quantity: 2}},
+			wantTTL:   15 * time.Minute,
+			wantStock: map[string]int{"a": 4, "b": 3},
+		},
+		{
+			name:      "merges duplicate skus",
+			create:    CreateReservation{OrderID: testOrderId, Items: []ReservationItem{{SKU: "a", Quantity: 2}, {SKU: "a", Quantity: 3}}},
+			wantItems: []ReservationItem{{SKU: "a", Quantity: 5}},
+			wantTTL:   15 * time.Minute,
+			wantStock: map[string]int{"a": 0, "b": 5},
+		},
+		{
+			name:      "caps the ttl",
+			create:    CreateReservation{OrderID: testOrderId, Items: []ReservationItem{{SKU: "a", Quantity: 1}}, TTLSeconds: 7200},
+			wantItems: []ReservationItem{{SKU: "a", Quantity: 1}},
+			wantTTL:   time.Hour,
+			wantStock: map[string]int{"a": 4, "b": 5},
+		},
+		{
+			name:      "insufficient stock",
+			create:    CreateReservation{OrderID: testOrderId, Items: []ReservationItem{{SKU: "a", Quantity: 1}, {SKU: "b", Quantity: 6}}},
+			wantErr:   ErrInsufficientStock,
+			wantStock: map[string]int{"a": 5, "b": 5},
+		},
+		{
+			name:      "order id is not a uuid",
+			create:    CreateReservation{OrderID: "abc", Items: []ReservationItem{{SKU: "a", Quantity: 1}}},
+			wantErr:   ErrInvalidRequest,
+			wantStock: map[string]int{"a": 5, "b": 5},
+		},
+		{
+			name:      "no items",
+			create:    CreateReservation{OrderID: testOrderId},
+			wantErr:   ErrInvalidRequest,
+			wantStock: map[string]int{"a": 5, "b": 5},
+		},
+		{
+			name:      "quantity must be positive",
+			create:    CreateReservation{OrderID: testOrderId, Items: []ReservationItem{{SKU: "a", Quantity: 0}}},
+			wantErr:   ErrInvalidRequest,
+			wantStock: map[string]int{"a": 5, "b": 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repository := newTestReservationService(map[string]int{"a": 5, "b": 5})
+
+			reservation, err := service.Reserve(tt.create)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if reservation.Status != ReservationPending {
+					t.Errorf("status %s, want %s", reservation.Status, ReservationPending)
+				}
+				if fmt.Sprint(reservation.Items) != fmt.Sprint(tt.wantItems) {
+					t.Errorf("items %v, want %v", reservation.Items, tt.wantItems)
+				}
+				if ttl := reservation.ExpiresAt.Sub(reservation.CreatedAt); ttl != tt.wantTTL {
+					t.Errorf("ttl %s, want %s", ttl, tt.wantTTL)
+				}
+			}
+			if fmt.Sprint(repository.stock) != fmt.Sprint(tt.wantStock) {
+				t.Errorf("stock %v, want %v", repository.stock, tt.wantStock)
+			}
+		})
+	}
+}
+
+func TestReservationServiceReserveIsIdempotentPerOrder(t *testing.T) {
+	service, repository := newTestReservationService(map[string]int{"a": 5})
+	create := CreateReservation{OrderID: testOrderId, Items: []ReservationItem{{SKU: "a", Quantity: 2}}}
+
+	first, err := service.Reserve(create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.Reserve(create)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.ID != first.ID {
+		t.Errorf("second reservation %s, want the existing %s", second.ID, first.ID)
+	}
+	if repository.stock["a"] != 3 {
+		t.Errorf("stock %d, want 3", repository.stock["a"])
+	}
+}
+
+func TestReservationServiceConfirmAndRelease(t *testing.T) {
+	tests := []struct {
+		name       string
+		steps      []string
+		expired    bool
+		wantErr    error
+		wantStatus ReservationStatus
+		wantStock  int
+	}{
+		{name: "confirm", steps: []string{"confirm"}, wantStatus: ReservationConfirmed, wantStock: 3},
+		{name: "confirm twice", steps: []string{"confirm", "confirm"}, wantStatus: ReservationConfirmed, wantStock: 3},
+		{name: "release", steps: []string{"release"}, wantStatus: ReservationReleased, wantStock: 5},
+		{name: "release twice", steps: []string{"release", "release"}, wantStatus: ReservationReleased, wantStock: 5},
+		{name: "release after confirm", steps: []string{"confirm", "release"}, wantStatus: ReservationReleased, wantStock: 5},
+		{name: "confirm after release", steps: []string{"release", "confirm"}, wantErr: ErrReservationNotPending, wantStatus: ReservationReleased, wantStock: 5},
+		{name: "confirm after expiry", steps: []string{"confirm"}, expired: true, wantErr: ErrReservationNotPending, wantStatus: ReservationPending, wantStock: 3},
+		{name: "release by order", steps: []string{"release-order"}, wantStatus: ReservationReleased, wantStock: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repository := newTestReservationService(map[string]int{"a": 5})
+			reservation, err := service.Reserve(CreateReservation{OrderID: testOrderId, Items: []ReservationItem{{SKU: "a", Quantity: 2}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expired {
+				reservation.ExpiresAt = time.Now().Add(-time.Second)
+				repository.reservations[reservation.ID] = reservation
+			}
+
+			for _, step := range tt.steps {
+				switch step {
+				case "confirm":
+					_, err = service.Confirm(reservation.ID)
+				case "release":
+					_, err = service.Release(reservation.ID)
+				case "release-order":
+					err = service.ReleaseByOrderId(testOrderId)
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("last step = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, _ := service.GetById(reservation.ID)
+			if stored.Status != tt.wantStatus {
+				t.Errorf("status %s, want %s", stored.Status, tt.wantStatus)
+			}
+			if repository.stock["a"] != tt.wantStock {
+				t.Errorf("stock %d, want %d", repository.stock["a"], tt.wantStock)
+			}
+		})
+	}
+}
+
+func TestReservationServiceUnknownReservation(t *testing.T) {
+	service, _ := newTestReservationService(map[string]int{"a": 5})
+
+	if _, err := service.Confirm("missing"); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Confirm() = %v, want %v", err, ErrReservationNotFound)
+	}
+	if _, err := service.Release("missing"); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Release() = %v, want %v", err, ErrReservationNotFound)
+	}
+}
+
+func TestReservationSweeperExpiresInBatches(t *testing.T) {
+	service, repository := newTestReservationService(map[string]int{"a": 10})
+	var ids []string
+	orderIds := []string{
+		"00000000-0000-4000-8000-000000000001",
+		"00000000-0000-4000-8000-000000000002",
+		"00000000-0000-4000-8000-000000000003",
+	}
+	for _, orderId := range orderIds {
+		reservation, err := service.Reserve(CreateReservation{OrderID: orderId, Items: []ReservationItem{{SKU: "a", Quantity: 2}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, reservation.ID)
+	}
+	live, err := service.Reserve(CreateReservation{OrderID: testOrderId, Items: []ReservationItem{{SKU: "a", Quantity: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range ids {
+		reservation := repository.reservations[id]
+		reservation.ExpiresAt = time.Now().Add(-time.Minute)
+		repository.reservations[id] = reservation
+	}
+	if _, err := service.Confirm(ids[0]); !errors.Is(err, ErrReservationNotPending) {
+		t.Fatalf("Confirm() of an expired reservation = %v, want %v", err, ErrReservationNotPending)
+	}
+
+	NewReservationSweeper(repository, ReservationConfig{SweepBatchSize: 2}).sweep()
+
+	for _, id := range ids {
+		if status := repository.reservations[id].Status; status != ReservationExpired {
+			t.Errorf("reservation %s is %s, want %s", id, status, ReservationExpired)
+		}
+	}
+	if status := repository.reservations[live.ID].Status; status != ReservationPending {
+		t.Errorf("live reservation is %s, want %s", status, ReservationPending)
+	}
+	if repository.stock["a"] != 9 {
+		t.Errorf("stock %d, want 9", repository.stock["a"])
+	}
+	if repository.expireCalls != 2 {
+		t.Errorf("%d sweep batches, want 2", repository.expireCalls)
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+// Scopes a service token needs for the mutating endpoints. catalog.write
+// covers managing products, catalog.reserve holding and releasing stock.
+const (
+	CatalogWriteScope   = "catalog.write"
+	CatalogReserveScope = "catalog.reserve"
+)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ReservationSweeper periodically expires pending reservations whose TTL has
+// run out and returns their units to stock.
+type ReservationSweeper struct {
+	reservationRepository IReservationRepository
+	interval              time.Duration
+	batchSize             int
+}
+
+func NewReservationSweeper(reservationRepository IReservationRepository, cfg ReservationConfig) *ReservationSweeper {
+	interval := cfg.SweepInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	batchSize := cfg.SweepBatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &ReservationSweeper{
+		reservationRepository: reservationRepository,
+		interval:              interval,
+		batchSize:             batchSize,
+	}
+}
+
+func (s *ReservationSweeper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sweep()
+			}
+		}
+	}()
+}
+
+func (s *ReservationSweeper) sweep() {
+	for {
+		n, err := s.reservationRepository.ExpireBefore(time.Now(), s.batchSize)
+		if err != nil {
+			log.Printf("Reservation sweep error: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Expired %d reservations", n)
+		}
+		if n < s.batchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+)
+
+// AdminController serves the gateway's admin API. It is registered on a
+// separate listener, as the public router forwards /admin to user-service.
+type AdminController struct {
+	routes     []*Route
+	composites []*Composite
+	splitter   *TrafficSplitter
+	pools      map[string]*UpstreamPool
+}
+
+func NewAdminController(routes []*Route, composites []*Composite, splitter *TrafficSplitter, pools map[string]*UpstreamPool) *AdminController {
+	return &AdminController{
+		routes:     routes,
+		composites: composites,
+		splitter:   splitter,
+		pools:      pools,
+	}
+}
+
+func (c *AdminController) circuitBreakers(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]CircuitBreakerStatus, 0, len(c.routes))
+	for _, route := range c.routes {
+		for _, target := range route.Split.targets {
+			statuses = append(statuses, target.Breaker.Status())
+		}
+	}
+	for _, composite := range c.composites {
+		for _, part := range composite.Parts {
+			statuses = append(statuses, part.Target.Breaker.Status())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (c *AdminController) upstreamPools(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]UpstreamPoolStatus, 0, len(c.pools))
+	for _, pool := range c.pools {
+		statuses = append(statuses, pool.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (c *AdminController) trafficSplits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.splitter.Statuses())
+}
+
+// setWeights takes a map of target names to weights. Targets that are left
+// out keep their weight.
+func (c *AdminController) setWeights(w http.ResponseWriter, r *http.Request) {
+	var weights map[string]int
+	if err := json.NewDecoder(r.Body).Decode(&weights); err != nil || len(weights) == 0 {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := c.splitter.SetWeights(mux.Vars(r)["route"], weights)
+	if errors.Is(err, ErrTrafficSplitNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrTrafficSplitStoreUnavailable) {
+		http.Error(w, "Error saving weights", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *AdminController) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/circuit-breakers", c.circuitBreakers).Methods("GET")
+	router.HandleFunc("/pools", c.upstreamPools).Methods("GET")
+	router.HandleFunc("/traffic-splits", c.trafficSplits).Methods("GET")
+	router.HandleFunc("/traffic-splits/{route}", c.setWeights).Methods("PUT")
+}
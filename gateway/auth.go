@@ -0,0 +1,85 @@
+package main
+
+import (
+	"authz"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Authenticator verifies the bearer token of non-public routes. The identity
+// headers are only ever set by it; any client-supplied copy is removed before
+// the request is proxied.
+type Authenticator struct {
+	verifier *authz.TokenVerifier
+}
+
+func NewAuthenticator(cfg JWTConfig, revocations authz.IRevocationList) *Authenticator {
+	keySet := authz.NewJWKSKeySet(cfg.JWKSURL, cfg.RefreshInterval)
+	return &Authenticator{verifier: authz.NewTokenVerifier(keySet, cfg.Issuer, revocations)}
+}
+
+func (a *Authenticator) Middleware(route *Route, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range authz.IdentityHeaders {
+			r.Header.Del(header)
+		}
+
+		if route.Public {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tokenStr, err := bearerToken(r)
+		if err != nil {
+			unauthorized(w, err.Error())
+			return
+		}
+
+		claims, err := a.verifier.VerifyAccessToken(tokenStr)
+		if errors.Is(err, authz.ErrRevocationUnavailable) {
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			unauthorized(w, "Invalid or expired token")
+			return
+		}
+
+		if !hasPermissions(claims.Permissions, route.Permissions) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		authz.SetIdentityHeaders(r.Header, claims)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasPermissions(granted []string, required []string) bool {
+	have := make(map[string]bool, len(granted))
+	for _, p := range granted {
+		have[p] = true
+	}
+	for _, p := range required {
+		if !have[p] {
+			return false
+		}
+	}
+	return true
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		return "", fmt.Errorf("Missing or invalid Authorization header")
+	}
+	return strings.TrimPrefix(authHeader, "Bearer "), nil
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="gateway"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
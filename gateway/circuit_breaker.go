@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitOpenError is returned instead of calling an upstream whose circuit
+// is open.
+type CircuitOpenError struct {
+	Route      string
+	Target     string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for target %s of route %s is open", e.Target, e.Route)
+}
+
+type CircuitBreakerStatus struct {
+	Route    string     `json:"route"`
+	Target   string     `json:"target"`
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// CircuitBreaker guards one target of a route, so a failing canary does not
+// cut off the stable target. It opens after FailureThreshold consecutive
+// failed calls and then rejects calls until OpenTimeout has passed. After
+// that it is half-open and lets HalfOpenRequests calls through at a time: the
+// first success closes it again, and a failure opens it for another
+// OpenTimeout.
+type CircuitBreaker struct {
+	route            string
+	target           string
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenRequests int
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+func NewCircuitBreaker(route string, target string, cfg CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		route:            route,
+		target:           target,
+		failureThreshold: cfg.FailureThreshold,
+		openTimeout:      cfg.OpenTimeout,
+		halfOpenRequests: cfg.HalfOpenRequests,
+		state:            CircuitClosed,
+	}
+}
+
+// Allow returns a *CircuitOpenError when the call must not be made. Every
+// allowed call has to be followed by Success, Failure or Release.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.state == CircuitOpen {
+		if wait := b.openedAt.Add(b.openTimeout).Sub(now); wait > 0 {
+			return &CircuitOpenError{Route: b.route, Target: b.target, RetryAfter: wait}
+		}
+		b.state = CircuitHalfOpen
+		b.probes = 0
+	}
+	if b.state == CircuitHalfOpen {
+		if b.probes >= b.halfOpenRequests {
+			return &CircuitOpenError{Route: b.route, Target: b.target, RetryAfter: time.Second}
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Ready reports whether Allow would currently let a call through, without
+// taking a half-open slot.
+func (b *CircuitBreaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		return !time.Now().Before(b.openedAt.Add(b.openTimeout))
+	case CircuitHalfOpen:
+		return b.probes < b.halfOpenRequests
+	}
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probes = 0
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.failureThreshold) {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+		b.probes = 0
+	}
+}
+
+// Release ends a call whose outcome says nothing about the upstream, such as
+// one the client gave up on.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *CircuitBreaker) Status() CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := CircuitBreakerStatus{
+		Route:    b.route,
+		Target:   b.target,
+		State:    b.state,
+		Failures: b.failures,
+	}
+	// An open circuit only turns half-open on the next call, but it already
+	// would let that call through.
+	if b.state == CircuitOpen && !time.Now().Before(b.openedAt.Add(b.openTimeout)) {
+		status.State = CircuitHalfOpen
+	}
+	if b.state != CircuitClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testOpenTimeout = 20 * time.Millisecond
+
+// breakerStep is one call to the breaker. For "allow" want is whether the
+// call is let through; "wait" sleeps past the open timeout.
+type breakerStep struct {
+	op    string
+	want  bool
+	state string
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{
+		{
+			name: "opens after consecutive failures",
+			steps: []breakerStep{
+				{op: "failure", state: CircuitClosed},
+				{op: "failure", state: CircuitClosed},
+				{op: "failure", state: CircuitOpen},
+				{op: "allow", want: false, state: CircuitOpen},
+			},
+		},
+		{
+			name: "success resets the failure count",
+			steps: []breakerStep{
+				{op: "failure", state: CircuitClosed},
+				{op: "failure", state: CircuitClosed},
+				{op: "success", state: CircuitClosed},
+				{op: "failure", state: CircuitClosed},
+				{op: "failure", state: CircuitClosed},
+				{op: "allow", want: true, state: CircuitClosed},
+			},
+		},
+		{
+			name: "half-open probe success closes",
+			steps: []breakerStep{
+				{op: "failure"}, {op: "failure"}, {op: "failure", state: CircuitOpen},
+				{op: "wait", state: CircuitHalfOpen},
+				{op: "allow", want: true, state: CircuitHalfOpen},
+				{op: "allow", want: false, state: CircuitHalfOpen},
+				{op: "success", state: CircuitClosed},
+				{op: "allow", want: true, state: CircuitClosed},
+			},
+		},
+		{
+			name: "half-open probe failure opens again",
+			steps: []breakerStep{
+				{op: "failure"}, {op: "failure"}, {op: "failure", state: CircuitOpen},
+				{op: "wait"},
+				{op: "allow", want: true, state: CircuitHalfOpen},
+				{op: "failure", state: CircuitOpen},
+				{op: "allow", want: false, state: CircuitOpen},
+			},
+		},
+		{
+			name: "released probe frees its slot",
+			steps: []breakerStep{
+				{op: "failure"}, {op: "failure"}, {op: "failure", state: CircuitOpen},
+				{op: "wait"},
+				{op: "allow", want: true, state: CircuitHalfOpen},
+				{op: "release", state: CircuitHalfOpen},
+				{op: "allow", want: true, state: CircuitHalfOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := NewCircuitBreaker("orders", "stable", CircuitBreakerConfig{
+				FailureThreshold: 3,
+				OpenTimeout:      testOpenTimeout,
+				HalfOpenRequests: 1,
+			})
+
+			for i, step := range tt.steps {
+				switch step.op {
+				case "allow":
+					err := breaker.Allow()
+					var openErr *CircuitOpenError
+					if err != nil && !errors.As(err, &openErr) {
+						t.Fatalf("step %d: Allow() = %v, want a CircuitOpenError", i, err)
+					}
+					if allowed := err == nil; allowed != step.want {
+						t.Errorf("step %d: Allow() let the call through %t, want %t", i, allowed, step.want)
+					}
+				case "success":
+					breaker.Success()
+				case "failure":
+					breaker.Failure()
+				case "release":
+					breaker.Release()
+				case "wait":
+					time.Sleep(testOpenTimeout + 5*time.Millisecond)
+				}
+
+				if step.state != "" {
+					if got := breaker.Status().State; got != step.state {
+						t.Errorf("step %d (%s): state %s, want %s", i, step.op, got, step.state)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUpstreamFailure(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusNotFound, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusNotImplemented, false},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+	}
+	for _, tt := range tests {
+		if got := upstreamFailure(tt.status); got != tt.want {
+			t.Errorf("upstreamFailure(%d) = %t, want %t", tt.status, got, tt.want)
+		}
+	}
+}
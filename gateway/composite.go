@@ -0,0 +1,243 @@
+package main
+
+import (
+	"authz"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// maxPartBodySize bounds how much of a part's response is buffered.
+const maxPartBodySize = 10 << 20
+
+// Composite answers a GET on its path by calling all of its parts
+// concurrently and returning one document with each part's response under
+// its key. Parts that fail are left out and listed under "errors" instead.
+// Parts are called through the same transport as routes, so they are
+// retried and guarded by a circuit breaker. They have no traffic split:
+// a part is a single target.
+type Composite struct {
+	Route     *Route
+	Parts     []*CompositePart
+	transport http.RoundTripper
+}
+
+type CompositePart struct {
+	Key     string
+	Target  *Target
+	Path    string
+	Exclude []string
+}
+
+type CompositePartError struct {
+	Part   string `json:"part"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+func NewComposites(compositeConfigs []CompositeConfig, rateLimits map[string]*RateLimitPolicy, pools map[string]*UpstreamPool) ([]*Composite, error) {
+	composites := make([]*Composite, 0, len(compositeConfigs))
+	for _, cc := range compositeConfigs {
+		composite, err := newComposite(cc, rateLimits, pools)
+		if err != nil {
+			return nil, fmt.Errorf("invalid composite %q: %w", cc.Name, err)
+		}
+		composites = append(composites, composite)
+	}
+	return composites, nil
+}
+
+func newComposite(cc CompositeConfig, rateLimits map[string]*RateLimitPolicy, pools map[string]*UpstreamPool) (*Composite, error) {
+	if cc.Path == "" || !strings.HasPrefix(cc.Path, "/") {
+		return nil, fmt.Errorf("path must start with /")
+	}
+	if cc.Public && len(cc.Permissions) > 0 {
+		return nil, fmt.Errorf("a public composite cannot require permissions")
+	}
+	if cc.Timeout < 0 {
+		return nil, fmt.Errorf("timeout cannot be negative")
+	}
+	retry, err := newRetryPolicy(cc.Retry)
+	if err != nil {
+		return nil, err
+	}
+	if len(cc.Parts) == 0 {
+		return nil, fmt.Errorf("at least one part is required")
+	}
+
+	parts := make([]*CompositePart, 0, len(cc.Parts))
+	keys := make(map[string]bool, len(cc.Parts))
+	for _, pc := range cc.Parts {
+		if pc.Key == "" || pc.Key == "errors" || keys[pc.Key] {
+			return nil, fmt.Errorf("part key %q is missing, reserved or duplicated", pc.Key)
+		}
+		keys[pc.Key] = true
+
+		pool, err := findPool(pc.Upstream, pc.Pool, pools)
+		if err != nil {
+			return nil, fmt.Errorf("part %q: %w", pc.Key, err)
+		}
+		if !strings.HasPrefix(pc.Path, "/") {
+			return nil, fmt.Errorf("path of part %q must start with /", pc.Key)
+		}
+		if cc.Public && strings.ContainsAny(pc.Path, "{}") {
+			return nil, fmt.Errorf("path of part %q needs an authenticated user", pc.Key)
+		}
+
+		parts = append(parts, &CompositePart{
+			Key:     pc.Key,
+			Target:  &Target{Name: pc.Key, Pool: pool, Breaker: NewCircuitBreaker(cc.Name, pc.Key, cc.CircuitBreaker)},
+			Path:    pc.Path,
+			Exclude: pc.Exclude,
+		})
+	}
+
+	policies, err := findRateLimits(cc.RateLimits, rateLimits)
+	if err != nil {
+		return nil, err
+	}
+	timeout := cc.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	route := &Route{
+		Name:        cc.Name,
+		Prefix:      strings.TrimSuffix(cc.Path, "/"),
+		Methods:     []string{http.MethodGet},
+		Public:      cc.Public,
+		Permissions: cc.Permissions,
+		RateLimits:  policies,
+		Timeout:     timeout,
+		Retry:       retry,
+	}
+	return &Composite{
+		Route:     route,
+		Parts:     parts,
+		transport: NewUpstreamTransport(route),
+	}, nil
+}
+
+func (c *Composite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), c.Route.Timeout)
+	defer cancel()
+
+	bodies := make([]json.RawMessage, len(c.Parts))
+	partErrors := make([]*CompositePartError, len(c.Parts))
+	var wg sync.WaitGroup
+	for i, part := range c.Parts {
+		wg.Add(1)
+		go func(i int, part *CompositePart) {
+			defer wg.Done()
+			bodies[i], partErrors[i] = c.fetch(ctx, r, part)
+		}(i, part)
+	}
+	wg.Wait()
+
+	document := make(map[string]interface{}, len(c.Parts)+1)
+	var errs []*CompositePartError
+	for i, part := range c.Parts {
+		if partErrors[i] != nil {
+			log.Printf("Composite part error: composite=%s part=%s status=%d err=%s", c.Route.Name, part.Key, partErrors[i].Status, partErrors[i].Detail)
+			errs = append(errs, partErrors[i])
+			continue
+		}
+		document[part.Key] = bodies[i]
+	}
+
+	if len(errs) == len(c.Parts) {
+		writeProblem(w, http.StatusBadGateway, "Bad gateway",
+			"None of the parts of composite "+c.Route.Name+" could be fetched.")
+		return
+	}
+	if len(errs) > 0 {
+		document["errors"] = errs
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(document)
+}
+
+// fetch calls a part with the caller's credentials and identity headers and
+// returns its JSON body as is.
+func (c *Composite) fetch(ctx context.Context, r *http.Request, part *CompositePart) (json.RawMessage, *CompositePartError) {
+	ctx = context.WithValue(ctx, targetContextKey{}, part.Target)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, part.expandPath(r), nil)
+	if err != nil {
+		return nil, &CompositePartError{Part: part.Key, Status: http.StatusBadGateway, Detail: "invalid upstream request"}
+	}
+	req.Header.Set("Accept", "application/json")
+	for _, header := range append([]string{"Authorization"}, authz.IdentityHeaders...) {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	// Consistent hashing picks the member by the caller's identity, or by
+	// its address when anonymous.
+	req.RemoteAddr = r.RemoteAddr
+
+	resp, err := c.transport.RoundTrip(req)
+	var openErr *CircuitOpenError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, &CompositePartError{Part: part.Key, Status: http.StatusGatewayTimeout, Detail: "upstream did not respond in time"}
+	case errors.As(err, &openErr):
+		return nil, &CompositePartError{Part: part.Key, Status: http.StatusServiceUnavailable, Detail: "circuit breaker is open"}
+	case errors.Is(err, ErrNoHealthyUpstream):
+		return nil, &CompositePartError{Part: part.Key, Status: http.StatusServiceUnavailable, Detail: "no healthy upstream"}
+	case err != nil:
+		return nil, &CompositePartError{Part: part.Key, Status: http.StatusBadGateway, Detail: "upstream could not be reached"}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &CompositePartError{Part: part.Key, Status: resp.StatusCode, Detail: fmt.Sprintf("upstream responded with status %d", resp.StatusCode)}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPartBodySize+1))
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, &CompositePartError{Part: part.Key, Status: http.StatusGatewayTimeout, Detail: "upstream did not respond in time"}
+	}
+	if err != nil || len(body) > maxPartBodySize || !json.Valid(body) {
+		return nil, &CompositePartError{Part: part.Key, Status: http.StatusBadGateway, Detail: "upstream response is not valid JSON"}
+	}
+	body, err = part.exclude(body)
+	if err != nil {
+		return nil, &CompositePartError{Part: part.Key, Status: http.StatusBadGateway, Detail: "upstream response is not a JSON object"}
+	}
+	return body, nil
+}
+
+// exclude removes the excluded fields from a part's response. A response
+// that is not an object cannot be checked for them, so it is refused.
+func (p *CompositePart) exclude(body json.RawMessage) (json.RawMessage, error) {
+	if len(p.Exclude) == 0 {
+		return body, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil, fmt.Errorf("response is not a JSON object")
+	}
+	for _, field := range p.Exclude {
+		delete(fields, field)
+	}
+	return json.Marshal(fields)
+}
+
+func (p *CompositePart) expandPath(r *http.Request) string {
+	return strings.NewReplacer(
+		"{userId}", url.PathEscape(r.Header.Get(authz.UserIdHeader)),
+		"{email}", url.PathEscape(r.Header.Get(authz.UserEmailHeader)),
+	).Replace(p.Path)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"authz"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestUpstream answers every path with the given status and body and
+// records the paths it was asked for.
+func newTestUpstream(t *testing.T, status int, body string, paths *[]string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if paths != nil {
+			*paths = append(*paths, r.URL.EscapedPath())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func serveComposite(t *testing.T, parts []CompositePartConfig) (int, map[string]json.RawMessage) {
+	t.Helper()
+	composite, err := newComposite(CompositeConfig{Name: "account", Path: "/account", Timeout: time.Second, Parts: parts}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/account", nil)
+	r.Header.Set(authz.UserIdHeader, "u1")
+	r.Header.Set(authz.UserEmailHeader, "a/b@example.com")
+	w := httptest.NewRecorder()
+	composite.ServeHTTP(w, r)
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, document
+}
+
+func TestCompositeParts(t *testing.T) {
+	user := newTestUpstream(t, http.StatusOK, `{"id":"u1","password":"secret"}`, nil)
+	sessions := newTestUpstream(t, http.StatusOK, `[{"id":"s1"}]`, nil)
+	notFound := newTestUpstream(t, http.StatusNotFound, `{"error":"not found"}`, nil)
+	down := newTestUpstream(t, http.StatusServiceUnavailable, `{}`, nil)
+
+	tests := []struct {
+		name       string
+		parts      []CompositePartConfig
+		wantStatus int
+		wantKeys   map[string]string
+		wantErrors string
+	}{
+		{
+			name: "all parts",
+			parts: []CompositePartConfig{
+				{Key: "user", Upstream: user, Path: "/users/{userId}", Exclude: []string{"password"}},
+				{Key: "sessions", Upstream: sessions, Path: "/auth/sessions"},
+			},
+			wantStatus: http.StatusOK,
+			wantKeys:   map[string]string{"user": `{"id":"u1"}`, "sessions": `[{"id":"s1"}]`},
+		},
+		{
+			name: "partial failure",
+			parts: []CompositePartConfig{
+				{Key: "user", Upstream: user, Path: "/users/{userId}", Exclude: []string{"password"}},
+				{Key: "orders", Upstream: notFound, Path: "/orders"},
+				{Key: "sessions", Upstream: down, Path: "/auth/sessions"},
+			},
+			wantStatus: http.StatusOK,
+			wantKeys:   map[string]string{"user": `{"id":"u1"}`},
+			wantErrors: `[{"part":"orders","status":404,"detail":"upstream responded with status 404"},` +
+				`{"part":"sessions","status":503,"detail":"upstream responded with status 503"}]`,
+		},
+		{
+			name: "exclude on a response that is not an object",
+			parts: []CompositePartConfig{
+				{Key: "user", Upstream: user, Path: "/users/{userId}"},
+				{Key: "sessions", Upstream: sessions, Path: "/auth/sessions", Exclude: []string{"id"}},
+			},
+			wantStatus: http.StatusOK,
+			wantKeys:   map[string]string{"user": `{"id":"u1","password":"secret"}`},
+			wantErrors: `[{"part":"sessions","status":502,"detail":"upstream response is not a JSON object"}]`,
+		},
+		{
+			name: "all parts failed",
+			parts: []CompositePartConfig{
+				{Key: "orders", Upstream: notFound, Path: "/orders"},
+				{Key: "sessions", Upstream: down, Path: "/auth/sessions"},
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, document := serveComposite(t, tt.parts)
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d", status, tt.wantStatus)
+			}
+			if status != http.StatusOK {
+				return
+			}
+
+			for key, want := range tt.wantKeys {
+				if got := string(document[key]); got != want {
+					t.Errorf("%s = %s, want %s", key, got, want)
+				}
+			}
+			if got := string(document["errors"]); got != tt.wantErrors {
+				t.Errorf("errors = %s, want %s", got, tt.wantErrors)
+			}
+			delete(document, "errors")
+			if len(document) != len(tt.wantKeys) {
+				t.Errorf("document has %d parts, want %d", len(document), len(tt.wantKeys))
+			}
+		})
+	}
+}
+
+func TestCompositeExpandsPath(t *testing.T) {
+	var paths []string
+	upstream := newTestUpstream(t, http.StatusOK, `{}`, &paths)
+
+	serveComposite(t, []CompositePartConfig{
+		{Key: "profile", Upstream: upstream, Path: "/users/{userId}/profile"},
+	})
+	if len(paths) != 1 || paths[0] != "/users/u1/profile" {
+		t.Errorf("upstream asked for %v, want /users/u1/profile", paths)
+	}
+
+	paths = nil
+	serveComposite(t, []CompositePartConfig{
+		{Key: "lookup", Upstream: upstream, Path: "/users/by-email/{email}"},
+	})
+	if len(paths) != 1 || paths[0] != "/users/by-email/a%2Fb@example.com" {
+		t.Errorf("upstream asked for %v, want /users/by-email/a%%2Fb@example.com", paths)
+	}
+}
+
+func TestCompositeOpenCircuit(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	composite, err := newComposite(CompositeConfig{
+		Name:           "account",
+		Path:           "/account",
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute},
+		Parts:          []CompositePartConfig{{Key: "user", Upstream: server.URL, Path: "/users/{userId}"}},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/account", nil)
+		r.Header.Set(authz.UserIdHeader, "u1")
+		composite.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if calls != 2 {
+		t.Errorf("upstream called %d times, want 2 before the circuit opened", calls)
+	}
+	if state := composite.Parts[0].Target.Breaker.Status().State; state != CircuitOpen {
+		t.Errorf("circuit %s, want %s", state, CircuitOpen)
+	}
+}
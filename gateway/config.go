@@ -0,0 +1,203 @@
+package main
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"time"
+)
+
+type Config struct {
+	ApplicationConfig
+}
+
+type ApplicationConfig struct {
+	Server     ServerConfig            `yaml:"server"`
+	Redis      RedisConfig             `yaml:"redis"`
+	JWT        JWTConfig               `yaml:"jwt"`
+	Admin      AdminConfig             `yaml:"admin"`
+	Internal   InternalConfig          `yaml:"internal"`
+	Routes     []RouteConfig           `yaml:"routes"`
+	RateLimits []RateLimitPolicyConfig `yaml:"rateLimits"`
+	Composites []CompositeConfig       `yaml:"composites"`
+	Pools      []PoolConfig            `yaml:"pools"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port"`
+}
+
+// AdminConfig is the address of the admin API. It should only be reachable
+// from inside the deployment.
+type AdminConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+// InternalConfig is the address services call each other's pools on. Like
+// the admin API it should only be reachable from inside the deployment.
+type InternalConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+// RedisConfig is the Redis auth-service keeps its token revocation list in.
+// The gateway keeps its rate limit counters there as well.
+type RedisConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+// JWTConfig points the gateway at the JWKS published by auth-service.
+type JWTConfig struct {
+	JWKSURL         string        `yaml:"jwksUrl"`
+	Issuer          string        `yaml:"issuer"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+type RouteConfig struct {
+	Name        string         `yaml:"name"`
+	Prefix      string         `yaml:"prefix"`
+	Methods     []string       `yaml:"methods"`
+	Upstream    string         `yaml:"upstream"`
+	Pool        string         `yaml:"pool"`
+	StripPrefix bool           `yaml:"stripPrefix"`
+	Targets     []TargetConfig `yaml:"targets"`
+	Public      bool           `yaml:"public"`
+	Permissions []string       `yaml:"permissions"`
+	RateLimits  []string       `yaml:"rateLimits"`
+
+	Timeout        time.Duration        `yaml:"timeout"`
+	Retry          RetryConfig          `yaml:"retry"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"`
+}
+
+// TargetConfig is one of several upstreams of a route that share its
+// traffic by weight. Canary targets are the ones users with the
+// canary:opt-in permission can opt into.
+type TargetConfig struct {
+	Name     string `yaml:"name"`
+	Upstream string `yaml:"upstream"`
+	Pool     string `yaml:"pool"`
+	Weight   int    `yaml:"weight"`
+	Canary   bool   `yaml:"canary"`
+}
+
+// PoolConfig is a named set of replicas of an upstream that routes, targets
+// and composite parts can use instead of a single upstream URL. Strategy is
+// roundRobin, leastConnections or consistentHash.
+type PoolConfig struct {
+	Name             string                 `yaml:"name"`
+	Strategy         string                 `yaml:"strategy"`
+	Members          []string               `yaml:"members"`
+	HealthCheck      HealthCheckConfig      `yaml:"healthCheck"`
+	OutlierDetection OutlierDetectionConfig `yaml:"outlierDetection"`
+}
+
+// HealthCheckConfig polls Path on every member. A member is taken out after
+// UnhealthyThreshold failed checks in a row and put back after
+// HealthyThreshold passed ones.
+type HealthCheckConfig struct {
+	Path               string        `yaml:"path"`
+	Interval           time.Duration `yaml:"interval"`
+	Timeout            time.Duration `yaml:"timeout"`
+	HealthyThreshold   int           `yaml:"healthyThreshold"`
+	UnhealthyThreshold int           `yaml:"unhealthyThreshold"`
+}
+
+// OutlierDetectionConfig ejects a member for EjectionTime after
+// ConsecutiveFailures failed requests in a row. Only connection errors and
+// 502, 503 and 504 responses count as failures: a 500 comes from a replica
+// that is up and usually from a bug every replica shares, so ejecting it
+// would only move the load onto the others.
+type OutlierDetectionConfig struct {
+	ConsecutiveFailures int           `yaml:"consecutiveFailures"`
+	EjectionTime        time.Duration `yaml:"ejectionTime"`
+}
+
+// RetryConfig retries idempotent requests up to Attempts more times, waiting
+// a jittered, exponentially growing delay starting at Backoff in between.
+type RetryConfig struct {
+	Attempts   int           `yaml:"attempts"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failureThreshold"`
+	OpenTimeout      time.Duration `yaml:"openTimeout"`
+	HalfOpenRequests int           `yaml:"halfOpenRequests"`
+}
+
+// CompositeConfig is a GET endpoint answered by calling every part
+// concurrently and merging their JSON responses. Retry and CircuitBreaker
+// apply to every part, and each part gets a circuit breaker of its own.
+type CompositeConfig struct {
+	Name        string                `yaml:"name"`
+	Path        string                `yaml:"path"`
+	Public      bool                  `yaml:"public"`
+	Permissions []string              `yaml:"permissions"`
+	RateLimits  []string              `yaml:"rateLimits"`
+	Parts       []CompositePartConfig `yaml:"parts"`
+
+	Timeout        time.Duration        `yaml:"timeout"`
+	Retry          RetryConfig          `yaml:"retry"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"`
+}
+
+// CompositePartConfig is one upstream call of a composite. Path may contain
+// {userId} and {email}, which are filled in from the access token. Exclude
+// names top-level fields of the response that are never passed on.
+type CompositePartConfig struct {
+	Key      string   `yaml:"key"`
+	Upstream string   `yaml:"upstream"`
+	Pool     string   `yaml:"pool"`
+	Path     string   `yaml:"path"`
+	Exclude  []string `yaml:"exclude"`
+}
+
+// RateLimitPolicyConfig is a named rate limit that routes refer to. Key is
+// ip, email or apiKey, and Header names the API key header. APIKeys are the
+// hex SHA-256 hashes of the keys that get a budget of their own.
+type RateLimitPolicyConfig struct {
+	Name      string        `yaml:"name"`
+	Algorithm string        `yaml:"algorithm"`
+	Key       string        `yaml:"key"`
+	Header    string        `yaml:"header"`
+	APIKeys   []string      `yaml:"apiKeys"`
+	Limit     int           `yaml:"limit"`
+	Window    time.Duration `yaml:"window"`
+	Burst     int           `yaml:"burst"`
+}
+
+func NewConfiguration() *Config {
+	applicationConfig := &ApplicationConfig{}
+	applicationConfig.readApplicationConfig()
+
+	return &Config{ApplicationConfig: *applicationConfig}
+}
+
+func (c *ApplicationConfig) readApplicationConfig() {
+	env, found := os.LookupEnv("ACTIVE_PROFILE")
+
+	if !found {
+		env = "local"
+	}
+
+	print("ACTIVE_PROFILE: ", env, "\n")
+
+	v := viper.New()
+	v.SetTypeByDefaultValue(true)
+	v.SetConfigName("application")
+	v.SetConfigType("yaml")
+	v.AddConfigPath("./")
+
+	readConfigErr := v.ReadInConfig()
+	if readConfigErr != nil {
+		panic("Couldn't load application configuration, cannot start. Terminating. : " + readConfigErr.Error())
+	}
+
+	sub := v.Sub(env)
+
+	unMarshallErr := sub.Unmarshal(c)
+
+	if unMarshallErr != nil {
+		panic("Configuration cannot deserialize. Terminating. : " + unMarshallErr.Error())
+	}
+}
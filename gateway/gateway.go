@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/gorilla/mux"
+	"log"
+)
+
+type Gateway struct {
+	routes        []*Route
+	composites    []*Composite
+	authenticator *Authenticator
+	rateLimiter   *RateLimiter
+}
+
+func NewGateway(routes []*Route, composites []*Composite, authenticator *Authenticator, rateLimiter *RateLimiter) *Gateway {
+	return &Gateway{
+		routes:        routes,
+		composites:    composites,
+		authenticator: authenticator,
+		rateLimiter:   rateLimiter,
+	}
+}
+
+func (g *Gateway) RegisterRoutes(router *mux.Router) {
+	// Composites are registered first so that they take precedence over a
+	// route whose prefix covers their path.
+	for _, composite := range g.composites {
+		route := composite.Route
+		router.Path(route.Prefix).Methods(route.Methods...).
+			Handler(g.authenticator.Middleware(route, g.rateLimiter.Middleware(route, composite)))
+		log.Printf("Composite %s: %s -> %d parts (public=%t)", route.Name, route.Prefix, len(composite.Parts), route.Public)
+	}
+
+	for _, route := range g.routes {
+		r := router.MatcherFunc(route.match)
+		if len(route.Methods) > 0 {
+			r = r.Methods(route.Methods...)
+		}
+		// Rate limits run after authentication so they can count requests
+		// per authenticated email.
+		r.Handler(g.authenticator.Middleware(route, g.rateLimiter.Middleware(route, NewProxy(route))))
+		log.Printf("Route %s: %s %v -> %d targets (public=%t)", route.Name, route.Prefix, route.Methods, len(route.Split.targets), route.Public)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"authz"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testIssuer = "http://localhost:8081"
+
+type revokedIds map[string]bool
+
+func (r revokedIds) IsRevoked(jti string) (bool, error) {
+	return r[jti], nil
+}
+
+// newEchoUpstream answers with its name and the path and user it was asked
+// for, so a test can tell which route a request went through.
+func newEchoUpstream(t *testing.T, name string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Header().Set("X-Upstream-User", r.Header.Get(authz.UserIdHeader))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey
+}
+
+// newTestAuthenticator serves the public half of a fresh RSA key as a JWKS
+// and returns an authenticator for it together with the private key.
+func newTestAuthenticator(t *testing.T) (*Authenticator, *rsa.PrivateKey) {
+	t.Helper()
+	privateKey := newTestKey(t)
+
+	set := authz.JWKSet{Keys: []authz.JWK{{
+		Kty: "RSA",
+		Kid: "k1",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := JWTConfig{JWKSURL: server.URL, Issuer: testIssuer, RefreshInterval: time.Minute}
+	return NewAuthenticator(cfg, revokedIds{"revoked": true}), privateKey
+}
+
+// signTestToken signs a token for user u1, with its claims changed by edit
+// when given.
+func signTestToken(t *testing.T, key *rsa.PrivateKey, edit func(*authz.AccessClaims)) string {
+	t.Helper()
+	claims := &authz.AccessClaims{
+		Email:       "a@example.com",
+		Permissions: []string{"users:read"},
+		TokenType:   "access",
+		StandardClaims: jwt.StandardClaims{
+			Id:        "jti-1",
+			Issuer:    testIssuer,
+			Subject:   "u1",
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	}
+	if edit != nil {
+		edit(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestGateway(t *testing.T, routeConfigs []RouteConfig, authenticator *Authenticator) http.Handler {
+	t.Helper()
+	routes, err := NewRoutes(routeConfigs, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	NewGateway(routes, nil, authenticator, NewRateLimiter(NewMemoryRateLimitStore())).RegisterRoutes(router)
+	return router
+}
+
+func TestGatewayRouting(t *testing.T) {
+	authenticator, _ := newTestAuthenticator(t)
+	router := newTestGateway(t, []RouteConfig{
+		{Name: "users", Prefix: "/users", Upstream: newEchoUpstream(t, "users"), Public: true},
+		{Name: "users-admin", Prefix: "/users/admin/", Upstream: newEchoUpstream(t, "users-admin"), StripPrefix: true, Public: true},
+		{Name: "orders", Prefix: "/orders", Methods: []string{"get", "post"}, Upstream: newEchoUpstream(t, "orders"), Public: true},
+	}, authenticator)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		wantStatus   int
+		wantUpstream string
+		wantPath     string
+	}{
+		{"prefix itself", http.MethodGet, "/users", http.StatusOK, "users", "/users"},
+		{"below the prefix", http.MethodGet, "/users/1", http.StatusOK, "users", "/users/1"},
+		{"prefix of another word", http.MethodGet, "/usersettings", http.StatusNotFound, "", ""},
+		{"no route", http.MethodGet, "/products", http.StatusNotFound, "", ""},
+		{"longest prefix wins", http.MethodGet, "/users/admin/stats", http.StatusOK, "users-admin", "/stats"},
+		{"stripped to the root", http.MethodGet, "/users/admin", http.StatusOK, "users-admin", "/"},
+		{"allowed method", http.MethodPost, "/orders", http.StatusOK, "orders", "/orders"},
+		{"other method", http.MethodDelete, "/orders/1", http.StatusMethodNotAllowed, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("X-Upstream"); got != tt.wantUpstream {
+				t.Errorf("upstream %q, want %q", got, tt.wantUpstream)
+			}
+			if got := w.Header().Get("X-Upstream-Path"); got != tt.wantPath {
+				t.Errorf("upstream path %q, want %q", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestGatewayAuthentication(t *testing.T) {
+	authenticator, key := newTestAuthenticator(t)
+	router := newTestGateway(t, []RouteConfig{
+		{Name: "login", Prefix: "/auth/login", Upstream: newEchoUpstream(t, "auth"), Public: true},
+		{Name: "users", Prefix: "/users", Upstream: newEchoUpstream(t, "users"), Permissions: []string{"users:read"}},
+	}, authenticator)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+		wantUser   string
+	}{
+		{name: "public without a token", path: "/auth/login", wantStatus: http.StatusOK},
+		{name: "public with a token", path: "/auth/login", token: signTestToken(t, key, nil), wantStatus: http.StatusOK},
+		{name: "authenticated without a token", path: "/users", wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", path: "/users", token: "not-a-token", wantStatus: http.StatusUnauthorized},
+		{name: "tampered token", path: "/users", token: signTestToken(t, newTestKey(t), nil), wantStatus: http.StatusUnauthorized},
+		{name: "other issuer", path: "/users", token: signTestToken(t, key, func(c *authz.AccessClaims) { c.Issuer = "http://evil.example.com" }), wantStatus: http.StatusUnauthorized},
+		{name: "expired token", path: "/users", token: signTestToken(t, key, func(c *authz.AccessClaims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() }), wantStatus: http.StatusUnauthorized},
+		{name: "ID token", path: "/users", token: signTestToken(t, key, func(c *authz.AccessClaims) { c.TokenType = "" }), wantStatus: http.StatusUnauthorized},
+		{name: "token granted to a client", path: "/users", token: signTestToken(t, key, func(c *authz.AccessClaims) { c.Audience = "web" }), wantStatus: http.StatusUnauthorized},
+		{name: "revoked token", path: "/users", token: signTestToken(t, key, func(c *authz.AccessClaims) { c.Id = "revoked" }), wantStatus: http.StatusUnauthorized},
+		{name: "missing permission", path: "/users", token: signTestToken(t, key, func(c *authz.AccessClaims) { c.Permissions = []string{"orders:read"} }), wantStatus: http.StatusForbidden},
+		{name: "valid token", path: "/users", token: signTestToken(t, key, nil), wantStatus: http.StatusOK, wantUser: "u1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			// Identity headers sent by the client must never reach an
+			// upstream.
+			r.Header.Set(authz.UserIdHeader, "admin")
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("X-Upstream-User"); got != tt.wantUser {
+				t.Errorf("upstream saw user %q, want %q", got, tt.wantUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"authz"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+func main() {
+	cfg := NewConfiguration()
+
+	rateLimits, err := NewRateLimitPolicies(cfg.RateLimits)
+	if err != nil {
+		log.Fatalf("Error loading rate limits: %v", err)
+	}
+
+	pools, err := NewUpstreamPools(cfg.Pools)
+	if err != nil {
+		log.Fatalf("Error loading pools: %v", err)
+	}
+
+	routes, err := NewRoutes(cfg.Routes, rateLimits, pools)
+	if err != nil {
+		log.Fatalf("Error loading routes: %v", err)
+	}
+
+	composites, err := NewComposites(cfg.Composites, rateLimits, pools)
+	if err != nil {
+		log.Fatalf("Error loading composites: %v", err)
+	}
+
+	router := mux.NewRouter()
+
+	redisClient := InitializeRedis(cfg.Redis)
+	authenticator := NewAuthenticator(cfg.JWT, authz.NewRedisRevocationList(redisClient))
+	rateLimiter := NewRateLimiter(NewRedisRateLimitStore(redisClient))
+	gateway := NewGateway(routes, composites, authenticator, rateLimiter)
+	gateway.RegisterRoutes(router)
+
+	splitter := NewTrafficSplitter(routes, NewRedisTrafficSplitStore(redisClient))
+	splitter.Start()
+	for _, pool := range pools {
+		pool.Start()
+	}
+
+	if cfg.Admin.Addr != "" {
+		adminRouter := mux.NewRouter()
+		NewAdminController(routes, composites, splitter, pools).RegisterRoutes(adminRouter)
+		go func() {
+			log.Printf("Admin API is running on %s", cfg.Admin.Addr)
+			if err := http.ListenAndServe(cfg.Admin.Addr, adminRouter); err != nil {
+				log.Fatalf("Could not start admin server: %v\n", err)
+			}
+		}()
+	}
+
+	if cfg.Internal.Addr != "" {
+		poolProxy := NewPoolProxy(pools)
+		go func() {
+			log.Printf("Pool proxy is running on %s", cfg.Internal.Addr)
+			if err := http.ListenAndServe(cfg.Internal.Addr, poolProxy); err != nil {
+				log.Fatalf("Could not start pool proxy: %v\n", err)
+			}
+		}()
+	}
+
+	log.Printf("Server is running on port %s", cfg.Server.Port)
+	if err := http.ListenAndServe(":"+cfg.Server.Port, router); err != nil {
+		log.Fatalf("Could not start server: %v\n", err)
+	}
+}
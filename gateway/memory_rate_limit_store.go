@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type memoryBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+// MemoryRateLimitStore applies the same algorithms as RedisRateLimitStore to
+// counters kept in process memory. It is meant for tests and single-instance
+// local runs; expired counters are never removed.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]memoryBucket
+	windows map[string][]time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]memoryBucket),
+		windows: make(map[string][]time.Time),
+	}
+}
+
+func (s *MemoryRateLimitStore) Peek(key string, policy *RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	return s.run(key, policy, now, false)
+}
+
+func (s *MemoryRateLimitStore) Take(key string, policy *RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	return s.run(key, policy, now, true)
+}
+
+func (s *MemoryRateLimitStore) run(key string, policy *RateLimitPolicy, now time.Time, take bool) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch policy.Algorithm {
+	case TokenBucketAlgorithm:
+		return s.tokenBucket(key, policy, now, take), nil
+	case SlidingWindowAlgorithm:
+		return s.slidingWindow(key, policy, now, take), nil
+	default:
+		return RateLimitResult{}, fmt.Errorf("unknown rate limit algorithm %q", policy.Algorithm)
+	}
+}
+
+func (s *MemoryRateLimitStore) tokenBucket(key string, policy *RateLimitPolicy, now time.Time, take bool) RateLimitResult {
+	capacity := float64(policy.Burst)
+	rate := float64(policy.Limit) / float64(policy.Window)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = memoryBucket{tokens: capacity, ts: now}
+	}
+	tokens := math.Min(capacity, bucket.tokens+math.Max(0, float64(now.Sub(bucket.ts)))*rate)
+
+	result := RateLimitResult{}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - tokens) / rate))
+	}
+	result.Remaining = int(tokens)
+	result.Reset = time.Duration(math.Ceil((capacity - tokens) / rate))
+
+	if take {
+		s.buckets[key] = memoryBucket{tokens: tokens, ts: now}
+	}
+	return result
+}
+
+func (s *MemoryRateLimitStore) slidingWindow(key string, policy *RateLimitPolicy, now time.Time, take bool) RateLimitResult {
+	requests := s.windows[key]
+	for len(requests) > 0 && !requests[0].After(now.Add(-policy.Window)) {
+		requests = requests[1:]
+	}
+	s.windows[key] = requests
+
+	result := RateLimitResult{Reset: policy.Window}
+	if len(requests) > 0 {
+		result.Reset = requests[0].Add(policy.Window).Sub(now)
+	}
+	count := len(requests)
+	if count < policy.Limit {
+		count++
+		result.Allowed = true
+		if take {
+			s.windows[key] = append(requests, now)
+		}
+	} else {
+		result.RetryAfter = result.Reset
+	}
+	result.Remaining = policy.Limit - count
+	return result
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"authz"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// poolContextKey holds the pool a request to the pool proxy is for.
+type poolContextKey struct{}
+
+// PoolProxy lets services call each other through the upstream pools, so
+// their calls are balanced, health checked and ejected the same way as
+// routed traffic. A request for /{pool}/path is sent to path on a member of
+// the pool, untouched apart from the identity headers. It is served on the
+// internal listener, which only services should reach.
+type PoolProxy struct {
+	pools        map[string]*UpstreamPool
+	reverseProxy *httputil.ReverseProxy
+}
+
+func NewPoolProxy(pools map[string]*UpstreamPool) *PoolProxy {
+	p := &PoolProxy{pools: pools}
+	p.reverseProxy = &httputil.ReverseProxy{
+		Rewrite:      p.rewrite,
+		ErrorHandler: p.handleError,
+		Transport:    &poolTransport{transport: http.DefaultTransport},
+	}
+	return p
+}
+
+func (p *PoolProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, _ := splitPoolPath(r.URL.Path)
+	pool, ok := p.pools[name]
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "Not found", "There is no pool named "+name+".")
+		return
+	}
+	for _, header := range authz.IdentityHeaders {
+		r.Header.Del(header)
+	}
+
+	ctx := context.WithValue(r.Context(), poolContextKey{}, pool)
+	p.reverseProxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// rewrite keeps the path escaped as it was sent, so that an escaped slash in
+// a path parameter such as an email stays one.
+func (p *PoolProxy) rewrite(pr *httputil.ProxyRequest) {
+	_, rawPath := splitPoolPath(pr.In.URL.EscapedPath())
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		path = rawPath
+	}
+	pr.Out.URL.Path = path
+	pr.Out.URL.RawPath = rawPath
+	pr.SetXForwarded()
+}
+
+func (p *PoolProxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	pool := r.Context().Value(poolContextKey{}).(*UpstreamPool)
+	log.Printf("Pool proxy error: pool=%s path=%s err=%v", pool.Name, r.URL.Path, err)
+
+	if errors.Is(err, ErrNoHealthyUpstream) {
+		writeProblem(w, http.StatusServiceUnavailable, "Service unavailable",
+			"Pool "+pool.Name+" has no healthy members.")
+		return
+	}
+	writeProblem(w, http.StatusBadGateway, "Bad gateway",
+		"No member of pool "+pool.Name+" could be reached.")
+}
+
+// splitPoolPath splits /{pool}/path into the pool name and /path.
+func splitPoolPath(path string) (string, string) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return name, "/" + rest
+}
+
+// poolTransport sends a request to a member of the pool in its context.
+type poolTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *poolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pool := req.Context().Value(poolContextKey{}).(*UpstreamPool)
+	member, err := pool.Pick(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.transport.RoundTrip(member.request(req))
+	canceled := err != nil && errors.Is(req.Context().Err(), context.Canceled)
+	pool.Done(member, !canceled && (err != nil || upstreamFailure(resp.StatusCode)))
+	return resp, err
+}
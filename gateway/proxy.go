@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+)
+
+// Problem is an RFC 7807 problem details body, used for the errors the
+// gateway itself returns for an upstream.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// targetContextKey holds the target picked for a request until it is
+// rewritten.
+type targetContextKey struct{}
+
+type Proxy struct {
+	route        *Route
+	reverseProxy *httputil.ReverseProxy
+}
+
+func NewProxy(route *Route) *Proxy {
+	p := &Proxy{route: route}
+	p.reverseProxy = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.handleError,
+		Transport:      NewUpstreamTransport(route),
+	}
+	return p
+}
+
+// ServeHTTP bounds the whole exchange with the upstream, retries and
+// response body included, by the route's timeout.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), p.route.Timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, targetContextKey{}, p.route.Split.Pick(r))
+	p.reverseProxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// rewrite only sets the path; the transport points every attempt at a pool
+// member. It is called after the reverse proxy has already removed
+// hop-by-hop headers (Connection, Keep-Alive, Upgrade, ... and anything
+// listed in Connection) from the outbound request. Cookies, including refresh_token,
+// are end-to-end headers and are forwarded untouched.
+func (p *Proxy) rewrite(pr *httputil.ProxyRequest) {
+	pr.Out.URL.Path = p.route.UpstreamPath(pr.In.URL.Path)
+	pr.Out.URL.RawPath = ""
+	pr.SetXForwarded()
+}
+
+// modifyResponse keeps cookies issued by an upstream scoped to the gateway
+// path the client actually used when the route prefix is stripped.
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	if !p.route.StripPrefix {
+		return nil
+	}
+
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return nil
+	}
+
+	resp.Header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		if cookie.Path != "" && strings.HasPrefix(cookie.Path, "/") {
+			cookie.Path = p.route.Prefix + cookie.Path
+		}
+		resp.Header.Add("Set-Cookie", cookie.String())
+	}
+	return nil
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Upstream error: route=%s path=%s err=%v", p.route.Name, r.URL.Path, err)
+
+	var openErr *CircuitOpenError
+	switch {
+	case errors.As(err, &openErr):
+		w.Header().Set("Retry-After", strconv.Itoa(seconds(openErr.RetryAfter)))
+		writeProblem(w, http.StatusServiceUnavailable, "Service unavailable",
+			"The "+openErr.Target+" upstream of route "+p.route.Name+" is failing and is not being called for now.")
+	case errors.Is(err, ErrNoHealthyUpstream):
+		writeProblem(w, http.StatusServiceUnavailable, "Service unavailable",
+			"The upstream of route "+p.route.Name+" has no healthy members.")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeProblem(w, http.StatusGatewayTimeout, "Gateway timeout",
+			"The upstream of route "+p.route.Name+" did not respond in time.")
+	default:
+		writeProblem(w, http.StatusBadGateway, "Bad gateway",
+			"The upstream of route "+p.route.Name+" could not be reached.")
+	}
+}
+
+func writeProblem(w http.ResponseWriter, status int, title string, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:   "about:blank",
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	})
+}
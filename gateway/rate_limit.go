@@ -0,0 +1,238 @@
+package main
+
+import (
+	"authz"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TokenBucketAlgorithm   = "tokenBucket"
+	SlidingWindowAlgorithm = "slidingWindow"
+
+	IPRateLimitKey     = "ip"
+	EmailRateLimitKey  = "email"
+	APIKeyRateLimitKey = "apiKey"
+
+	defaultAPIKeyHeader = "X-API-Key"
+)
+
+// RateLimitPolicy allows Limit requests per Window for each client
+// identity. A token bucket refills at that rate and holds up to Burst
+// tokens, while a sliding window never lets more than Limit requests through
+// in any Window.
+type RateLimitPolicy struct {
+	Name      string
+	Algorithm string
+	Key       string
+	Header    string
+	APIKeys   map[string]bool
+	Limit     int
+	Window    time.Duration
+	Burst     int
+}
+
+func NewRateLimitPolicies(policyConfigs []RateLimitPolicyConfig) (map[string]*RateLimitPolicy, error) {
+	policies := make(map[string]*RateLimitPolicy, len(policyConfigs))
+	for _, pc := range policyConfigs {
+		policy, err := newRateLimitPolicy(pc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q: %w", pc.Name, err)
+		}
+		if _, ok := policies[policy.Name]; ok {
+			return nil, fmt.Errorf("duplicate rate limit %q", policy.Name)
+		}
+		policies[policy.Name] = policy
+	}
+	return policies, nil
+}
+
+func newRateLimitPolicy(pc RateLimitPolicyConfig) (*RateLimitPolicy, error) {
+	if pc.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if pc.Algorithm != TokenBucketAlgorithm && pc.Algorithm != SlidingWindowAlgorithm {
+		return nil, fmt.Errorf("algorithm must be %s or %s", TokenBucketAlgorithm, SlidingWindowAlgorithm)
+	}
+	if pc.Key != IPRateLimitKey && pc.Key != EmailRateLimitKey && pc.Key != APIKeyRateLimitKey {
+		return nil, fmt.Errorf("key must be %s, %s or %s", IPRateLimitKey, EmailRateLimitKey, APIKeyRateLimitKey)
+	}
+	if pc.Limit <= 0 || pc.Window <= 0 {
+		return nil, fmt.Errorf("limit and window must be positive")
+	}
+	if pc.Burst < 0 || (pc.Burst > 0 && pc.Algorithm != TokenBucketAlgorithm) {
+		return nil, fmt.Errorf("burst only applies to a token bucket")
+	}
+	if pc.Key == APIKeyRateLimitKey && len(pc.APIKeys) == 0 {
+		return nil, fmt.Errorf("an apiKey policy needs the hashes of its API keys")
+	}
+
+	apiKeys := make(map[string]bool, len(pc.APIKeys))
+	for _, hash := range pc.APIKeys {
+		if len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("API key hash %q is not a hex SHA-256 hash", hash)
+		}
+		apiKeys[strings.ToLower(hash)] = true
+	}
+
+	burst := pc.Burst
+	if burst == 0 {
+		burst = pc.Limit
+	}
+	header := pc.Header
+	if header == "" {
+		header = defaultAPIKeyHeader
+	}
+
+	return &RateLimitPolicy{
+		Name:      pc.Name,
+		Algorithm: pc.Algorithm,
+		Key:       pc.Key,
+		Header:    header,
+		APIKeys:   apiKeys,
+		Limit:     pc.Limit,
+		Window:    pc.Window,
+		Burst:     burst,
+	}, nil
+}
+
+// Capacity is the number of requests a client can make at once.
+func (p *RateLimitPolicy) Capacity() int {
+	if p.Algorithm == TokenBucketAlgorithm {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+// Identity returns who the request is counted against. Requests without an
+// authenticated email or a known API key are counted against their IP, so
+// that sending made up keys does not get a client a fresh budget.
+func (p *RateLimitPolicy) Identity(r *http.Request) string {
+	switch p.Key {
+	case EmailRateLimitKey:
+		if email := r.Header.Get(authz.UserEmailHeader); email != "" {
+			return "email:" + email
+		}
+	case APIKeyRateLimitKey:
+		if apiKey := r.Header.Get(p.Header); apiKey != "" {
+			// Only a hash of the key ends up in Redis.
+			sum := sha256.Sum256([]byte(apiKey))
+			if hash := hex.EncodeToString(sum[:]); p.APIKeys[hash] {
+				return "api-key:" + hash
+			}
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP is the address of the connecting client. The gateway is the
+// edge, so X-Forwarded-For comes from the client and cannot be trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// IRateLimitStore checks the budget kept under a key. Take uses up one
+// request of it when the request is allowed, Peek only reports whether it
+// would be.
+type IRateLimitStore interface {
+	Peek(string, *RateLimitPolicy, time.Time) (RateLimitResult, error)
+	Take(string, *RateLimitPolicy, time.Time) (RateLimitResult, error)
+}
+
+type RateLimiter struct {
+	store IRateLimitStore
+}
+
+func NewRateLimiter(store IRateLimitStore) *RateLimiter {
+	return &RateLimiter{store: store}
+}
+
+// Middleware applies the policies of the route and reports the most
+// restrictive one in the RateLimit-* headers. Every policy is checked before
+// any is charged, so a request that one policy denies does not use up the
+// budget of the others. Two requests racing between the check and the charge
+// may both pass the check; the charge then decides. The route is left
+// unthrottled when the store is unavailable rather than failing every
+// request.
+func (l *RateLimiter) Middleware(route *Route, next http.Handler) http.Handler {
+	if len(route.RateLimits) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+
+		limiting, result := l.evaluate(route, r, now, l.store.Peek)
+		if limiting != nil && result.Allowed {
+			limiting, result = l.evaluate(route, r, now, l.store.Take)
+		}
+
+		if limiting != nil {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limiting.Capacity()))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limiting.Limit, seconds(limiting.Window)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// evaluate runs check for every policy of the route and returns the most
+// restrictive result.
+func (l *RateLimiter) evaluate(route *Route, r *http.Request, now time.Time,
+	check func(string, *RateLimitPolicy, time.Time) (RateLimitResult, error)) (*RateLimitPolicy, RateLimitResult) {
+	var limiting *RateLimitPolicy
+	var result RateLimitResult
+	for _, policy := range route.RateLimits {
+		key := route.Name + ":" + policy.Name + ":" + policy.Identity(r)
+		res, err := check(key, policy, now)
+		if err != nil {
+			log.Printf("Rate limit unavailable: route=%s policy=%s err=%v", route.Name, policy.Name, err)
+			continue
+		}
+		if limiting == nil || moreRestrictive(res, result) {
+			limiting, result = policy, res
+		}
+	}
+	return limiting, result
+}
+
+func moreRestrictive(a RateLimitResult, b RateLimitResult) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"authz"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestPolicy(t *testing.T, pc RateLimitPolicyConfig) *RateLimitPolicy {
+	t.Helper()
+	if pc.Name == "" {
+		pc.Name = pc.Algorithm
+	}
+	if pc.Key == "" {
+		pc.Key = IPRateLimitKey
+	}
+	policy, err := newRateLimitPolicy(pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+// rateLimitStep takes a request at offset from the start of the test.
+type rateLimitStep struct {
+	at         time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RateLimitPolicyConfig
+		steps  []rateLimitStep
+	}{
+		{
+			name:   "token bucket allows a burst",
+			policy: RateLimitPolicyConfig{Algorithm: TokenBucketAlgorithm, Limit: 2, Window: time.Second, Burst: 3},
+			steps: []rateLimitStep{
+				{at: 0, allowed: true, remaining: 2},
+				{at: 0, allowed: true, remaining: 1},
+				{at: 0, allowed: true, remaining: 0},
+				{at: 0, allowed: false, retryAfter: 500 * time.Millisecond},
+			},
+		},
+		{
+			name:   "token bucket refills at the limit rate",
+			policy: RateLimitPolicyConfig{Algorithm: TokenBucketAlgorithm, Limit: 2, Window: time.Second, Burst: 2},
+			steps: []rateLimitStep{
+				{at: 0, allowed: true, remaining: 1},
+				{at: 0, allowed: true, remaining: 0},
+				{at: 250 * time.Millisecond, allowed: false, retryAfter: 250 * time.Millisecond},
+				{at: 500 * time.Millisecond, allowed: true, remaining: 0},
+				{at: 2 * time.Second, allowed: true, remaining: 1},
+			},
+		},
+		{
+			name:   "sliding window",
+			policy: RateLimitPolicyConfig{Algorithm: SlidingWindowAlgorithm, Limit: 2, Window: time.Second},
+			steps: []rateLimitStep{
+				{at: 0, allowed: true, remaining: 1},
+				{at: 400 * time.Millisecond, allowed: true, remaining: 0},
+				{at: 600 * time.Millisecond, allowed: false, retryAfter: 400 * time.Millisecond},
+				{at: time.Second, allowed: true, remaining: 0},
+				{at: 1100 * time.Millisecond, allowed: false, retryAfter: 300 * time.Millisecond},
+				{at: 1400 * time.Millisecond, allowed: true, remaining: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryRateLimitStore()
+			policy := newTestPolicy(t, tt.policy)
+			start := time.Now()
+
+			for i, step := range tt.steps {
+				now := start.Add(step.at)
+				peeked, err := store.Peek("k", policy, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := store.Take("k", policy, now)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if result != peeked {
+					t.Errorf("step %d: Peek() = %+v, Take() = %+v", i, peeked, result)
+				}
+				if result.Allowed != step.allowed {
+					t.Fatalf("step %d: allowed %t, want %t", i, result.Allowed, step.allowed)
+				}
+				if step.allowed && result.Remaining != step.remaining {
+					t.Errorf("step %d: remaining %d, want %d", i, result.Remaining, step.remaining)
+				}
+				if result.RetryAfter != step.retryAfter {
+					t.Errorf("step %d: retry after %s, want %s", i, result.RetryAfter, step.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitPolicyIdentity(t *testing.T) {
+	sum := sha256.Sum256([]byte("key-1"))
+	apiKeyHash := hex.EncodeToString(sum[:])
+	emailPolicy := newTestPolicy(t, RateLimitPolicyConfig{Algorithm: SlidingWindowAlgorithm, Key: EmailRateLimitKey, Limit: 1, Window: time.Second})
+	apiKeyPolicy := newTestPolicy(t, RateLimitPolicyConfig{Algorithm: SlidingWindowAlgorithm, Key: APIKeyRateLimitKey,
+		APIKeys: []string{apiKeyHash}, Limit: 1, Window: time.Second})
+	ipPolicy := newTestPolicy(t, RateLimitPolicyConfig{Algorithm: SlidingWindowAlgorithm, Limit: 1, Window: time.Second})
+
+	tests := []struct {
+		name   string
+		policy *RateLimitPolicy
+		header string
+		value  string
+		want   string
+	}{
+		{"email", emailPolicy, authz.UserEmailHeader, "a@example.com", "email:a@example.com"},
+		{"email of an anonymous request", emailPolicy, "", "", "ip:203.0.113.7"},
+		{"known API key", apiKeyPolicy, defaultAPIKeyHeader, "key-1", "api-key:" + apiKeyHash},
+		{"unknown API key", apiKeyPolicy, defaultAPIKeyHeader, "key-2", "ip:203.0.113.7"},
+		{"missing API key", apiKeyPolicy, "", "", "ip:203.0.113.7"},
+		{"ip ignores identity headers", ipPolicy, authz.UserEmailHeader, "a@example.com", "ip:203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			r.RemoteAddr = "203.0.113.7:1234"
+			r.Header.Set("X-Forwarded-For", "198.51.100.1")
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+
+			if got := tt.policy.Identity(r); got != tt.want {
+				t.Errorf("Identity() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Peek(string, *RateLimitPolicy, time.Time) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store down")
+}
+
+func (failingRateLimitStore) Take(string, *RateLimitPolicy, time.Time) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store down")
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	burst := newTestPolicy(t, RateLimitPolicyConfig{Name: "burst", Algorithm: TokenBucketAlgorithm, Limit: 5, Window: time.Minute})
+	strict := newTestPolicy(t, RateLimitPolicyConfig{Name: "strict", Algorithm: SlidingWindowAlgorithm, Limit: 2, Window: time.Minute})
+	route := &Route{Name: "orders", RateLimits: []*RateLimitPolicy{burst, strict}}
+
+	store := NewMemoryRateLimitStore()
+	handler := NewRateLimiter(store).Middleware(route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		want          int
+		wantLimit     string
+		wantRemaining string
+	}{
+		{http.StatusOK, "2", "1"},
+		{http.StatusOK, "2", "0"},
+		{http.StatusTooManyRequests, "2", "0"},
+		{http.StatusTooManyRequests, "2", "0"},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("request %d: status %d, want %d", i, w.Code, tt.want)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != tt.wantLimit {
+			t.Errorf("request %d: RateLimit-Limit %s, want %s", i, got, tt.wantLimit)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+			t.Errorf("request %d: RateLimit-Remaining %s, want %s", i, got, tt.wantRemaining)
+		}
+		if got := w.Header().Get("Retry-After") != ""; got != (tt.want == http.StatusTooManyRequests) {
+			t.Errorf("request %d: Retry-After sent %t", i, got)
+		}
+	}
+
+	// The requests the strict policy denied were not charged to the burst.
+	result, err := store.Peek("orders:burst:ip:192.0.2.1", burst, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Remaining != 2 {
+		t.Errorf("burst has %d requests left, want 2", result.Remaining)
+	}
+}
+
+func TestRateLimiterMiddlewareStoreUnavailable(t *testing.T) {
+	policy := newTestPolicy(t, RateLimitPolicyConfig{Algorithm: SlidingWindowAlgorithm, Limit: 1, Window: time.Minute})
+	route := &Route{Name: "orders", RateLimits: []*RateLimitPolicy{policy}}
+	handler := NewRateLimiter(failingRateLimitStore{}).Middleware(route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("request %d: status %d, want %d", i, w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "" {
+			t.Errorf("request %d: RateLimit-Limit %s sent without a store", i, got)
+		}
+	}
+}
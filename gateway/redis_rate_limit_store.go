@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const rateLimitPrefix = "rate-limit:"
+
+// tokenBucketScript refills the bucket for the time passed since the last
+// request, then takes a token if there is one. Unless ARGV[4] is 1 the bucket
+// is left as it was. It returns whether the request is allowed, the tokens
+// left, the milliseconds until the bucket is full again and the milliseconds
+// until the next token.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+local reset = math.ceil((capacity - tokens) / rate)
+if ARGV[4] == '1' then
+	redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+	redis.call('PEXPIRE', KEYS[1], reset + 1000)
+end
+
+local retry = 0
+if allowed == 0 then
+	retry = math.ceil((1 - tokens) / rate)
+end
+return {allowed, math.floor(tokens), reset, retry}
+`)
+
+// slidingWindowScript keeps the time of every request let through in the
+// last window in a sorted set. The request is only added when ARGV[5] is 1.
+// It returns whether the request is allowed, the requests left, and the
+// milliseconds until the oldest request leaves the window.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+if count < limit then
+	count = count + 1
+	allowed = 1
+end
+
+local reset = window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+if allowed == 1 and ARGV[5] == '1' then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+end
+
+local retry = 0
+if allowed == 0 then
+	retry = reset
+end
+return {allowed, limit - count, reset, retry}
+`)
+
+// RedisRateLimitStore keeps the counters in Redis so that every gateway
+// replica shares the same budget. Each check runs as a script, which makes
+// it atomic.
+type RedisRateLimitStore struct {
+	client *redis.Client
+}
+
+func NewRedisRateLimitStore(client *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+func (s *RedisRateLimitStore) Peek(key string, policy *RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	return s.run(key, policy, now, false)
+}
+
+func (s *RedisRateLimitStore) Take(key string, policy *RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	return s.run(key, policy, now, true)
+}
+
+func (s *RedisRateLimitStore) run(key string, policy *RateLimitPolicy, now time.Time, take bool) (RateLimitResult, error) {
+	ctx := context.Background()
+	takeArg := 0
+	if take {
+		takeArg = 1
+	}
+	windowMs := policy.Window.Milliseconds()
+
+	var values []int64
+	var err error
+	switch policy.Algorithm {
+	case TokenBucketAlgorithm:
+		rate := float64(policy.Limit) / float64(windowMs)
+		values, err = tokenBucketScript.Run(ctx, s.client, []string{rateLimitPrefix + key},
+			policy.Burst, rate, now.UnixMilli(), takeArg).Int64Slice()
+	case SlidingWindowAlgorithm:
+		values, err = slidingWindowScript.Run(ctx, s.client, []string{rateLimitPrefix + key},
+			policy.Limit, windowMs, now.UnixMilli(), requestId(), takeArg).Int64Slice()
+	default:
+		return RateLimitResult{}, fmt.Errorf("unknown rate limit algorithm %q", policy.Algorithm)
+	}
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(values) != 4 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+
+	return RateLimitResult{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// requestId tells apart requests that arrive in the same millisecond.
+func requestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
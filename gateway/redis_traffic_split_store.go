@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+const trafficSplitPrefix = "traffic-split:"
+
+// RedisTrafficSplitStore keeps the weights of each route in a hash of target
+// names to weights.
+type RedisTrafficSplitStore struct {
+	client *redis.Client
+}
+
+func NewRedisTrafficSplitStore(client *redis.Client) *RedisTrafficSplitStore {
+	return &RedisTrafficSplitStore{client: client}
+}
+
+func (s *RedisTrafficSplitStore) Load(route string) (map[string]int, error) {
+	values, err := s.client.HGetAll(context.Background(), trafficSplitPrefix+route).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	weights := make(map[string]int, len(values))
+	for name, value := range values {
+		weight, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		weights[name] = weight
+	}
+	return weights, nil
+}
+
+func (s *RedisTrafficSplitStore) Save(route string, weights map[string]int) error {
+	values := make(map[string]interface{}, len(weights))
+	for name, weight := range weights {
+		values[name] = weight
+	}
+	return s.client.HSet(context.Background(), trafficSplitPrefix+route, values).Err()
+}
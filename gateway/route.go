@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout    = 30 * time.Second
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+)
+
+type Route struct {
+	Name        string
+	Prefix      string
+	Methods     []string
+	Split       *TrafficSplit
+	StripPrefix bool
+	Public      bool
+	Permissions []string
+	RateLimits  []*RateLimitPolicy
+	Timeout     time.Duration
+	Retry       RetryPolicy
+}
+
+type RetryPolicy struct {
+	Attempts    int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func NewRoutes(routeConfigs []RouteConfig, rateLimits map[string]*RateLimitPolicy, pools map[string]*UpstreamPool) ([]*Route, error) {
+	routes := make([]*Route, 0, len(routeConfigs))
+	for _, rc := range routeConfigs {
+		route, err := newRoute(rc, rateLimits, pools)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %q: %w", rc.Name, err)
+		}
+		routes = append(routes, route)
+	}
+
+	// Longest prefix wins, so more specific routes must be matched first.
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Prefix) > len(routes[j].Prefix)
+	})
+
+	return routes, nil
+}
+
+func newRoute(rc RouteConfig, rateLimits map[string]*RateLimitPolicy, pools map[string]*UpstreamPool) (*Route, error) {
+	if rc.Prefix == "" || !strings.HasPrefix(rc.Prefix, "/") {
+		return nil, fmt.Errorf("prefix must start with /")
+	}
+
+	split, err := newTrafficSplit(rc, pools)
+	if err != nil {
+		return nil, err
+	}
+
+	if rc.Public && len(rc.Permissions) > 0 {
+		return nil, fmt.Errorf("a public route cannot require permissions")
+	}
+
+	methods := make([]string, 0, len(rc.Methods))
+	for _, method := range rc.Methods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+
+	if rc.Timeout < 0 {
+		return nil, fmt.Errorf("timeout cannot be negative")
+	}
+	timeout := rc.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	retry, err := newRetryPolicy(rc.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := findRateLimits(rc.RateLimits, rateLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Route{
+		Name:        rc.Name,
+		Prefix:      strings.TrimSuffix(rc.Prefix, "/"),
+		Methods:     methods,
+		Split:       split,
+		StripPrefix: rc.StripPrefix,
+		Public:      rc.Public,
+		Permissions: rc.Permissions,
+		RateLimits:  policies,
+		Timeout:     timeout,
+		Retry:       retry,
+	}, nil
+}
+
+func newRetryPolicy(rc RetryConfig) (RetryPolicy, error) {
+	if rc.Attempts < 0 || rc.Backoff < 0 || rc.MaxBackoff < 0 {
+		return RetryPolicy{}, fmt.Errorf("retries cannot be negative")
+	}
+	retry := RetryPolicy{
+		Attempts:    rc.Attempts,
+		BaseBackoff: rc.Backoff,
+		MaxBackoff:  rc.MaxBackoff,
+	}
+	if retry.BaseBackoff == 0 {
+		retry.BaseBackoff = defaultBackoff
+	}
+	if retry.MaxBackoff == 0 {
+		retry.MaxBackoff = defaultMaxBackoff
+	}
+	return retry, nil
+}
+
+// newTrafficSplit takes either a single upstream or pool, or a list of
+// weighted targets.
+func newTrafficSplit(rc RouteConfig, pools map[string]*UpstreamPool) (*TrafficSplit, error) {
+	if len(rc.Targets) == 0 {
+		pool, err := findPool(rc.Upstream, rc.Pool, pools)
+		if err != nil {
+			return nil, err
+		}
+		target := &Target{Name: "default", Pool: pool, Breaker: NewCircuitBreaker(rc.Name, "default", rc.CircuitBreaker)}
+		return NewTrafficSplit(rc.Name, []*Target{target}, []int{1}), nil
+	}
+	if rc.Upstream != "" || rc.Pool != "" {
+		return nil, fmt.Errorf("a route with targets cannot have an upstream or pool")
+	}
+
+	targets := make([]*Target, 0, len(rc.Targets))
+	weights := make([]int, 0, len(rc.Targets))
+	total := 0
+	for _, tc := range rc.Targets {
+		if tc.Name == "" {
+			return nil, fmt.Errorf("target needs a name")
+		}
+		for _, target := range targets {
+			if target.Name == tc.Name {
+				return nil, fmt.Errorf("duplicate target %q", tc.Name)
+			}
+		}
+		pool, err := findPool(tc.Upstream, tc.Pool, pools)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", tc.Name, err)
+		}
+		if tc.Weight < 0 {
+			return nil, fmt.Errorf("weight of target %q cannot be negative", tc.Name)
+		}
+		total += tc.Weight
+		targets = append(targets, &Target{
+			Name:    tc.Name,
+			Pool:    pool,
+			Canary:  tc.Canary,
+			Breaker: NewCircuitBreaker(rc.Name, tc.Name, rc.CircuitBreaker),
+		})
+		weights = append(weights, tc.Weight)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one target needs a weight")
+	}
+	return NewTrafficSplit(rc.Name, targets, weights), nil
+}
+
+// findPool returns the named pool, or a pool of just the upstream URL.
+func findPool(upstream string, name string, pools map[string]*UpstreamPool) (*UpstreamPool, error) {
+	if (upstream == "") == (name == "") {
+		return nil, fmt.Errorf("either an upstream or a pool is required")
+	}
+	if upstream != "" {
+		return newSingleUpstreamPool(upstream)
+	}
+	pool, ok := pools[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pool %q", name)
+	}
+	return pool, nil
+}
+
+func parseUpstream(rawURL string) (*url.URL, error) {
+	upstream, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse upstream: %w", err)
+	}
+	if upstream.Scheme == "" || upstream.Host == "" {
+		return nil, fmt.Errorf("upstream must be an absolute URL")
+	}
+	return upstream, nil
+}
+
+func findRateLimits(names []string, rateLimits map[string]*RateLimitPolicy) ([]*RateLimitPolicy, error) {
+	policies := make([]*RateLimitPolicy, 0, len(names))
+	for _, name := range names {
+		policy, ok := rateLimits[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rate limit %q", name)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// MatchesPath reports whether the path is the prefix itself or lies below it,
+// so that "/users" matches "/users/1" but not "/usersettings".
+func (r *Route) MatchesPath(path string) bool {
+	if r.Prefix == "" {
+		return true
+	}
+	return path == r.Prefix || strings.HasPrefix(path, r.Prefix+"/")
+}
+
+func (r *Route) AllowsMethod(method string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Route) UpstreamPath(path string) string {
+	if !r.StripPrefix {
+		return path
+	}
+	stripped := strings.TrimPrefix(path, r.Prefix)
+	if !strings.HasPrefix(stripped, "/") {
+		stripped = "/" + stripped
+	}
+	return stripped
+}
+
+func (r *Route) match(req *http.Request, _ *mux.RouteMatch) bool {
+	return r.MatchesPath(req.URL.Path)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"authz"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CanaryHeader and CanaryCookie let testers pick the canary ("true") or
+	// the stable targets ("false") of a route. They are only honoured for
+	// users with CanaryPermission.
+	CanaryHeader     = "X-Canary"
+	CanaryCookie     = "canary"
+	CanaryPermission = "canary:opt-in"
+
+	weightSyncInterval = 10 * time.Second
+	splitResolution    = 10000
+)
+
+var (
+	ErrTrafficSplitNotFound         = errors.New("route has no traffic split")
+	ErrTrafficSplitStoreUnavailable = errors.New("traffic split store unavailable")
+)
+
+type Target struct {
+	Name    string
+	Pool    *UpstreamPool
+	Canary  bool
+	Breaker *CircuitBreaker
+}
+
+type TargetStatus struct {
+	Name   string `json:"name"`
+	Pool   string `json:"pool"`
+	Canary bool   `json:"canary"`
+	Weight int    `json:"weight"`
+}
+
+type TrafficSplitStatus struct {
+	Route   string         `json:"route"`
+	Targets []TargetStatus `json:"targets"`
+}
+
+// TrafficSplit spreads the requests of a route over its targets by weight.
+// Every user is hashed onto a fixed point of the weight range, so they keep
+// hitting the same target until the weights move past that point.
+type TrafficSplit struct {
+	route   string
+	targets []*Target
+
+	mu      sync.RWMutex
+	weights []int
+}
+
+func NewTrafficSplit(route string, targets []*Target, weights []int) *TrafficSplit {
+	return &TrafficSplit{
+		route:   route,
+		targets: targets,
+		weights: weights,
+	}
+}
+
+// Pick chooses the target for a request. Anonymous requests are kept sticky
+// by client IP.
+func (s *TrafficSplit) Pick(r *http.Request) *Target {
+	if len(s.targets) == 1 {
+		return s.targets[0]
+	}
+
+	s.mu.RLock()
+	weights := s.weights
+	s.mu.RUnlock()
+
+	candidates := make([]int, 0, len(s.targets))
+	if canary, ok := canaryOverride(r); ok {
+		for i, target := range s.targets {
+			if target.Canary == canary {
+				candidates = append(candidates, i)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		for i := range s.targets {
+			candidates = append(candidates, i)
+		}
+	}
+
+	total := 0
+	for _, i := range candidates {
+		total += weights[i]
+	}
+
+	identity := r.Header.Get(authz.UserIdHeader)
+	if identity == "" {
+		identity = clientIP(r)
+	}
+	point := int(hashString(s.route+":"+identity) % splitResolution)
+
+	// An override can select targets that currently get no traffic, in
+	// which case they share it equally.
+	if total == 0 {
+		return s.targets[candidates[point%len(candidates)]]
+	}
+	// The point is scaled rather than taken modulo the total, so that moving
+	// weight to a target only ever moves users onto it.
+	point = point * total / splitResolution
+	for _, i := range candidates {
+		if point < weights[i] {
+			return s.targets[i]
+		}
+		point -= weights[i]
+	}
+	return s.targets[candidates[len(candidates)-1]]
+}
+
+// canaryOverride relies on the permissions header having been set by the
+// authenticator, which drops any copy sent by the client.
+func canaryOverride(r *http.Request) (bool, bool) {
+	permissions := strings.Split(r.Header.Get(authz.PermissionsHeader), ",")
+	if !hasPermissions(permissions, []string{CanaryPermission}) {
+		return false, false
+	}
+
+	value := r.Header.Get(CanaryHeader)
+	if value == "" {
+		if cookie, err := r.Cookie(CanaryCookie); err == nil {
+			value = cookie.Value
+		}
+	}
+	switch value {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+// SetWeights replaces the weights of the named targets. Targets that are not
+// named keep their weight.
+func (s *TrafficSplit) SetWeights(named map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	weights, err := s.mergeWeights(named)
+	if err != nil {
+		return err
+	}
+	s.weights = weights
+	return nil
+}
+
+func (s *TrafficSplit) mergeWeights(named map[string]int) ([]int, error) {
+	weights := append([]int(nil), s.weights...)
+	for name, weight := range named {
+		i := s.targetIndex(name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown target %q", name)
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("weight of target %q cannot be negative", name)
+		}
+		weights[i] = weight
+	}
+
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("at least one target needs a weight")
+	}
+	return weights, nil
+}
+
+func (s *TrafficSplit) targetIndex(name string) int {
+	for i, target := range s.targets {
+		if target.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *TrafficSplit) Status() TrafficSplitStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := TrafficSplitStatus{Route: s.route, Targets: make([]TargetStatus, 0, len(s.targets))}
+	for i, target := range s.targets {
+		status.Targets = append(status.Targets, TargetStatus{
+			Name:   target.Name,
+			Pool:   target.Pool.Name,
+			Canary: target.Canary,
+			Weight: s.weights[i],
+		})
+	}
+	return status
+}
+
+// ITrafficSplitStore keeps the weights set through the admin API, so that
+// every gateway replica uses the same ones.
+type ITrafficSplitStore interface {
+	Load(string) (map[string]int, error)
+	Save(string, map[string]int) error
+}
+
+// TrafficSplitter manages the splits of all routes with more than one
+// target. Weights changed on one replica reach the others with the next
+// sync.
+type TrafficSplitter struct {
+	store  ITrafficSplitStore
+	splits map[string]*TrafficSplit
+}
+
+func NewTrafficSplitter(routes []*Route, store ITrafficSplitStore) *TrafficSplitter {
+	splits := make(map[string]*TrafficSplit)
+	for _, route := range routes {
+		if len(route.Split.targets) > 1 {
+			splits[route.Name] = route.Split
+		}
+	}
+	return &TrafficSplitter{
+		store:  store,
+		splits: splits,
+	}
+}
+
+// Start loads the stored weights and keeps syncing them in the background.
+func (s *TrafficSplitter) Start() {
+	if len(s.splits) == 0 {
+		return
+	}
+	s.sync()
+	go func() {
+		ticker := time.NewTicker(weightSyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.sync()
+		}
+	}()
+}
+
+func (s *TrafficSplitter) sync() {
+	for route, split := range s.splits {
+		weights, err := s.store.Load(route)
+		if err != nil {
+			log.Printf("Error loading traffic split weights: route=%s err=%v", route, err)
+			continue
+		}
+		// Targets removed from the config since the weights were stored are
+		// skipped.
+		for name := range weights {
+			if split.targetIndex(name) < 0 {
+				delete(weights, name)
+			}
+		}
+		if len(weights) == 0 {
+			continue
+		}
+		if err := split.SetWeights(weights); err != nil {
+			log.Printf("Ignoring stored traffic split weights: route=%s err=%v", route, err)
+		}
+	}
+}
+
+func (s *TrafficSplitter) SetWeights(route string, weights map[string]int) error {
+	split, ok := s.splits[route]
+	if !ok {
+		return ErrTrafficSplitNotFound
+	}
+
+	split.mu.RLock()
+	_, err := split.mergeWeights(weights)
+	split.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Save(route, weights); err != nil {
+		return fmt.Errorf("%w: %v", ErrTrafficSplitStoreUnavailable, err)
+	}
+	return split.SetWeights(weights)
+}
+
+func (s *TrafficSplitter) Statuses() []TrafficSplitStatus {
+	statuses := make([]TrafficSplitStatus, 0, len(s.splits))
+	for _, split := range s.splits {
+		statuses = append(statuses, split.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Route < statuses[j].Route
+	})
+	return statuses
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"authz"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestSplit(stable int, canary int) *TrafficSplit {
+	targets := []*Target{{Name: "stable"}, {Name: "canary", Canary: true}}
+	return NewTrafficSplit("orders", targets, []int{stable, canary})
+}
+
+func userRequest(userId string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	if userId != "" {
+		r.Header.Set(authz.UserIdHeader, userId)
+	}
+	return r
+}
+
+func TestTrafficSplitPickOverride(t *testing.T) {
+	tests := []struct {
+		name        string
+		weights     [2]int
+		permissions string
+		header      string
+		cookie      string
+		want        string
+	}{
+		{"no override", [2]int{100, 0}, "", "", "", "stable"},
+		{"header without permission", [2]int{100, 0}, "orders:read", "true", "", "stable"},
+		{"cookie without permission", [2]int{100, 0}, "", "", "true", "stable"},
+		{"header with permission", [2]int{100, 0}, "orders:read,canary:opt-in", "true", "", "canary"},
+		{"cookie with permission", [2]int{100, 0}, "canary:opt-in", "", "true", "canary"},
+		{"header wins over cookie", [2]int{100, 0}, "canary:opt-in", "true", "false", "canary"},
+		{"opt out of the canary", [2]int{0, 100}, "canary:opt-in", "false", "", "stable"},
+		{"unknown value", [2]int{100, 0}, "canary:opt-in", "yes", "", "stable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := userRequest("u1")
+			if tt.permissions != "" {
+				r.Header.Set(authz.PermissionsHeader, tt.permissions)
+			}
+			if tt.header != "" {
+				r.Header.Set(CanaryHeader, tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CanaryCookie, Value: tt.cookie})
+			}
+
+			if got := newTestSplit(tt.weights[0], tt.weights[1]).Pick(r).Name; got != tt.want {
+				t.Errorf("Pick() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrafficSplitPickSticky(t *testing.T) {
+	split := newTestSplit(50, 50)
+	for i := 0; i < 100; i++ {
+		userId := fmt.Sprintf("user-%d", i)
+		first := split.Pick(userRequest(userId))
+		for j := 0; j < 5; j++ {
+			if got := split.Pick(userRequest(userId)); got != first {
+				t.Fatalf("%s moved from %s to %s", userId, first.Name, got.Name)
+			}
+		}
+	}
+
+	anonymous := userRequest("")
+	anonymous.RemoteAddr = "10.0.0.7:1234"
+	first := split.Pick(anonymous)
+	anonymous.RemoteAddr = "10.0.0.7:5678"
+	if got := split.Pick(anonymous); got != first {
+		t.Errorf("anonymous client moved from %s to %s with a new port", first.Name, got.Name)
+	}
+}
+
+func TestTrafficSplitPickWeights(t *testing.T) {
+	tests := []struct {
+		stable int
+		canary int
+	}{
+		{100, 0},
+		{90, 10},
+		{50, 50},
+		{0, 100},
+	}
+	const users = 2000
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/%d", tt.stable, tt.canary), func(t *testing.T) {
+			split := newTestSplit(tt.stable, tt.canary)
+			canary := 0
+			for i := 0; i < users; i++ {
+				if split.Pick(userRequest(fmt.Sprintf("user-%d", i))).Canary {
+					canary++
+				}
+			}
+
+			want := users * tt.canary / (tt.stable + tt.canary)
+			if diff := canary - want; diff < -users/20 || diff > users/20 {
+				t.Errorf("%d users on the canary, want about %d", canary, want)
+			}
+		})
+	}
+}
+
+func TestTrafficSplitRampOnlyMovesOntoCanary(t *testing.T) {
+	split := newTestSplit(90, 10)
+	onCanary := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		userId := fmt.Sprintf("user-%d", i)
+		onCanary[userId] = split.Pick(userRequest(userId)).Canary
+	}
+
+	if err := split.SetWeights(map[string]int{"stable": 70, "canary": 30}); err != nil {
+		t.Fatal(err)
+	}
+	for userId, wasCanary := range onCanary {
+		if wasCanary && !split.Pick(userRequest(userId)).Canary {
+			t.Errorf("%s moved off the canary when its weight went up", userId)
+		}
+	}
+}
+
+func TestTrafficSplitSetWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]int
+		wantErr bool
+	}{
+		{"one target", map[string]int{"canary": 25}, false},
+		{"all targets", map[string]int{"stable": 0, "canary": 100}, false},
+		{"unknown target", map[string]int{"beta": 10}, true},
+		{"negative weight", map[string]int{"canary": -1}, true},
+		{"no weight left", map[string]int{"stable": 0, "canary": 0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			split := newTestSplit(90, 10)
+			err := split.SetWeights(tt.weights)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetWeights() = %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil && (split.weights[0] != 90 || split.weights[1] != 10) {
+				t.Errorf("weights %v changed by a rejected update", split.weights)
+			}
+		})
+	}
+}
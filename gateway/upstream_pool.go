@@ -0,0 +1,392 @@
+package main
+
+import (
+	"authz"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	RoundRobinStrategy       = "roundRobin"
+	LeastConnectionsStrategy = "leastConnections"
+	ConsistentHashStrategy   = "consistentHash"
+
+	// ringReplicas is the number of points every member gets on the
+	// consistent hash ring, which keeps the load even across members.
+	ringReplicas = 100
+)
+
+var ErrNoHealthyUpstream = errors.New("no healthy upstream")
+
+// PoolMember is one replica of an upstream. It is unavailable while its
+// active health check fails, and while it is ejected for failing too many
+// requests in a row.
+type PoolMember struct {
+	URL    *url.URL
+	active int64
+
+	mu                  sync.Mutex
+	healthy             bool
+	checkSuccesses      int
+	checkFailures       int
+	consecutiveFailures int
+	ejectedUntil        time.Time
+}
+
+type PoolMemberStatus struct {
+	URL            string     `json:"url"`
+	Healthy        bool       `json:"healthy"`
+	EjectedUntil   *time.Time `json:"ejected_until,omitempty"`
+	ActiveRequests int64      `json:"active_requests"`
+}
+
+type UpstreamPoolStatus struct {
+	Name     string             `json:"name"`
+	Strategy string             `json:"strategy"`
+	Members  []PoolMemberStatus `json:"members"`
+}
+
+type ringPoint struct {
+	hash   uint32
+	member *PoolMember
+}
+
+// UpstreamPool balances requests over the members of an upstream.
+// Consistent hashing keeps each user on the same member while it is
+// available.
+type UpstreamPool struct {
+	Name        string
+	strategy    string
+	members     []*PoolMember
+	ring        []ringPoint
+	next        uint32
+	healthCheck HealthCheckConfig
+	outlier     OutlierDetectionConfig
+	client      *http.Client
+}
+
+func NewUpstreamPools(poolConfigs []PoolConfig) (map[string]*UpstreamPool, error) {
+	pools := make(map[string]*UpstreamPool, len(poolConfigs))
+	for _, pc := range poolConfigs {
+		if pc.Name == "" {
+			return nil, fmt.Errorf("pool needs a name")
+		}
+		if _, ok := pools[pc.Name]; ok {
+			return nil, fmt.Errorf("duplicate pool %q", pc.Name)
+		}
+		pool, err := NewUpstreamPool(pc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pool %q: %w", pc.Name, err)
+		}
+		pools[pc.Name] = pool
+	}
+	return pools, nil
+}
+
+func NewUpstreamPool(pc PoolConfig) (*UpstreamPool, error) {
+	strategy := pc.Strategy
+	if strategy == "" {
+		strategy = RoundRobinStrategy
+	}
+	if strategy != RoundRobinStrategy && strategy != LeastConnectionsStrategy && strategy != ConsistentHashStrategy {
+		return nil, fmt.Errorf("strategy must be %s, %s or %s", RoundRobinStrategy, LeastConnectionsStrategy, ConsistentHashStrategy)
+	}
+	if len(pc.Members) == 0 {
+		return nil, fmt.Errorf("at least one member is required")
+	}
+
+	members := make([]*PoolMember, 0, len(pc.Members))
+	for _, rawURL := range pc.Members {
+		memberURL, err := parseUpstream(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("member %q: %w", rawURL, err)
+		}
+		members = append(members, &PoolMember{URL: memberURL, healthy: true})
+	}
+
+	healthCheck := pc.HealthCheck
+	if healthCheck.Path != "" {
+		if !strings.HasPrefix(healthCheck.Path, "/") {
+			return nil, fmt.Errorf("health check path must start with /")
+		}
+		if healthCheck.Interval <= 0 {
+			healthCheck.Interval = 10 * time.Second
+		}
+		if healthCheck.Timeout <= 0 {
+			healthCheck.Timeout = 2 * time.Second
+		}
+		if healthCheck.HealthyThreshold <= 0 {
+			healthCheck.HealthyThreshold = 2
+		}
+		if healthCheck.UnhealthyThreshold <= 0 {
+			healthCheck.UnhealthyThreshold = 3
+		}
+	}
+	outlier := pc.OutlierDetection
+	if outlier.ConsecutiveFailures > 0 && outlier.EjectionTime <= 0 {
+		outlier.EjectionTime = 30 * time.Second
+	}
+
+	pool := &UpstreamPool{
+		Name:        pc.Name,
+		strategy:    strategy,
+		members:     members,
+		healthCheck: healthCheck,
+		outlier:     outlier,
+		client:      &http.Client{Timeout: healthCheck.Timeout},
+	}
+	if strategy == ConsistentHashStrategy {
+		pool.buildRing()
+	}
+	return pool, nil
+}
+
+// newSingleUpstreamPool backs a plain upstream URL, which has no health
+// checks and is never ejected.
+func newSingleUpstreamPool(rawURL string) (*UpstreamPool, error) {
+	return NewUpstreamPool(PoolConfig{Name: rawURL, Members: []string{rawURL}})
+}
+
+func (p *UpstreamPool) buildRing() {
+	for _, member := range p.members {
+		for i := 0; i < ringReplicas; i++ {
+			p.ring = append(p.ring, ringPoint{hash: ringHash(member.URL.String() + "#" + strconv.Itoa(i)), member: member})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool {
+		return p.ring[i].hash < p.ring[j].hash
+	})
+}
+
+// Pick chooses an available member for a request and counts it as active
+// until Done is called.
+func (p *UpstreamPool) Pick(r *http.Request) (*PoolMember, error) {
+	now := time.Now()
+
+	var picked *PoolMember
+	switch p.strategy {
+	case LeastConnectionsStrategy:
+		picked = p.leastConnections(now)
+	case ConsistentHashStrategy:
+		picked = p.consistentHash(r, now)
+	default:
+		picked = p.roundRobin(now)
+	}
+	if picked == nil {
+		return nil, ErrNoHealthyUpstream
+	}
+
+	atomic.AddInt64(&picked.active, 1)
+	return picked, nil
+}
+
+func (p *UpstreamPool) roundRobin(now time.Time) *PoolMember {
+	start := int(atomic.AddUint32(&p.next, 1))
+	for i := range p.members {
+		member := p.members[(start+i)%len(p.members)]
+		if member.available(now) {
+			return member
+		}
+	}
+	return nil
+}
+
+// leastConnections starts looking at a rotating offset, so that idle members
+// take turns.
+func (p *UpstreamPool) leastConnections(now time.Time) *PoolMember {
+	start := int(atomic.AddUint32(&p.next, 1))
+	var picked *PoolMember
+	for i := range p.members {
+		member := p.members[(start+i)%len(p.members)]
+		if !member.available(now) {
+			continue
+		}
+		if picked == nil || atomic.LoadInt64(&member.active) < atomic.LoadInt64(&picked.active) {
+			picked = member
+		}
+	}
+	return picked
+}
+
+// consistentHash hashes the user, or the client IP of anonymous requests, and
+// walks the ring from there to the first available member.
+func (p *UpstreamPool) consistentHash(r *http.Request, now time.Time) *PoolMember {
+	identity := r.Header.Get(authz.UserIdHeader)
+	if identity == "" {
+		identity = clientIP(r)
+	}
+	hash := ringHash(identity)
+
+	start := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i].hash >= hash
+	})
+	for i := range p.ring {
+		member := p.ring[(start+i)%len(p.ring)].member
+		if member.available(now) {
+			return member
+		}
+	}
+	return nil
+}
+
+// Done ends a request to a member. A failed request is a connection error or
+// a 502, 503 or 504, and OutlierDetectionConfig.ConsecutiveFailures of them in
+// a row eject the member.
+func (p *UpstreamPool) Done(member *PoolMember, failed bool) {
+	atomic.AddInt64(&member.active, -1)
+
+	member.mu.Lock()
+	defer member.mu.Unlock()
+
+	if !failed {
+		member.consecutiveFailures = 0
+		return
+	}
+	member.consecutiveFailures++
+	if p.outlier.ConsecutiveFailures > 0 && member.consecutiveFailures >= p.outlier.ConsecutiveFailures {
+		member.consecutiveFailures = 0
+		member.ejectedUntil = time.Now().Add(p.outlier.EjectionTime)
+		log.Printf("Ejecting pool member: pool=%s member=%s until=%s", p.Name, member.URL, member.ejectedUntil.Format(time.RFC3339))
+	}
+}
+
+// Start runs the active health checks of the pool in the background.
+func (p *UpstreamPool) Start() {
+	if p.healthCheck.Path == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(p.healthCheck.Interval)
+		defer ticker.Stop()
+		for {
+			p.checkMembers()
+			<-ticker.C
+		}
+	}()
+}
+
+func (p *UpstreamPool) checkMembers() {
+	var wg sync.WaitGroup
+	for _, member := range p.members {
+		wg.Add(1)
+		go func(member *PoolMember) {
+			defer wg.Done()
+			p.recordCheck(member, p.check(member))
+		}(member)
+	}
+	wg.Wait()
+}
+
+func (p *UpstreamPool) check(member *PoolMember) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), p.healthCheck.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, member.url(p.healthCheck.Path), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode <= 299
+}
+
+func (p *UpstreamPool) recordCheck(member *PoolMember, passed bool) {
+	member.mu.Lock()
+	defer member.mu.Unlock()
+
+	if passed {
+		member.checkFailures = 0
+		member.checkSuccesses++
+		if !member.healthy && member.checkSuccesses >= p.healthCheck.HealthyThreshold {
+			member.healthy = true
+			log.Printf("Pool member is healthy again: pool=%s member=%s", p.Name, member.URL)
+		}
+		return
+	}
+
+	member.checkSuccesses = 0
+	member.checkFailures++
+	if member.healthy && member.checkFailures >= p.healthCheck.UnhealthyThreshold {
+		member.healthy = false
+		log.Printf("Pool member is unhealthy: pool=%s member=%s", p.Name, member.URL)
+	}
+}
+
+func (p *UpstreamPool) Status() UpstreamPoolStatus {
+	status := UpstreamPoolStatus{Name: p.Name, Strategy: p.strategy, Members: make([]PoolMemberStatus, 0, len(p.members))}
+	now := time.Now()
+	for _, member := range p.members {
+		member.mu.Lock()
+		memberStatus := PoolMemberStatus{
+			URL:            member.URL.String(),
+			Healthy:        member.healthy,
+			ActiveRequests: atomic.LoadInt64(&member.active),
+		}
+		if member.ejectedUntil.After(now) {
+			ejectedUntil := member.ejectedUntil
+			memberStatus.EjectedUntil = &ejectedUntil
+		}
+		member.mu.Unlock()
+		status.Members = append(status.Members, memberStatus)
+	}
+	return status
+}
+
+func (m *PoolMember) available(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.healthy && !now.Before(m.ejectedUntil)
+}
+
+// url joins the member's base URL and a path.
+func (m *PoolMember) url(path string) string {
+	return strings.TrimSuffix(m.URL.String(), "/") + path
+}
+
+// request points a request at the member.
+func (m *PoolMember) request(req *http.Request) *http.Request {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = m.URL.Scheme
+	out.URL.Host = m.URL.Host
+	out.URL.Path = strings.TrimSuffix(m.URL.Path, "/") + req.URL.Path
+	out.URL.RawPath = ""
+	if req.URL.RawPath != "" {
+		out.URL.RawPath = strings.TrimSuffix(m.URL.EscapedPath(), "/") + req.URL.RawPath
+	}
+	out.Host = m.URL.Host
+	return out
+}
+
+func hashString(s string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(s))
+	return hash.Sum32()
+}
+
+// ringHash mixes the bits of hashString, which on its own places the ring
+// points of similar member URLs next to each other.
+func ringHash(s string) uint32 {
+	h := hashString(s)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, strategy string, members int, outlier OutlierDetectionConfig) *UpstreamPool {
+	t.Helper()
+	pc := PoolConfig{Name: "users", Strategy: strategy, OutlierDetection: outlier}
+	for i := 0; i < members; i++ {
+		pc.Members = append(pc.Members, fmt.Sprintf("http://10.0.0.%d:8080", i+1))
+	}
+	pool, err := NewUpstreamPool(pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func pick(t *testing.T, pool *UpstreamPool, r *http.Request) *PoolMember {
+	t.Helper()
+	member, err := pool.Pick(r)
+	if err != nil {
+		t.Fatalf("Pick() = %v", err)
+	}
+	return member
+}
+
+func TestUpstreamPoolRoundRobin(t *testing.T) {
+	pool := newTestPool(t, RoundRobinStrategy, 3, OutlierDetectionConfig{})
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+
+	picks := make(map[*PoolMember]int)
+	var previous *PoolMember
+	for i := 0; i < 30; i++ {
+		member := pick(t, pool, r)
+		pool.Done(member, false)
+		if member == previous {
+			t.Fatalf("pick %d went to %s twice in a row", i, member.URL)
+		}
+		previous = member
+		picks[member]++
+	}
+	for _, member := range pool.members {
+		if picks[member] != 10 {
+			t.Errorf("%s picked %d times, want 10", member.URL, picks[member])
+		}
+	}
+
+	pool.members[0].healthy = false
+	for i := 0; i < 6; i++ {
+		if member := pick(t, pool, r); member == pool.members[0] {
+			t.Fatalf("unhealthy member %s was picked", member.URL)
+		}
+	}
+}
+
+func TestUpstreamPoolLeastConnections(t *testing.T) {
+	pool := newTestPool(t, LeastConnectionsStrategy, 3, OutlierDetectionConfig{})
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+
+	// Three requests in flight land on three different members.
+	busy := make(map[*PoolMember]bool)
+	for i := 0; i < 3; i++ {
+		busy[pick(t, pool, r)] = true
+	}
+	if len(busy) != 3 {
+		t.Fatalf("3 concurrent requests went to %d members, want 3", len(busy))
+	}
+
+	// Finishing one request makes its member the least loaded.
+	idle := pool.members[1]
+	pool.Done(idle, false)
+	for i := 0; i < 3; i++ {
+		member := pick(t, pool, r)
+		if member != idle {
+			t.Fatalf("picked %s with %d active requests, want idle %s", member.URL, member.active, idle.URL)
+		}
+		pool.Done(member, false)
+	}
+}
+
+func TestUpstreamPoolConsistentHash(t *testing.T) {
+	pool := newTestPool(t, ConsistentHashStrategy, 3, OutlierDetectionConfig{})
+
+	members := make(map[string]*PoolMember)
+	used := make(map[*PoolMember]bool)
+	for i := 0; i < 100; i++ {
+		userId := fmt.Sprintf("user-%d", i)
+		members[userId] = pick(t, pool, userRequest(userId))
+		used[members[userId]] = true
+	}
+	if len(used) != 3 {
+		t.Errorf("100 users spread over %d members, want 3", len(used))
+	}
+
+	for userId, member := range members {
+		if got := pick(t, pool, userRequest(userId)); got != member {
+			t.Fatalf("%s moved from %s to %s", userId, member.URL, got.URL)
+		}
+	}
+
+	// Users of an unavailable member move, everybody else stays put.
+	down := pool.members[0]
+	down.healthy = false
+	for userId, member := range members {
+		got := pick(t, pool, userRequest(userId))
+		if got == down {
+			t.Fatalf("%s was sent to the unavailable member", userId)
+		}
+		if member != down && got != member {
+			t.Errorf("%s moved from %s to %s", userId, member.URL, got.URL)
+		}
+	}
+
+	anonymous := httptest.NewRequest(http.MethodGet, "/users", nil)
+	anonymous.RemoteAddr = "203.0.113.7:1234"
+	first := pick(t, pool, anonymous)
+	anonymous.RemoteAddr = "203.0.113.7:5678"
+	if got := pick(t, pool, anonymous); got != first {
+		t.Errorf("anonymous client moved from %s to %s with a new port", first.URL, got.URL)
+	}
+}
+
+func TestUpstreamPoolOutlierDetection(t *testing.T) {
+	const ejectionTime = 20 * time.Millisecond
+	pool := newTestPool(t, RoundRobinStrategy, 1, OutlierDetectionConfig{ConsecutiveFailures: 3, EjectionTime: ejectionTime})
+	member := pool.members[0]
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+
+	tests := []struct {
+		op      string
+		ejected bool
+	}{
+		{"failure", false},
+		{"failure", false},
+		{"success", false},
+		{"failure", false},
+		{"failure", false},
+		{"failure", true},
+		{"wait", false},
+		{"failure", false},
+	}
+	for i, step := range tests {
+		switch step.op {
+		case "wait":
+			time.Sleep(ejectionTime + 5*time.Millisecond)
+		default:
+			pick(t, pool, r)
+			pool.Done(member, step.op == "failure")
+		}
+
+		if ejected := !member.available(time.Now()); ejected != step.ejected {
+			t.Fatalf("step %d (%s): ejected %t, want %t", i, step.op, ejected, step.ejected)
+		}
+	}
+
+	pool.Done(pick(t, pool, r), true)
+	pool.Done(pick(t, pool, r), true)
+	if _, err := pool.Pick(r); !errors.Is(err, ErrNoHealthyUpstream) {
+		t.Errorf("Pick() with every member ejected = %v, want ErrNoHealthyUpstream", err)
+	}
+}
+
+func TestUpstreamPoolHealthCheckThresholds(t *testing.T) {
+	pool, err := NewUpstreamPool(PoolConfig{
+		Name:        "users",
+		Members:     []string{"http://10.0.0.1:8080"},
+		HealthCheck: HealthCheckConfig{Path: "/health", HealthyThreshold: 2, UnhealthyThreshold: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	member := pool.members[0]
+
+	checks := []struct {
+		passed      bool
+		wantHealthy bool
+	}{
+		{false, true},
+		{false, true},
+		{true, true},
+		{false, true},
+		{false, true},
+		{false, false},
+		{true, false},
+		{false, false},
+		{true, false},
+		{true, true},
+	}
+	for i, check := range checks {
+		pool.recordCheck(member, check.passed)
+		if member.healthy != check.wantHealthy {
+			t.Errorf("check %d (passed %t): healthy %t, want %t", i, check.passed, member.healthy, check.wantHealthy)
+		}
+	}
+}
+
+func TestUpstreamPoolCheckMembers(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/base/health" {
+			t.Errorf("health check requested %s", r.URL.Path)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	pool, err := NewUpstreamPool(PoolConfig{
+		Name:        "users",
+		Members:     []string{server.URL + "/base"},
+		HealthCheck: HealthCheckConfig{Path: "/health", HealthyThreshold: 1, UnhealthyThreshold: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.checkMembers()
+	if pool.members[0].healthy {
+		t.Error("member answering 503 is still healthy")
+	}
+	status = http.StatusOK
+	pool.checkMembers()
+	if !pool.members[0].healthy {
+		t.Error("member answering 200 is still unhealthy")
+	}
+}
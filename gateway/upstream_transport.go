@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// idempotentMethods can be sent again without changing the outcome, so they
+// are the only ones retried.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// UpstreamTransport calls the target picked for a request through the
+// target's circuit breaker, and retries idempotent requests that failed with
+// a connection error or a 502, 503 or 504 while the route's timeout allows.
+type UpstreamTransport struct {
+	route     *Route
+	transport http.RoundTripper
+}
+
+func NewUpstreamTransport(route *Route) *UpstreamTransport {
+	return &UpstreamTransport{
+		route:     route,
+		transport: http.DefaultTransport,
+	}
+}
+
+func (t *UpstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := 0
+	var body []byte
+	if idempotentMethods[req.Method] {
+		retries = t.route.Retry.Attempts
+	}
+	if retries > 0 && req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		out := req
+		if body != nil {
+			out = req.Clone(req.Context())
+			out.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := t.attempt(out)
+		if attempt >= retries || !retryable(resp, err) || req.Context().Err() != nil || !requestTarget(req).Breaker.Ready() {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(req.Context(), t.route.Retry.Backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt picks a pool member for every attempt, so a retry can go to a
+// different one.
+func (t *UpstreamTransport) attempt(req *http.Request) (*http.Response, error) {
+	target := requestTarget(req)
+	breaker := target.Breaker
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+	member, err := target.Pool.Pick(req)
+	if err != nil {
+		breaker.Release()
+		return nil, err
+	}
+
+	resp, err := t.transport.RoundTrip(member.request(req))
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		target.Pool.Done(member, false)
+		breaker.Release()
+	case err != nil || upstreamFailure(resp.StatusCode):
+		target.Pool.Done(member, true)
+		breaker.Failure()
+	default:
+		target.Pool.Done(member, false)
+		breaker.Success()
+	}
+	return resp, err
+}
+
+func requestTarget(req *http.Request) *Target {
+	return req.Context().Value(targetContextKey{}).(*Target)
+}
+
+func retryable(resp *http.Response, err error) bool {
+	var openErr *CircuitOpenError
+	if err != nil {
+		return !errors.As(err, &openErr) && !errors.Is(err, ErrNoHealthyUpstream)
+	}
+	return upstreamFailure(resp.StatusCode)
+}
+
+// upstreamFailure reports whether a status means the upstream itself is
+// failing. Other 5xx statuses, such as a 500 for a malformed id, can be
+// caused by the request, and counting them would let any client open the
+// circuit for everyone.
+func upstreamFailure(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Backoff returns a random delay of up to Backoff doubled for every attempt
+// made so far, capped at MaxBackoff. The jitter keeps gateway replicas from
+// retrying in lockstep.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	ceiling := p.MaxBackoff
+	if attempt < 30 && p.BaseBackoff<<attempt < ceiling {
+		ceiling = p.BaseBackoff << attempt
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
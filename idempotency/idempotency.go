@@ -0,0 +1,193 @@
+// Package idempotency makes mutating endpoints safe to retry by replaying the
+// stored response of a request whose Idempotency-Key was already seen.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	KeyHeader      = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+	// userIdHeader is the identity header the gateway sets for authenticated
+	// callers.
+	userIdHeader = "X-User-Id"
+)
+
+// Record is what is kept for every Idempotency-Key. A record is
+// created in the pending state before the handler runs and completed with the
+// captured response once it has finished.
+type Record struct {
+	RequestHash string      `json:"request_hash"`
+	Completed   bool        `json:"completed"`
+	StatusCode  int         `json:"status_code"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+type IStore interface {
+	// Reserve stores a pending record for key unless one already exists. It
+	// returns the existing record and false when the key was already taken.
+	Reserve(string, Record, time.Duration) (*Record, bool, error)
+	Complete(string, Record, time.Duration) error
+	Release(string)
+}
+
+type Middleware struct {
+	store    IStore
+	ttl      time.Duration
+	clientIP func(*http.Request) string
+}
+
+// NewMiddleware keeps records for ttl. clientIP tells anonymous callers apart;
+// when nil the remote address of the connection is used.
+func NewMiddleware(store IStore, ttl time.Duration, clientIP func(*http.Request) string) *Middleware {
+	if clientIP == nil {
+		clientIP = remoteIP
+	}
+	return &Middleware{
+		store:    store,
+		ttl:      ttl,
+		clientIP: clientIP,
+	}
+}
+
+// Handler makes next safe to retry. Requests without an Idempotency-Key header
+// pass through untouched. The first response for a key is stored and replayed
+// for every retry with the same body; reusing the key with a different body is
+// rejected with 422.
+func (i *Middleware) Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(KeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		storeKey := i.storeKey(r, key)
+		pending := Record{RequestHash: requestHash(r, body)}
+
+		existing, reserved, err := i.store.Reserve(storeKey, pending, i.ttl)
+		if err != nil {
+			log.Printf("Idempotency store error: %v", err)
+			http.Error(w, "Error processing request", http.StatusInternalServerError)
+			return
+		}
+
+		if !reserved {
+			switch {
+			case existing.RequestHash != pending.RequestHash:
+				http.Error(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+			case !existing.Completed:
+				http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+			default:
+				replay(w, existing)
+			}
+			return
+		}
+
+		recorder := newResponseRecorder(w)
+		next(recorder, r)
+
+		// Server errors are not stored so that the client can retry them.
+		if recorder.statusCode >= http.StatusInternalServerError {
+			i.store.Release(storeKey)
+			return
+		}
+
+		// Cookies are not stored: replaying one would hand out a credential,
+		// such as a refresh token, that may have been rotated since.
+		header := recorder.Header().Clone()
+		header.Del("Set-Cookie")
+		completed := Record{
+			RequestHash: pending.RequestHash,
+			Completed:   true,
+			StatusCode:  recorder.statusCode,
+			Header:      header,
+			Body:        recorder.body.Bytes(),
+		}
+		if err := i.store.Complete(storeKey, completed, i.ttl); err != nil {
+			log.Printf("Idempotency store error: %v", err)
+		}
+	}
+}
+
+// storeKey scopes keys to the calling user so that two users can never see
+// each other's responses. Anonymous callers are scoped to their client IP.
+func (i *Middleware) storeKey(r *http.Request, key string) string {
+	if userId := r.Header.Get(userIdHeader); userId != "" {
+		return "idempotency:user:" + userId + ":" + key
+	}
+	return "idempotency:ip:" + i.clientIP(r) + ":" + key
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, record *Record) {
+	for name, values := range record.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,180 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type idempotentCall struct {
+	user         string
+	ip           string
+	key          string
+	body         string
+	handlerCalls int
+	wantStatus   int
+	wantReplayed bool
+}
+
+func TestIdempotencyHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		calls  []idempotentCall
+	}{
+		{
+			name:   "requests without a key always run",
+			status: http.StatusCreated,
+			calls: []idempotentCall{
+				{body: "a", handlerCalls: 1, wantStatus: http.StatusCreated},
+				{body: "a", handlerCalls: 2, wantStatus: http.StatusCreated},
+			},
+		},
+		{
+			name:   "retry is replayed",
+			status: http.StatusCreated,
+			calls: []idempotentCall{
+				{key: "k1", body: "a", handlerCalls: 1, wantStatus: http.StatusCreated},
+				{key: "k1", body: "a", handlerCalls: 1, wantStatus: http.StatusCreated, wantReplayed: true},
+			},
+		},
+		{
+			name:   "client errors are replayed",
+			status: http.StatusBadRequest,
+			calls: []idempotentCall{
+				{key: "k1", body: "a", handlerCalls: 1, wantStatus: http.StatusBadRequest},
+				{key: "k1", body: "a", handlerCalls: 1, wantStatus: http.StatusBadRequest, wantReplayed: true},
+			},
+		},
+		{
+			name:   "key reused with another body",
+			status: http.StatusCreated,
+			calls: []idempotentCall{
+				{key: "k1", body: "a", handlerCalls: 1, wantStatus: http.StatusCreated},
+				{key: "k1", body: "b", handlerCalls: 1, wantStatus: http.StatusUnprocessableEntity},
+			},
+		},
+		{
+			name:   "server errors can be retried",
+			status: http.StatusInternalServerError,
+			calls: []idempotentCall{
+				{key: "k1", body: "a", handlerCalls: 1, wantStatus: http.StatusInternalServerError},
+				{key: "k1", body: "a", handlerCalls: 2, wantStatus: http.StatusInternalServerError},
+			},
+		},
+		{
+			name:   "keys are scoped to the user",
+			status: http.StatusCreated,
+			calls: []idempotentCall{
+				{user: "u1", key: "k1", body: "a", handlerCalls: 1, wantStatus: http.StatusCreated},
+				{user: "u2", key: "k1", body: "a", handlerCalls: 2, wantStatus: http.StatusCreated},
+				{key: "k1", body: "a", handlerCalls: 3, wantStatus: http.StatusCreated},
+			},
+		},
+		{
+			name:   "anonymous keys are scoped to the client",
+			status: http.StatusCreated,
+			calls: []idempotentCall{
+				{ip: "10.0.0.1", key: "k1", body: "a", handlerCalls: 1, wantStatus: http.StatusCreated},
+				{ip: "10.0.0.2", key: "k1", body: "b", handlerCalls: 2, wantStatus: http.StatusCreated},
+				{ip: "10.0.0.1", key: "k1", body: "a", handlerCalls: 2, wantStatus: http.StatusCreated, wantReplayed: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlerCalls := 0
+			handler := NewMiddleware(NewMemoryStore(), time.Hour, nil).Handler(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalls++
+				w.WriteHeader(tt.status)
+			})
+
+			for i, call := range tt.calls {
+				r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(call.body))
+				if call.key != "" {
+					r.Header.Set(KeyHeader, call.key)
+				}
+				if call.user != "" {
+					r.Header.Set(userIdHeader, call.user)
+				}
+				if call.ip != "" {
+					r.RemoteAddr = call.ip + ":1234"
+				}
+				w := httptest.NewRecorder()
+				handler(w, r)
+
+				if w.Code != call.wantStatus {
+					t.Errorf("call %d: status %d, want %d", i, w.Code, call.wantStatus)
+				}
+				if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != call.wantReplayed {
+					t.Errorf("call %d: replayed %t, want %t", i, replayed, call.wantReplayed)
+				}
+				if handlerCalls != call.handlerCalls {
+					t.Errorf("call %d: handler ran %d times, want %d", i, handlerCalls, call.handlerCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyHandlerInProgress(t *testing.T) {
+	idempotency := NewMiddleware(NewMemoryStore(), time.Hour, nil)
+
+	var inner *httptest.ResponseRecorder
+	handler := idempotency.Handler(func(w http.ResponseWriter, r *http.Request) {
+		retry := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("a"))
+		retry.Header.Set(KeyHeader, "k1")
+		inner = httptest.NewRecorder()
+		idempotency.Handler(func(http.ResponseWriter, *http.Request) {
+			t.Error("handler ran for a key that is still being processed")
+		})(inner, retry)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("a"))
+	r.Header.Set(KeyHeader, "k1")
+	handler(httptest.NewRecorder(), r)
+
+	if inner.Code != http.StatusConflict {
+		t.Errorf("concurrent retry status %d, want %d", inner.Code, http.StatusConflict)
+	}
+}
+
+func TestIdempotencyHandlerDropsCookies(t *testing.T) {
+	handler := NewMiddleware(NewMemoryStore(), time.Hour, nil).Handler(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: "r1"})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	for i, wantCookie := range []bool{true, false} {
+		r := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader("a"))
+		r.Header.Set(KeyHeader, "k1")
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if gotCookie := w.Header().Get("Set-Cookie") != ""; gotCookie != wantCookie {
+			t.Errorf("call %d: Set-Cookie sent %t, want %t", i, gotCookie, wantCookie)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("call %d: Content-Type %q, want application/json", i, got)
+		}
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	if _, reserved, _ := store.Reserve("k1", Record{RequestHash: "a"}, -time.Second); !reserved {
+		t.Fatal("first Reserve() did not reserve the key")
+	}
+	if _, reserved, _ := store.Reserve("k1", Record{RequestHash: "b"}, time.Hour); !reserved {
+		t.Error("Reserve() after expiry did not reserve the key")
+	}
+	existing, reserved, _ := store.Reserve("k1", Record{RequestHash: "c"}, time.Hour)
+	if reserved || existing == nil || existing.RequestHash != "b" {
+		t.Errorf("Reserve() of a live key = %v, %t, want the existing record", existing, reserved)
+	}
+}
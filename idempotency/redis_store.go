@@ -0,0 +1,61 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Reserve(key string, record Record, expiration time.Duration) (*Record, bool, error) {
+	ctx := context.Background()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reserved, err := s.client.SetNX(ctx, key, data, expiration).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if reserved {
+		return nil, true, nil
+	}
+
+	existing, err := s.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		// The previous holder released the key in between; try again.
+		return s.Reserve(key, record, expiration)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var stored Record
+	if err := json.Unmarshal(existing, &stored); err != nil {
+		return nil, false, err
+	}
+	return &stored, false, nil
+}
+
+func (s *RedisStore) Complete(key string, record Record, expiration time.Duration) error {
+	ctx := context.Background()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, key, data, expiration).Err()
+}
+
+func (s *RedisStore) Release(key string) {
+	ctx := context.Background()
+	s.client.Del(ctx, key)
+}
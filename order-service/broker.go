@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+type IBroker interface {
+	Publish(context.Context, OutboxEvent) error
+}
+
+type EventHandler func(context.Context, OutboxEvent) error
+
+// InProcessBroker delivers events synchronously to handlers registered in the
+// same process. A handler error fails the publish so the relay retries it.
+type InProcessBroker struct {
+	mu       sync.RWMutex
+	handlers map[string][]EventHandler
+}
+
+func NewInProcessBroker() *InProcessBroker {
+	return &InProcessBroker{handlers: make(map[string][]EventHandler)}
+}
+
+// Subscribe registers handler for eventType, or for every event when
+// eventType is "*".
+func (b *InProcessBroker) Subscribe(eventType string, handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *InProcessBroker) Publish(ctx context.Context, event OutboxEvent) error {
+	b.mu.RLock()
+	handlers := append(append([]EventHandler{}, b.handlers[event.Type]...), b.handlers["*"]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RedisStreamBroker appends every event to a Redis stream. Consumers read it
+// with consumer groups (XREADGROUP) and acknowledge processed entries.
+type RedisStreamBroker struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamBroker(client *redis.Client, stream string, maxLen int64) *RedisStreamBroker {
+	return &RedisStreamBroker{
+		client: client,
+		stream: stream,
+		maxLen: maxLen,
+	}
+}
+
+func (b *RedisStreamBroker) Publish(ctx context.Context, event OutboxEvent) error {
+	return b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.stream,
+		MaxLen: b.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"id":             event.ID,
+			"type":           event.Type,
+			"aggregate_type": event.AggregateType,
+			"aggregate_id":   event.AggregateID,
+			"payload":        string(event.Payload),
+			"created_at":     event.CreatedAt.Format(time.RFC3339Nano),
+		},
+	}).Err()
+}
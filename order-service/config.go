@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"time"
+)
+
+type Config struct {
+	ApplicationConfig
+}
+
+type ApplicationConfig struct {
+	Server   ServerConfig      `yaml:"server"`
+	Auth     AuthConfig        `yaml:"auth"`
+	Database DatabaseConfig    `yaml:"database"`
+	Redis    RedisConfig       `yaml:"redis"`
+	Outbox   OutboxConfig      `yaml:"outbox"`
+	Broker   BrokerConfig      `yaml:"broker"`
+	Saga     SagaConfig        `yaml:"saga"`
+	Services ServicesConfig    `yaml:"services"`
+	OAuth    OAuthClientConfig `yaml:"oauth"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port"`
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+}
+
+// AuthConfig points the service at the keys auth-service publishes, which
+// it verifies access tokens with.
+type AuthConfig struct {
+	JWKSURL         string        `yaml:"jwksUrl"`
+	Issuer          string        `yaml:"issuer"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// RedisConfig is optional; without an address the service falls back to
+// in-memory stores.
+type RedisConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"pollInterval"`
+	BatchSize    int           `yaml:"batchSize"`
+	MaxAttempts  int           `yaml:"maxAttempts"`
+	RetryBackoff time.Duration `yaml:"retryBackoff"`
+}
+
+// BrokerConfig selects where outbox events are published: "redis" for a Redis
+// stream, anything else for the in-process broker.
+type BrokerConfig struct {
+	Type   string `yaml:"type"`
+	Stream string `yaml:"stream"`
+	MaxLen int64  `yaml:"maxLen"`
+}
+
+type SagaConfig struct {
+	StepTimeout          time.Duration            `yaml:"stepTimeout"`
+	StepTimeouts         map[string]time.Duration `yaml:"stepTimeouts"`
+	CompensationAttempts int                      `yaml:"compensationAttempts"`
+	CompensationBackoff  time.Duration            `yaml:"compensationBackoff"`
+	// PaymentLimit configures the fake payment service, which declines
+	// payments above it. Zero accepts everything.
+	PaymentLimit int64 `yaml:"paymentLimit"`
+}
+
+// ServicesConfig holds base URLs of the services the order service calls.
+// Without a user service URL every user is assumed to exist; without a catalog
+// service URL stock is reserved in an in-memory fake.
+type ServicesConfig struct {
+	UserServiceURL    string `yaml:"userServiceUrl"`
+	CatalogServiceURL string `yaml:"catalogServiceUrl"`
+}
+
+// OAuthClientConfig holds the credentials the order service uses to obtain
+// service tokens from auth-service for its calls to user-service and
+// catalog-service.
+type OAuthClientConfig struct {
+	TokenURL     string   `yaml:"tokenUrl"`
+	ClientID     string   `yaml:"clientId"`
+	ClientSecret string   `yaml:"clientSecret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+func NewConfiguration() *Config {
+	applicationConfig := &ApplicationConfig{}
+	applicationConfig.readApplicationConfig()
+
+	return &Config{ApplicationConfig: *applicationConfig}
+}
+
+func (c *ApplicationConfig) readApplicationConfig() {
+	env, found := os.LookupEnv("ACTIVE_PROFILE")
+
+	if !found {
+		env = "local"
+	}
+
+	print("ACTIVE_PROFILE: ", env, "\n")
+
+	v := viper.New()
+	v.SetTypeByDefaultValue(true)
+	v.SetConfigName("application")
+	v.SetConfigType("yaml")
+	v.AddConfigPath("./")
+
+	readConfigErr := v.ReadInConfig()
+	if readConfigErr != nil {
+		panic("Couldn't load application configuration, cannot start. Terminating. : " + readConfigErr.Error())
+	}
+
+	sub := v.Sub(env)
+
+	unMarshallErr := sub.Unmarshal(c)
+
+	if unMarshallErr != nil {
+		panic("Configuration cannot deserialize. Terminating. : " + unMarshallErr.Error())
+	}
+}
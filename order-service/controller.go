@@ -0,0 +1,188 @@
+package main
+
+import (
+	"authz"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"idempotency"
+	"io"
+	"net/http"
+)
+
+type OrderController struct {
+	orderService     IOrderService
+	sagaOrchestrator ISagaOrchestrator
+	idempotency      *idempotency.Middleware
+}
+
+func NewOrderController(orderService IOrderService, sagaOrchestrator ISagaOrchestrator, idempotency *idempotency.Middleware) *OrderController {
+	return &OrderController{
+		orderService:     orderService,
+		sagaOrchestrator: sagaOrchestrator,
+		idempotency:      idempotency,
+	}
+}
+
+func (o *OrderController) create(w http.ResponseWriter, r *http.Request) {
+	userId, ok := o.getUserId(w, r)
+	if !ok {
+		return
+	}
+
+	var createOrder CreateOrder
+	if err := json.NewDecoder(r.Body).Decode(&createOrder); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	order, err := o.orderService.Create(userId, createOrder)
+	if err != nil {
+		o.handleError(w, err, "Error creating order")
+		return
+	}
+
+	o.writeJSON(w, http.StatusCreated, order)
+}
+
+func (o *OrderController) getAll(w http.ResponseWriter, r *http.Request) {
+	userId, ok := o.getUserId(w, r)
+	if !ok {
+		return
+	}
+
+	orders, err := o.orderService.GetAllByUserId(userId)
+	if err != nil {
+		o.handleError(w, err, "Error fetching orders")
+		return
+	}
+
+	o.writeJSON(w, http.StatusOK, orders)
+}
+
+func (o *OrderController) getById(w http.ResponseWriter, r *http.Request) {
+	userId, ok := o.getUserId(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := o.orderService.GetById(mux.Vars(r)["id"], userId)
+	if err != nil {
+		o.handleError(w, err, "Error fetching order")
+		return
+	}
+
+	o.writeJSON(w, http.StatusOK, order)
+}
+
+func (o *OrderController) cancel(w http.ResponseWriter, r *http.Request) {
+	userId, ok := o.getUserId(w, r)
+	if !ok {
+		return
+	}
+
+	var cancelOrder CancelOrder
+	if err := json.NewDecoder(r.Body).Decode(&cancelOrder); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	order, err := o.orderService.Cancel(mux.Vars(r)["id"], userId, cancelOrder.Reason)
+	if err != nil {
+		o.handleError(w, err, "Error cancelling order")
+		return
+	}
+
+	o.writeJSON(w, http.StatusOK, order)
+}
+
+func (o *OrderController) getHistory(w http.ResponseWriter, r *http.Request) {
+	userId, ok := o.getUserId(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := o.orderService.GetHistory(mux.Vars(r)["id"], userId)
+	if err != nil {
+		o.handleError(w, err, "Error fetching order history")
+		return
+	}
+
+	o.writeJSON(w, http.StatusOK, history)
+}
+
+func (o *OrderController) place(w http.ResponseWriter, r *http.Request) {
+	userId, ok := o.getUserId(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get(authz.UserEmailVerifiedHeader) != "true" {
+		http.Error(w, "Email address must be verified to place orders", http.StatusForbidden)
+		return
+	}
+
+	saga, err := o.sagaOrchestrator.Place(mux.Vars(r)["id"], userId)
+	if err != nil {
+		o.handleError(w, err, "Error placing order")
+		return
+	}
+
+	o.writeJSON(w, http.StatusAccepted, saga)
+}
+
+func (o *OrderController) getPlacement(w http.ResponseWriter, r *http.Request) {
+	userId, ok := o.getUserId(w, r)
+	if !ok {
+		return
+	}
+
+	saga, err := o.sagaOrchestrator.GetByOrderId(mux.Vars(r)["id"], userId)
+	if err != nil {
+		o.handleError(w, err, "Error fetching order placement")
+		return
+	}
+
+	o.writeJSON(w, http.StatusOK, saga)
+}
+
+func (o *OrderController) getUserId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userId := r.Header.Get(authz.UserIdHeader)
+	if userId == "" {
+		http.Error(w, "Missing user identity", http.StatusUnauthorized)
+		return "", false
+	}
+	return userId, true
+}
+
+func (o *OrderController) handleError(w http.ResponseWriter, err error, message string) {
+	var transitionErr *TransitionError
+	switch {
+	case errors.Is(err, ErrOrderNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+	case errors.Is(err, ErrInvalidOrder):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.As(err, &transitionErr), errors.Is(err, ErrStatusChanged), errors.Is(err, ErrSagaExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+func (o *OrderController) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (o *OrderController) RegisterRoutes(r *mux.Router) {
+	read := authz.RequirePermissions("orders:read")
+	write := authz.RequirePermissions("orders:write")
+
+	r.Handle("/orders", write(o.idempotency.Handler(o.create))).Methods("POST")
+	r.Handle("/orders", read(http.HandlerFunc(o.getAll))).Methods("GET")
+	r.Handle("/orders/{id}", read(http.HandlerFunc(o.getById))).Methods("GET")
+	r.Handle("/orders/{id}/cancel", write(o.idempotency.Handler(o.cancel))).Methods("POST")
+	r.Handle("/orders/{id}/history", read(http.HandlerFunc(o.getHistory))).Methods("GET")
+	r.Handle("/orders/{id}/place", write(o.idempotency.Handler(o.place))).Methods("POST")
+	r.Handle("/orders/{id}/placement", read(http.HandlerFunc(o.getPlacement))).Methods("GET")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"authz"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryOrderRepository keeps orders in memory and, like the Postgres
+// repository, only applies a status change to an order still in its From
+// status.
+type memoryOrderRepository struct {
+	mu      sync.Mutex
+	orders  map[string]Order
+	history map[string][]StatusChange
+}
+
+func newMemoryOrderRepository() *memoryOrderRepository {
+	return &memoryOrderRepository{
+		orders:  make(map[string]Order),
+		history: make(map[string][]StatusChange),
+	}
+}
+
+func (r *memoryOrderRepository) Save(order Order, change StatusChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[order.ID] = order
+	r.history[order.ID] = append(r.history[order.ID], change)
+	return nil
+}
+
+func (r *memoryOrderRepository) FindById(id string) (Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
+	}
+	return order, nil
+}
+
+func (r *memoryOrderRepository) FindAllByUserId(userId string) ([]Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var orders []Order
+	for _, order := range r.orders {
+		if order.UserID == userId {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (r *memoryOrderRepository) UpdateStatus(change StatusChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[change.OrderID]
+	if !ok || order.Status != change.From {
+		return fmt.Errorf("%w: %s", ErrStatusChanged, change.OrderID)
+	}
+	order.Status = change.To
+	order.UpdatedAt = change.CreatedAt
+	r.orders[order.ID] = order
+	r.history[order.ID] = append(r.history[order.ID], change)
+	return nil
+}
+
+func (r *memoryOrderRepository) FindHistory(id string) ([]StatusChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]StatusChange(nil), r.history[id]...), nil
+}
+
+// createTestOrder creates a pending order for u1 and walks it through the
+// given statuses.
+func createTestOrder(t *testing.T, orderService *OrderService, amount int64, statuses ...Status) Order {
+	t.Helper()
+	order, err := orderService.Create("u1", CreateOrder{
+		Currency: "usd",
+		Items:    []CreateOrderItem{{SKU: "sku-1", Quantity: 1, UnitPrice: amount}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if order, err = orderService.Transition(order.ID, status, "test", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return order
+}
+
+func TestOrderControllerCancel(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []Status
+		userId   string
+		want     int
+	}{
+		{"pending order", nil, "u1", http.StatusOK},
+		{"confirmed order", []Status{StatusConfirmed}, "u1", http.StatusOK},
+		{"shipped order", []Status{StatusConfirmed, StatusPaid, StatusShipped}, "u1", http.StatusConflict},
+		{"already cancelled", []Status{StatusCancelled}, "u1", http.StatusConflict},
+		{"another user's order", nil, "u2", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderService := NewOrderService(newMemoryOrderRepository())
+			order := createTestOrder(t, orderService, 100, tt.statuses...)
+			controller := &OrderController{orderService: orderService}
+
+			r := httptest.NewRequest(http.MethodPost, "/orders/"+order.ID+"/cancel", strings.NewReader(`{"reason":"changed my mind"}`))
+			r.Header.Set(authz.UserIdHeader, tt.userId)
+			r = mux.SetURLVars(r, map[string]string{"id": order.ID})
+			w := httptest.NewRecorder()
+			controller.cancel(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"sync"
+)
+
+type IInventoryService interface {
+	// Reserve holds stock for all items of an order. Reserving the same order
+	// twice must return the existing reservation.
+	Reserve(context.Context, string, []OrderItem) (string, error)
+	Confirm(context.Context, string) error
+	Release(context.Context, string) error
+	ReleaseByOrderId(context.Context, string) error
+}
+
+// FakeInventoryService keeps stock levels in memory. SKUs without a configured
+// stock level are treated as unlimited.
+type FakeInventoryService struct {
+	mu           sync.Mutex
+	stock        map[string]int
+	reservations map[string]fakeReservation
+	byOrder      map[string]string
+}
+
+type fakeReservation struct {
+	orderId   string
+	items     []OrderItem
+	confirmed bool
+}
+
+func NewFakeInventoryService(stock map[string]int) *FakeInventoryService {
+	if stock == nil {
+		stock = map[string]int{}
+	}
+	return &FakeInventoryService{
+		stock:        stock,
+		reservations: make(map[string]fakeReservation),
+		byOrder:      make(map[string]string),
+	}
+}
+
+func (s *FakeInventoryService) Reserve(ctx context.Context, orderId string, items []OrderItem) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.byOrder[orderId]; ok {
+		return id, nil
+	}
+
+	for _, item := range items {
+		if available, ok := s.stock[item.SKU]; ok && available < item.Quantity {
+			return "", fmt.Errorf("insufficient stock for sku %s", item.SKU)
+		}
+	}
+	for _, item := range items {
+		if _, ok := s.stock[item.SKU]; ok {
+			s.stock[item.SKU] -= item.Quantity
+		}
+	}
+
+	id := uuid.New().String()
+	s.reservations[id] = fakeReservation{orderId: orderId, items: items}
+	s.byOrder[orderId] = id
+	return id, nil
+}
+
+func (s *FakeInventoryService) Confirm(ctx context.Context, reservationId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reservation, ok := s.reservations[reservationId]
+	if !ok {
+		return fmt.Errorf("reservation %s not found", reservationId)
+	}
+	reservation.confirmed = true
+	s.reservations[reservationId] = reservation
+	return nil
+}
+
+func (s *FakeInventoryService) Release(ctx context.Context, reservationId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reservation, ok := s.reservations[reservationId]
+	if !ok {
+		return nil
+	}
+	for _, item := range reservation.items {
+		if _, ok := s.stock[item.SKU]; ok {
+			s.stock[item.SKU] += item.Quantity
+		}
+	}
+	delete(s.reservations, reservationId)
+	delete(s.byOrder, reservation.orderId)
+	return nil
+}
+
+func (s *FakeInventoryService) ReleaseByOrderId(ctx context.Context, orderId string) error {
+	s.mu.Lock()
+	id, ok := s.byOrder[orderId]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.Release(ctx, id)
+}
+
+// HTTPInventoryService reserves stock in the catalog service with a service
+// token carrying the catalog.reserve scope.
+type HTTPInventoryService struct {
+	baseURL string
+	tokens  ITokenSource
+	client  *http.Client
+}
+
+func NewHTTPInventoryService(baseURL string, tokens ITokenSource) *HTTPInventoryService {
+	return &HTTPInventoryService{
+		baseURL: baseURL,
+		tokens:  tokens,
+		client:  &http.Client{},
+	}
+}
+
+type reservationRequest struct {
+	OrderID string                   `json:"order_id"`
+	Items   []reservationRequestItem `json:"items"`
+}
+
+type reservationRequestItem struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+type reservationResponse struct {
+	ID string `json:"id"`
+}
+
+func (s *HTTPInventoryService) Reserve(ctx context.Context, orderId string, items []OrderItem) (string, error) {
+	request := reservationRequest{OrderID: orderId}
+	for _, item := range items {
+		request.Items = append(request.Items, reservationRequestItem{SKU: item.SKU, Quantity: item.Quantity})
+	}
+
+	var reservation reservationResponse
+	if err := s.post(ctx, "/reservations", request, http.StatusCreated, &reservation); err != nil {
+		return "", err
+	}
+	return reservation.ID, nil
+}
+
+func (s *HTTPInventoryService) Confirm(ctx context.Context, reservationId string) error {
+	return s.post(ctx, "/reservations/"+reservationId+"/confirm", nil, http.StatusOK, nil)
+}
+
+func (s *HTTPInventoryService) Release(ctx context.Context, reservationId string) error {
+	return s.post(ctx, "/reservations/"+reservationId+"/release", nil, http.StatusOK, nil)
+}
+
+func (s *HTTPInventoryService) ReleaseByOrderId(ctx context.Context, orderId string) error {
+	return s.post(ctx, "/reservations/orders/"+orderId+"/release", nil, http.StatusNoContent, nil)
+}
+
+func (s *HTTPInventoryService) post(ctx context.Context, path string, body interface{}, expected int, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach catalog service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expected {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("catalog service responded with %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding response: %w", err)
+		}
+	}
+	return nil
+}
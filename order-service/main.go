@@ -0,0 +1,96 @@
+package main
+
+import (
+	"authz"
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"idempotency"
+	"log"
+	"net/http"
+	"time"
+)
+
+func main() {
+	cfg := NewConfiguration()
+
+	db, err := NewPostgresDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error initializing database: %v", err)
+	}
+
+	var redisClient *redis.Client
+	if cfg.Redis.Addr != "" {
+		redisClient = InitializeRedis(cfg.Redis)
+	}
+
+	outboxRelay := NewOutboxRelay(db, newBroker(cfg.Broker, redisClient), cfg.Outbox)
+	outboxRelay.Start(context.Background())
+
+	router := mux.NewRouter()
+	router.Use(authz.Authenticate(newTokenVerifier(cfg.Auth, redisClient)))
+
+	orderRepository := NewPostgresRepository(db)
+	orderService := NewOrderService(orderRepository)
+
+	sagaRepository := NewPostgresSagaRepository(db)
+	serviceTokens := NewClientCredentialsTokenSource(cfg.OAuth)
+	sagaOrchestrator := NewSagaOrchestrator(sagaRepository, orderService, newUserClient(cfg.Services, serviceTokens),
+		newInventoryService(cfg.Services, serviceTokens), NewFakePaymentService(cfg.Saga.PaymentLimit), cfg.Saga)
+	if err := sagaOrchestrator.Resume(context.Background()); err != nil {
+		log.Fatalf("Error resuming sagas: %v", err)
+	}
+
+	idempotencyMiddleware := idempotency.NewMiddleware(newIdempotencyStore(redisClient), time.Hour*24, nil)
+	orderController := NewOrderController(orderService, sagaOrchestrator, idempotencyMiddleware)
+	orderController.RegisterRoutes(router)
+
+	log.Printf("Server is running on port %s", cfg.Server.Port)
+	if err := http.ListenAndServe(":"+cfg.Server.Port, router); err != nil {
+		log.Fatalf("Could not start server: %v\n", err)
+	}
+}
+
+func newIdempotencyStore(redisClient *redis.Client) idempotency.IStore {
+	if redisClient == nil {
+		log.Println("No Redis configured, using in-memory idempotency store")
+		return idempotency.NewMemoryStore()
+	}
+	return idempotency.NewRedisStore(redisClient)
+}
+
+func newBroker(cfg BrokerConfig, redisClient *redis.Client) IBroker {
+	if cfg.Type != "redis" || redisClient == nil {
+		log.Println("Publishing outbox events to the in-process broker")
+		return NewInProcessBroker()
+	}
+	return NewRedisStreamBroker(redisClient, cfg.Stream, cfg.MaxLen)
+}
+
+func newUserClient(cfg ServicesConfig, tokens ITokenSource) IUserClient {
+	if cfg.UserServiceURL == "" {
+		log.Println("No user service configured, skipping user validation")
+		return NewFakeUserClient()
+	}
+	return NewHTTPUserClient(cfg.UserServiceURL, tokens)
+}
+
+func newInventoryService(cfg ServicesConfig, tokens ITokenSource) IInventoryService {
+	if cfg.CatalogServiceURL == "" {
+		log.Println("No catalog service configured, reserving stock in memory")
+		return NewFakeInventoryService(nil)
+	}
+	return NewHTTPInventoryService(cfg.CatalogServiceURL, tokens)
+}
+
+// newTokenVerifier checks access tokens against the revocation list in Redis
+// when Redis is configured.
+func newTokenVerifier(cfg AuthConfig, redisClient *redis.Client) *authz.TokenVerifier {
+	var revocations authz.IRevocationList
+	if redisClient != nil {
+		revocations = authz.NewRedisRevocationList(redisClient)
+	} else {
+		log.Println("No Redis configured, revoked access tokens are accepted until they expire")
+	}
+	return authz.NewTokenVerifier(authz.NewJWKSKeySet(cfg.JWKSURL, cfg.RefreshInterval), cfg.Issuer, revocations)
+}
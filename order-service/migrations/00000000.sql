@@ -0,0 +1,21 @@
+CREATE TABLE orders (
+                        id UUID PRIMARY KEY,
+                        user_id UUID NOT NULL,
+                        status VARCHAR(32) NOT NULL,
+                        currency CHAR(3) NOT NULL,
+                        total_amount BIGINT NOT NULL,
+                        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                        updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX orders_user_id_idx ON orders (user_id);
+
+CREATE TABLE order_items (
+                             id UUID PRIMARY KEY,
+                             order_id UUID NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+                             sku VARCHAR(64) NOT NULL,
+                             quantity INT NOT NULL CHECK (quantity > 0),
+                             unit_price BIGINT NOT NULL CHECK (unit_price >= 0)
+);
+
+CREATE INDEX order_items_order_id_idx ON order_items (order_id);
\ No newline at end of file
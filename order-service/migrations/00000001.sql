@@ -0,0 +1,15 @@
+ALTER TABLE orders
+    ADD CONSTRAINT orders_status_check
+        CHECK (status IN ('pending', 'confirmed', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+CREATE TABLE order_status_history (
+                                      id UUID PRIMARY KEY,
+                                      order_id UUID NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+                                      from_status VARCHAR(32),
+                                      to_status VARCHAR(32) NOT NULL,
+                                      actor VARCHAR(255) NOT NULL,
+                                      reason TEXT NOT NULL DEFAULT '',
+                                      created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX order_status_history_order_id_idx ON order_status_history (order_id, created_at);
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE outbox (
+                        id UUID PRIMARY KEY,
+                        aggregate_type VARCHAR(64) NOT NULL,
+                        aggregate_id VARCHAR(64) NOT NULL,
+                        event_type VARCHAR(128) NOT NULL,
+                        payload JSONB NOT NULL,
+                        status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'published', 'dead')),
+                        attempts INT NOT NULL DEFAULT 0,
+                        last_error TEXT,
+                        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                        published_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE status = 'pending';
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE order_sagas (
+                             id UUID PRIMARY KEY,
+                             order_id UUID NOT NULL UNIQUE REFERENCES orders (id) ON DELETE CASCADE,
+                             user_id UUID NOT NULL,
+                             step VARCHAR(64) NOT NULL,
+                             status VARCHAR(32) NOT NULL CHECK (status IN ('running', 'compensating', 'completed', 'compensated', 'failed')),
+                             reservation_id VARCHAR(128) NOT NULL DEFAULT '',
+                             payment_id VARCHAR(128) NOT NULL DEFAULT '',
+                             compensation_log JSONB NOT NULL DEFAULT '[]',
+                             last_error TEXT NOT NULL DEFAULT '',
+                             created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                             updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX order_sagas_unfinished_idx ON order_sagas (created_at) WHERE status IN ('running', 'compensating');
\ No newline at end of file
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrInvalidOrder  = errors.New("invalid order")
+	ErrStatusChanged = errors.New("order status was changed concurrently")
+)
+
+// Amounts are stored in minor units of the order currency (e.g. cents for
+// USD) to avoid floating point rounding.
+type Order struct {
+	ID          string      `json:"id"`
+	UserID      string      `json:"user_id"`
+	Status      Status      `json:"status"`
+	Currency    string      `json:"currency"`
+	TotalAmount int64       `json:"total_amount"`
+	Items       []OrderItem `json:"items"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+type OrderItem struct {
+	ID        string `json:"id"`
+	SKU       string `json:"sku"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice int64  `json:"unit_price"`
+}
+
+type IOrderService interface {
+	Create(string, CreateOrder) (Order, error)
+	GetById(string, string) (Order, error)
+	GetAllByUserId(string) ([]Order, error)
+	Cancel(string, string, string) (Order, error)
+	Transition(string, Status, string, string) (Order, error)
+	GetHistory(string, string) ([]StatusChange, error)
+}
+
+type CreateOrder struct {
+	Currency string            `json:"currency"`
+	Items    []CreateOrderItem `json:"items"`
+}
+
+type CreateOrderItem struct {
+	SKU       string `json:"sku"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice int64  `json:"unit_price"`
+}
+
+type CancelOrder struct {
+	Reason string `json:"reason"`
+}
+
+// OrderStatusChangedPayload is the payload of order.status_changed events.
+type OrderStatusChangedPayload struct {
+	OrderID string `json:"order_id"`
+	UserID  string `json:"user_id"`
+	From    Status `json:"from"`
+	To      Status `json:"to"`
+	Actor   string `json:"actor"`
+	Reason  string `json:"reason"`
+}
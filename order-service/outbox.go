@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+const (
+	OrderAggregate = "order"
+
+	OrderCreatedEvent       = "order.created"
+	OrderStatusChangedEvent = "order.status_changed"
+)
+
+const (
+	outboxPending   = "pending"
+	outboxPublished = "published"
+	outboxDead      = "dead"
+)
+
+type OutboxEvent struct {
+	ID            string          `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+func NewOutboxEvent(aggregateType, aggregateId, eventType string, payload interface{}) (OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+	return OutboxEvent{
+		ID:            uuid.New().String(),
+		AggregateType: aggregateType,
+		AggregateID:   aggregateId,
+		Type:          eventType,
+		Payload:       data,
+		CreatedAt:     time.Now().UTC(),
+	}, nil
+}
+
+// saveOutboxEvent must be called with the transaction that performs the state
+// change the event describes, so that both are committed or neither is.
+func saveOutboxEvent(tx *sql.Tx, event OutboxEvent) error {
+	query := `INSERT INTO outbox (id, aggregate_type, aggregate_id, event_type, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := tx.Exec(query, event.ID, event.AggregateType, event.AggregateID, event.Type,
+		[]byte(event.Payload), event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save outbox event: %w", err)
+	}
+	return nil
+}
+
+type outboxEntry struct {
+	event    OutboxEvent
+	attempts int
+}
+
+// OutboxRelay publishes committed outbox events to the broker. Rows are locked
+// with SKIP LOCKED while they are published so several replicas can relay
+// concurrently without publishing the same row twice at the same time. An
+// event is only marked published after the broker accepted it, which gives
+// at-least-once delivery; consumers must deduplicate on the event id.
+type OutboxRelay struct {
+	db     *sql.DB
+	broker IBroker
+	cfg    OutboxConfig
+}
+
+func NewOutboxRelay(db *sql.DB, broker IBroker, cfg OutboxConfig) *OutboxRelay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = time.Second
+	}
+	return &OutboxRelay{
+		db:     db,
+		broker: broker,
+		cfg:    cfg,
+	}
+}
+
+func (r *OutboxRelay) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for {
+					n, err := r.relayBatch(ctx)
+					if err != nil {
+						log.Printf("Outbox relay error: %v", err)
+					}
+					// Keep draining while full batches come back.
+					if err != nil || n < r.cfg.BatchSize {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	entries, err := r.lockPending(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		publishErr := r.broker.Publish(publishCtx, entry.event)
+		cancel()
+
+		if publishErr == nil {
+			if err := r.markPublished(tx, entry); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if err := r.markFailed(tx, entry, publishErr); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox batch: %w", err)
+	}
+	return len(entries), nil
+}
+
+func (r *OutboxRelay) lockPending(tx *sql.Tx) ([]outboxEntry, error) {
+	query := `SELECT id, aggregate_type, aggregate_id, event_type, payload, created_at, attempts
+		FROM outbox
+		WHERE status = $1 AND next_attempt_at <= now()
+		ORDER BY created_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(query, outboxPending, r.cfg.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []outboxEntry
+	for rows.Next() {
+		var entry outboxEntry
+		var payload []byte
+		if err := rows.Scan(&entry.event.ID, &entry.event.AggregateType, &entry.event.AggregateID,
+			&entry.event.Type, &payload, &entry.event.CreatedAt, &entry.attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		entry.event.Payload = payload
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *OutboxRelay) markPublished(tx *sql.Tx, entry outboxEntry) error {
+	query := `UPDATE outbox SET status = $2, attempts = attempts + 1, published_at = now(), last_error = NULL
+		WHERE id = $1`
+	if _, err := tx.Exec(query, entry.event.ID, outboxPublished); err != nil {
+		return fmt.Errorf("failed to mark outbox event published: %w", err)
+	}
+	return nil
+}
+
+// markFailed schedules the event for another attempt with exponential
+// backoff, or moves it to the dead state once MaxAttempts is reached.
+func (r *OutboxRelay) markFailed(tx *sql.Tx, entry outboxEntry, publishErr error) error {
+	attempts := entry.attempts + 1
+	status := outboxPending
+	if attempts >= r.cfg.MaxAttempts {
+		status = outboxDead
+		log.Printf("Outbox event %s (%s) moved to dead state after %d attempts: %v",
+			entry.event.ID, entry.event.Type, attempts, publishErr)
+	}
+
+	backoff := r.cfg.RetryBackoff << uint(min(attempts-1, 16))
+	if backoff > time.Hour {
+		backoff = time.Hour
+	}
+
+	query := `UPDATE outbox SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5 WHERE id = $1`
+	_, err := tx.Exec(query, entry.event.ID, status, attempts, publishErr.Error(), time.Now().Add(backoff))
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+	return nil
+}
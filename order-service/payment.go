@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+)
+
+type IPaymentService interface {
+	// Capture charges the order total. Capturing the same order twice must
+	// return the existing payment instead of charging again.
+	Capture(context.Context, string, int64, string) (string, error)
+	Void(context.Context, string) error
+	VoidByOrderId(context.Context, string) error
+}
+
+// FakePaymentService accepts every payment up to a configurable limit in minor
+// units; a limit of zero accepts everything.
+type FakePaymentService struct {
+	mu       sync.Mutex
+	limit    int64
+	payments map[string]string
+	byOrder  map[string]string
+}
+
+func NewFakePaymentService(limit int64) *FakePaymentService {
+	return &FakePaymentService{
+		limit:    limit,
+		payments: make(map[string]string),
+		byOrder:  make(map[string]string),
+	}
+}
+
+func (s *FakePaymentService) Capture(ctx context.Context, orderId string, amount int64, currency string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.byOrder[orderId]; ok {
+		return id, nil
+	}
+	if s.limit > 0 && amount > s.limit {
+		return "", fmt.Errorf("payment of %d %s declined", amount, currency)
+	}
+
+	id := uuid.New().String()
+	s.payments[id] = orderId
+	s.byOrder[orderId] = id
+	return id, nil
+}
+
+func (s *FakePaymentService) Void(ctx context.Context, paymentId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if orderId, ok := s.payments[paymentId]; ok {
+		delete(s.byOrder, orderId)
+		delete(s.payments, paymentId)
+	}
+	return nil
+}
+
+func (s *FakePaymentService) VoidByOrderId(ctx context.Context, orderId string) error {
+	s.mu.Lock()
+	id, ok := s.byOrder[orderId]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.Void(ctx, id)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func (r *PostgresRepository) Save(order Order, change StatusChange) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO orders (id, user_id, status, currency, total_amount, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.Exec(query, order.ID, order.UserID, order.Status, order.Currency, order.TotalAmount,
+		order.CreatedAt, order.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save order: %w", err)
+	}
+
+	itemQuery := `INSERT INTO order_items (id, order_id, sku, quantity, unit_price) VALUES ($1, $2, $3, $4, $5)`
+	for _, item := range order.Items {
+		if _, err := tx.Exec(itemQuery, item.ID, order.ID, item.SKU, item.Quantity, item.UnitPrice); err != nil {
+			return fmt.Errorf("failed to save order item: %w", err)
+		}
+	}
+
+	if err := insertStatusChange(tx, change); err != nil {
+		return err
+	}
+
+	event, err := NewOutboxEvent(OrderAggregate, order.ID, OrderCreatedEvent, order)
+	if err != nil {
+		return err
+	}
+	if err := saveOutboxEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit order: %w", err)
+	}
+	return nil
+}
+
+// FindById reports ids that are not UUIDs as not found, rather than letting
+// the uuid cast in Postgres fail.
+func (r *PostgresRepository) FindById(id string) (Order, error) {
+	if _, err := uuid.Parse(id); err != nil || len(id) != 36 {
+		return Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
+	}
+
+	query := `SELECT id, user_id, status, currency, total_amount, created_at, updated_at FROM orders WHERE id = $1`
+	row := r.db.QueryRow(query, id)
+
+	var order Order
+	if err := row.Scan(&order.ID, &order.UserID, &order.Status, &order.Currency, &order.TotalAmount,
+		&order.CreatedAt, &order.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
+		}
+		return Order{}, fmt.Errorf("failed to find order by id: %w", err)
+	}
+
+	orders := []Order{order}
+	if err := r.loadItems(orders); err != nil {
+		return Order{}, err
+	}
+
+	return orders[0], nil
+}
+
+func (r *PostgresRepository) FindAllByUserId(userId string) ([]Order, error) {
+	query := `SELECT id, user_id, status, currency, total_amount, created_at, updated_at
+		FROM orders WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := r.db.Query(query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find orders by user id: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		var order Order
+		if err := rows.Scan(&order.ID, &order.UserID, &order.Status, &order.Currency, &order.TotalAmount,
+			&order.CreatedAt, &order.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	if err := r.loadItems(orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// UpdateStatus moves the order from change.From to change.To and appends the
+// change to the status history in one transaction. The update is conditional
+// on the current status so that two concurrent transitions cannot both win.
+func (r *PostgresRepository) UpdateStatus(change StatusChange) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE orders SET status = $3, updated_at = $4 WHERE id = $1 AND status = $2 RETURNING user_id`
+	var userId string
+	err = tx.QueryRow(query, change.OrderID, change.From, change.To, change.CreatedAt).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrStatusChanged, change.OrderID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	if err := insertStatusChange(tx, change); err != nil {
+		return err
+	}
+
+	event, err := NewOutboxEvent(OrderAggregate, change.OrderID, OrderStatusChangedEvent, OrderStatusChangedPayload{
+		OrderID: change.OrderID,
+		UserID:  userId,
+		From:    change.From,
+		To:      change.To,
+		Actor:   change.Actor,
+		Reason:  change.Reason,
+	})
+	if err != nil {
+		return err
+	}
+	if err := saveOutboxEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit status change: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) FindHistory(orderId string) ([]StatusChange, error) {
+	query := `SELECT id, order_id, COALESCE(from_status, ''), to_status, actor, reason, created_at
+		FROM order_status_history WHERE order_id = $1 ORDER BY created_at, id`
+	rows, err := r.db.Query(query, orderId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find order status history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []StatusChange{}
+	for rows.Next() {
+		var change StatusChange
+		if err := rows.Scan(&change.ID, &change.OrderID, &change.From, &change.To, &change.Actor,
+			&change.Reason, &change.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan status change: %w", err)
+		}
+		history = append(history, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return history, nil
+}
+
+func insertStatusChange(tx *sql.Tx, change StatusChange) error {
+	var from sql.NullString
+	if change.From != "" {
+		from = sql.NullString{String: string(change.From), Valid: true}
+	}
+
+	query := `INSERT INTO order_status_history (id, order_id, from_status, to_status, actor, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := tx.Exec(query, change.ID, change.OrderID, from, change.To, change.Actor, change.Reason, change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save status change: %w", err)
+	}
+	return nil
+}
+
+// loadItems fetches the line items of all given orders with a single query
+// and attaches them in place.
+func (r *PostgresRepository) loadItems(orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(orders))
+	index := make(map[string]int, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+		index[order.ID] = i
+		orders[i].Items = []OrderItem{}
+	}
+
+	query := `SELECT id, order_id, sku, quantity, unit_price FROM order_items WHERE order_id = ANY($1) ORDER BY sku`
+	rows, err := r.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to find order items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderItem
+		var orderId string
+		if err := rows.Scan(&item.ID, &orderId, &item.SKU, &item.Quantity, &item.UnitPrice); err != nil {
+			return fmt.Errorf("failed to scan order item: %w", err)
+		}
+		i := index[orderId]
+		orders[i].Items = append(orders[i].Items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return nil
+}
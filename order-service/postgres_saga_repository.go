@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+type PostgresSagaRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSagaRepository(db *sql.DB) *PostgresSagaRepository {
+	return &PostgresSagaRepository{db: db}
+}
+
+func (r *PostgresSagaRepository) Save(saga Saga) error {
+	compensationLog, err := json.Marshal(saga.CompensationLog)
+	if err != nil {
+		return fmt.Errorf("failed to marshal compensation log: %w", err)
+	}
+
+	query := `INSERT INTO order_sagas (id, order_id, user_id, step, status, reservation_id, payment_id,
+		compensation_log, last_error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err = r.db.Exec(query, saga.ID, saga.OrderID, saga.UserID, saga.Step, saga.Status, saga.ReservationID,
+		saga.PaymentID, compensationLog, saga.LastError, saga.CreatedAt, saga.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w: %s", ErrSagaExists, saga.OrderID)
+		}
+		return fmt.Errorf("failed to save saga: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSagaRepository) Update(saga Saga) error {
+	compensationLog, err := json.Marshal(saga.CompensationLog)
+	if err != nil {
+		return fmt.Errorf("failed to marshal compensation log: %w", err)
+	}
+
+	query := `UPDATE order_sagas SET step = $2, status = $3, reservation_id = $4, payment_id = $5,
+		compensation_log = $6, last_error = $7, updated_at = $8 WHERE id = $1`
+	_, err = r.db.Exec(query, saga.ID, saga.Step, saga.Status, saga.ReservationID, saga.PaymentID,
+		compensationLog, saga.LastError, saga.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update saga: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSagaRepository) FindByOrderId(orderId string) (Saga, error) {
+	query := `SELECT id, order_id, user_id, step, status, reservation_id, payment_id, compensation_log,
+		last_error, created_at, updated_at FROM order_sagas WHERE order_id = $1`
+	saga, err := scanSaga(r.db.QueryRow(query, orderId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Saga{}, fmt.Errorf("%w: no placement for %s", ErrOrderNotFound, orderId)
+		}
+		return Saga{}, fmt.Errorf("failed to find saga by order id: %w", err)
+	}
+	return saga, nil
+}
+
+func (r *PostgresSagaRepository) FindUnfinished() ([]Saga, error) {
+	query := `SELECT id, order_id, user_id, step, status, reservation_id, payment_id, compensation_log,
+		last_error, created_at, updated_at FROM order_sagas WHERE status IN ($1, $2) ORDER BY created_at`
+	rows, err := r.db.Query(query, SagaRunning, SagaCompensating)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find unfinished sagas: %w", err)
+	}
+	defer rows.Close()
+
+	var sagas []Saga
+	for rows.Next() {
+		saga, err := scanSaga(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saga: %w", err)
+		}
+		sagas = append(sagas, saga)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return sagas, nil
+}
+
+type rowScanner interface {
+	Scan(...interface{}) error
+}
+
+func scanSaga(row rowScanner) (Saga, error) {
+	var saga Saga
+	var compensationLog []byte
+	if err := row.Scan(&saga.ID, &saga.OrderID, &saga.UserID, &saga.Step, &saga.Status, &saga.ReservationID,
+		&saga.PaymentID, &compensationLog, &saga.LastError, &saga.CreatedAt, &saga.UpdatedAt); err != nil {
+		return Saga{}, err
+	}
+	if err := json.Unmarshal(compensationLog, &saga.CompensationLog); err != nil {
+		return Saga{}, fmt.Errorf("failed to unmarshal compensation log: %w", err)
+	}
+	return saga, nil
+}
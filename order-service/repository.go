@@ -0,0 +1,16 @@
+package main
+
+type IOrderRepository interface {
+	Save(Order, StatusChange) error
+	FindById(string) (Order, error)
+	FindAllByUserId(string) ([]Order, error)
+	UpdateStatus(StatusChange) error
+	FindHistory(string) ([]StatusChange, error)
+}
+
+type ISagaRepository interface {
+	Save(Saga) error
+	Update(Saga) error
+	FindByOrderId(string) (Saga, error)
+	FindUnfinished() ([]Saga, error)
+}
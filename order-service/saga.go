@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+type SagaStatus string
+
+const (
+	SagaRunning      SagaStatus = "running"
+	SagaCompensating SagaStatus = "compensating"
+	SagaCompleted    SagaStatus = "completed"
+	SagaCompensated  SagaStatus = "compensated"
+	// SagaFailed means a compensating action kept failing and the saga needs
+	// manual attention.
+	SagaFailed SagaStatus = "failed"
+)
+
+const (
+	StepValidateUser     = "validate_user"
+	StepReserveInventory = "reserve_inventory"
+	StepCapturePayment   = "capture_payment"
+	StepCompleteOrder    = "complete_order"
+)
+
+// sagaSteps is the order in which placement steps are executed. Compensation
+// walks it backwards.
+var sagaSteps = []string{
+	StepValidateUser,
+	StepReserveInventory,
+	StepCapturePayment,
+	StepCompleteOrder,
+}
+
+const sagaActor = "order-saga"
+
+var ErrSagaExists = errors.New("order placement already started")
+
+type Saga struct {
+	ID              string              `json:"id"`
+	OrderID         string              `json:"order_id"`
+	UserID          string              `json:"user_id"`
+	Step            string              `json:"step"`
+	Status          SagaStatus          `json:"status"`
+	ReservationID   string              `json:"reservation_id,omitempty"`
+	PaymentID       string              `json:"payment_id,omitempty"`
+	CompensationLog []CompensationEntry `json:"compensation_log"`
+	LastError       string              `json:"last_error,omitempty"`
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+}
+
+type CompensationEntry struct {
+	Step      string    `json:"step"`
+	Action    string    `json:"action"`
+	Succeeded bool      `json:"succeeded"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+func (s *Saga) compensated(step string) bool {
+	for _, entry := range s.CompensationLog {
+		if entry.Step == step && entry.Succeeded {
+			return true
+		}
+	}
+	return false
+}
+
+type ISagaOrchestrator interface {
+	Place(string, string) (Saga, error)
+	GetByOrderId(string, string) (Saga, error)
+	Resume(context.Context) error
+}
+
+// SagaOrchestrator places orders by running sagaSteps one after another. The
+// saga is persisted after every step, so that an orchestrator restarted with
+// Resume continues where the previous process stopped. Every step and every
+// compensating action must therefore be safe to execute more than once.
+type SagaOrchestrator struct {
+	sagaRepository ISagaRepository
+	orderService   IOrderService
+	userClient     IUserClient
+	inventory      IInventoryService
+	payment        IPaymentService
+	cfg            SagaConfig
+}
+
+func NewSagaOrchestrator(sagaRepository ISagaRepository, orderService IOrderService, userClient IUserClient,
+	inventory IInventoryService, payment IPaymentService, cfg SagaConfig) *SagaOrchestrator {
+	if cfg.StepTimeout <= 0 {
+		cfg.StepTimeout = 10 * time.Second
+	}
+	if cfg.CompensationAttempts <= 0 {
+		cfg.CompensationAttempts = 5
+	}
+	if cfg.CompensationBackoff <= 0 {
+		cfg.CompensationBackoff = time.Second
+	}
+	return &SagaOrchestrator{
+		sagaRepository: sagaRepository,
+		orderService:   orderService,
+		userClient:     userClient,
+		inventory:      inventory,
+		payment:        payment,
+		cfg:            cfg,
+	}
+}
+
+// Place starts the placement saga for a pending order and runs it in the
+// background. The returned saga reflects its initial state.
+func (o *SagaOrchestrator) Place(orderId, userId string) (Saga, error) {
+	order, err := o.orderService.GetById(orderId, userId)
+	if err != nil {
+		return Saga{}, err
+	}
+	if order.Status != StatusPending {
+		return Saga{}, &TransitionError{From: order.Status, To: StatusConfirmed}
+	}
+
+	now := time.Now().UTC()
+	saga := Saga{
+		ID:              uuid.New().String(),
+		OrderID:         order.ID,
+		UserID:          order.UserID,
+		Step:            sagaSteps[0],
+		Status:          SagaRunning,
+		CompensationLog: []CompensationEntry{},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := o.sagaRepository.Save(saga); err != nil {
+		return Saga{}, err
+	}
+
+	go o.run(saga)
+	return saga, nil
+}
+
+func (o *SagaOrchestrator) GetByOrderId(orderId, userId string) (Saga, error) {
+	if _, err := o.orderService.GetById(orderId, userId); err != nil {
+		return Saga{}, err
+	}
+	return o.sagaRepository.FindByOrderId(orderId)
+}
+
+// Resume picks up every saga that was still running or compensating when the
+// previous process stopped.
+func (o *SagaOrchestrator) Resume(ctx context.Context) error {
+	sagas, err := o.sagaRepository.FindUnfinished()
+	if err != nil {
+		return err
+	}
+	for _, saga := range sagas {
+		log.Printf("Resuming saga %s for order %s at step %s (%s)", saga.ID, saga.OrderID, saga.Step, saga.Status)
+		go o.run(saga)
+	}
+	return nil
+}
+
+func (o *SagaOrchestrator) run(saga Saga) {
+	for saga.Status == SagaRunning {
+		ctx, cancel := context.WithTimeout(context.Background(), o.stepTimeout(saga.Step))
+		err := o.execute(ctx, &saga)
+		cancel()
+
+		if err != nil {
+			log.Printf("Saga %s step %s failed: %v", saga.ID, saga.Step, err)
+			saga.Status = SagaCompensating
+			saga.LastError = fmt.Sprintf("%s: %v", saga.Step, err)
+		} else if next := nextStep(saga.Step); next == "" {
+			saga.Status = SagaCompleted
+		} else {
+			saga.Step = next
+		}
+
+		if !o.save(&saga) {
+			return
+		}
+	}
+
+	if saga.Status == SagaCompensating {
+		o.compensate(&saga)
+	}
+}
+
+func (o *SagaOrchestrator) execute(ctx context.Context, saga *Saga) error {
+	switch saga.Step {
+	case StepValidateUser:
+		return o.userClient.Exists(ctx, saga.UserID)
+
+	case StepReserveInventory:
+		order, err := o.orderService.GetById(saga.OrderID, saga.UserID)
+		if err != nil {
+			return err
+		}
+		reservationId, err := o.inventory.Reserve(ctx, order.ID, order.Items)
+		if err != nil {
+			return err
+		}
+		saga.ReservationID = reservationId
+		return o.ensureStatus(saga, StatusConfirmed, "stock reserved")
+
+	case StepCapturePayment:
+		order, err := o.orderService.GetById(saga.OrderID, saga.UserID)
+		if err != nil {
+			return err
+		}
+		paymentId, err := o.payment.Capture(ctx, order.ID, order.TotalAmount, order.Currency)
+		if err != nil {
+			return err
+		}
+		saga.PaymentID = paymentId
+		return nil
+
+	case StepCompleteOrder:
+		if err := o.inventory.Confirm(ctx, saga.ReservationID); err != nil {
+			return err
+		}
+		return o.ensureStatus(saga, StatusPaid, "payment captured")
+
+	default:
+		return fmt.Errorf("unknown saga step %q", saga.Step)
+	}
+}
+
+// compensate undoes the failed step and every step before it, most recent
+// first. The failed step is included because a timed out call may still have
+// taken effect. Finally the order is cancelled.
+func (o *SagaOrchestrator) compensate(saga *Saga) {
+	for i := stepIndex(saga.Step); i >= 0; i-- {
+		step := sagaSteps[i]
+		if saga.compensated(step) {
+			continue
+		}
+
+		action, compensation := o.compensation(saga, step)
+		if compensation == nil {
+			continue
+		}
+
+		if !o.compensateStep(saga, step, action, compensation) {
+			saga.Status = SagaFailed
+			o.save(saga)
+			log.Printf("Saga %s could not compensate step %s, manual intervention required", saga.ID, step)
+			return
+		}
+	}
+
+	cancelOrder := func(ctx context.Context) error {
+		return o.ensureStatus(saga, StatusCancelled, "order placement failed: "+saga.LastError)
+	}
+	if !saga.compensated("order") && !o.compensateStep(saga, "order", "cancel_order", cancelOrder) {
+		saga.Status = SagaFailed
+		o.save(saga)
+		return
+	}
+
+	saga.Status = SagaCompensated
+	o.save(saga)
+}
+
+func (o *SagaOrchestrator) compensation(saga *Saga, step string) (string, func(context.Context) error) {
+	switch step {
+	case StepReserveInventory:
+		return "release_reservation", func(ctx context.Context) error {
+			if saga.ReservationID == "" {
+				return o.inventory.ReleaseByOrderId(ctx, saga.OrderID)
+			}
+			return o.inventory.Release(ctx, saga.ReservationID)
+		}
+	case StepCapturePayment:
+		return "void_payment", func(ctx context.Context) error {
+			if saga.PaymentID == "" {
+				return o.payment.VoidByOrderId(ctx, saga.OrderID)
+			}
+			return o.payment.Void(ctx, saga.PaymentID)
+		}
+	default:
+		return "", nil
+	}
+}
+
+// compensateStep retries a compensating action with exponential backoff and
+// records every attempt in the saga's compensation log.
+func (o *SagaOrchestrator) compensateStep(saga *Saga, step, action string, compensation func(context.Context) error) bool {
+	backoff := o.cfg.CompensationBackoff
+	for attempt := 1; attempt <= o.cfg.CompensationAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), o.stepTimeout(step))
+		err := compensation(ctx)
+		cancel()
+
+		entry := CompensationEntry{
+			Step:      step,
+			Action:    action,
+			Succeeded: err == nil,
+			At:        time.Now().UTC(),
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		saga.CompensationLog = append(saga.CompensationLog, entry)
+		o.save(saga)
+
+		if err == nil {
+			return true
+		}
+
+		log.Printf("Saga %s compensation %s failed (attempt %d): %v", saga.ID, action, attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return false
+}
+
+// ensureStatus moves the order to the given status unless a previous run of
+// the same step already did.
+func (o *SagaOrchestrator) ensureStatus(saga *Saga, to Status, reason string) error {
+	order, err := o.orderService.GetById(saga.OrderID, saga.UserID)
+	if err != nil {
+		return err
+	}
+	if order.Status == to {
+		return nil
+	}
+	_, err = o.orderService.Transition(saga.OrderID, to, sagaActor, reason)
+	return err
+}
+
+func (o *SagaOrchestrator) save(saga *Saga) bool {
+	saga.UpdatedAt = time.Now().UTC()
+	if err := o.sagaRepository.Update(*saga); err != nil {
+		log.Printf("Saga %s could not be saved, it will be resumed on restart: %v", saga.ID, err)
+		return false
+	}
+	return true
+}
+
+func (o *SagaOrchestrator) stepTimeout(step string) time.Duration {
+	if timeout, ok := o.cfg.StepTimeouts[step]; ok && timeout > 0 {
+		return timeout
+	}
+	return o.cfg.StepTimeout
+}
+
+func stepIndex(step string) int {
+	for i, s := range sagaSteps {
+		if s == step {
+			return i
+		}
+	}
+	return len(sagaSteps) - 1
+}
+
+func nextStep(step string) string {
+	i := stepIndex(step)
+	if i+1 >= len(sagaSteps) {
+		return ""
+	}
+	return sagaSteps[i+1]
+}
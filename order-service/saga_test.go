@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memorySagaRepository struct {
+	mu    sync.Mutex
+	sagas map[string]Saga
+}
+
+func newMemorySagaRepository() *memorySagaRepository {
+	return &memorySagaRepository{sagas: make(map[string]Saga)}
+}
+
+func (r *memorySagaRepository) Save(saga Saga) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sagas[saga.OrderID]; ok {
+		return fmt.Errorf("%w: %s", ErrSagaExists, saga.OrderID)
+	}
+	r.sagas[saga.OrderID] = saga
+	return nil
+}
+
+func (r *memorySagaRepository) Update(saga Saga) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saga.CompensationLog = append([]CompensationEntry(nil), saga.CompensationLog...)
+	r.sagas[saga.OrderID] = saga
+	return nil
+}
+
+func (r *memorySagaRepository) FindByOrderId(orderId string) (Saga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saga, ok := r.sagas[orderId]
+	if !ok {
+		return Saga{}, fmt.Errorf("%w: no placement for %s", ErrOrderNotFound, orderId)
+	}
+	return saga, nil
+}
+
+func (r *memorySagaRepository) FindUnfinished() ([]Saga, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sagas []Saga
+	for _, saga := range r.sagas {
+		if saga.Status == SagaRunning || saga.Status == SagaCompensating {
+			sagas = append(sagas, saga)
+		}
+	}
+	return sagas, nil
+}
+
+type sagaFixture struct {
+	orders    *OrderService
+	sagas     *memorySagaRepository
+	inventory *FakeInventoryService
+	payment   *FakePaymentService
+	saga      *SagaOrchestrator
+}
+
+// newSagaFixture wires an orchestrator to in-memory fakes. sku-1 starts with
+// the given stock and the payment service declines amounts above paymentLimit.
+func newSagaFixture(stock int, paymentLimit int64) *sagaFixture {
+	f := &sagaFixture{
+		orders:    NewOrderService(newMemoryOrderRepository()),
+		sagas:     newMemorySagaRepository(),
+		inventory: NewFakeInventoryService(map[string]int{"sku-1": stock}),
+		payment:   NewFakePaymentService(paymentLimit),
+	}
+	f.saga = NewSagaOrchestrator(f.sagas, f.orders, NewFakeUserClient(), f.inventory, f.payment, SagaConfig{
+		StepTimeout:          time.Second,
+		CompensationAttempts: 2,
+		CompensationBackoff:  time.Millisecond,
+	})
+	return f
+}
+
+// waitForSaga polls the repository until the saga of the order has finished.
+func (f *sagaFixture) waitForSaga(t *testing.T, orderId string) Saga {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		saga, err := f.sagas.FindByOrderId(orderId)
+		if err == nil && saga.Status != SagaRunning && saga.Status != SagaCompensating {
+			return saga
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("saga of order %s did not finish", orderId)
+	return Saga{}
+}
+
+func (f *sagaFixture) stock() int {
+	f.inventory.mu.Lock()
+	defer f.inventory.mu.Unlock()
+	return f.inventory.stock["sku-1"]
+}
+
+func (f *sagaFixture) paid(orderId string) bool {
+	f.payment.mu.Lock()
+	defer f.payment.mu.Unlock()
+	_, ok := f.payment.byOrder[orderId]
+	return ok
+}
+
+func compensationActions(saga Saga) []string {
+	var actions []string
+	for _, entry := range saga.CompensationLog {
+		if entry.Succeeded {
+			actions = append(actions, entry.Action)
+		}
+	}
+	return actions
+}
+
+func TestSagaOrchestratorPlace(t *testing.T) {
+	tests := []struct {
+		name              string
+		stock             int
+		paymentLimit      int64
+		wantSaga          SagaStatus
+		wantOrder         Status
+		wantStock         int
+		wantPaid          bool
+		wantCompensations []string
+	}{
+		{
+			name:      "happy path",
+			stock:     5,
+			wantSaga:  SagaCompleted,
+			wantOrder: StatusPaid,
+			wantStock: 4,
+			wantPaid:  true,
+		},
+		{
+			name:              "payment declined",
+			stock:             5,
+			paymentLimit:      50,
+			wantSaga:          SagaCompensated,
+			wantOrder:         StatusCancelled,
+			wantStock:         5,
+			wantCompensations: []string{"void_payment", "release_reservation", "cancel_order"},
+		},
+		{
+			name:              "out of stock",
+			stock:             0,
+			wantSaga:          SagaCompensated,
+			wantOrder:         StatusCancelled,
+			wantStock:         0,
+			wantCompensations: []string{"release_reservation", "cancel_order"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture(tt.stock, tt.paymentLimit)
+			order := createTestOrder(t, f.orders, 100)
+
+			if _, err := f.saga.Place(order.ID, "u1"); err != nil {
+				t.Fatalf("Place() = %v", err)
+			}
+			saga := f.waitForSaga(t, order.ID)
+
+			if saga.Status != tt.wantSaga {
+				t.Errorf("saga %s, want %s (last error %q)", saga.Status, tt.wantSaga, saga.LastError)
+			}
+			if order, _ = f.orders.GetById(order.ID, "u1"); order.Status != tt.wantOrder {
+				t.Errorf("order %s, want %s", order.Status, tt.wantOrder)
+			}
+			if got := f.stock(); got != tt.wantStock {
+				t.Errorf("stock %d, want %d", got, tt.wantStock)
+			}
+			if paid := f.paid(order.ID); paid != tt.wantPaid {
+				t.Errorf("payment captured %t, want %t", paid, tt.wantPaid)
+			}
+			if got := fmt.Sprint(compensationActions(saga)); got != fmt.Sprint(tt.wantCompensations) {
+				t.Errorf("compensations %s, want %v", got, tt.wantCompensations)
+			}
+		})
+	}
+}
+
+func TestSagaOrchestratorPlaceTwice(t *testing.T) {
+	f := newSagaFixture(5, 0)
+	order := createTestOrder(t, f.orders, 100)
+
+	if _, err := f.saga.Place(order.ID, "u1"); err != nil {
+		t.Fatalf("Place() = %v", err)
+	}
+	f.waitForSaga(t, order.ID)
+	if _, err := f.saga.Place(order.ID, "u1"); err == nil {
+		t.Error("an order was placed twice")
+	}
+}
+
+// TestSagaOrchestratorResume restarts sagas that a previous process left
+// behind after reserving stock and confirming the order.
+func TestSagaOrchestratorResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		saga      Saga
+		wantSaga  SagaStatus
+		wantOrder Status
+		wantStock int
+	}{
+		{
+			name:      "running before the payment",
+			saga:      Saga{Step: StepCapturePayment, Status: SagaRunning},
+			wantSaga:  SagaCompleted,
+			wantOrder: StatusPaid,
+			wantStock: 4,
+		},
+		{
+			name:      "compensating after a failed payment",
+			saga:      Saga{Step: StepCapturePayment, Status: SagaCompensating, LastError: "capture_payment: declined"},
+			wantSaga:  SagaCompensated,
+			wantOrder: StatusCancelled,
+			wantStock: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSagaFixture(5, 0)
+			order := createTestOrder(t, f.orders, 100, StatusConfirmed)
+			reservationId, err := f.inventory.Reserve(context.Background(), order.ID, order.Items)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			saga := tt.saga
+			saga.ID = "saga-1"
+			saga.OrderID = order.ID
+			saga.UserID = order.UserID
+			saga.ReservationID = reservationId
+			if err := f.sagas.Save(saga); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.saga.Resume(context.Background()); err != nil {
+				t.Fatalf("Resume() = %v", err)
+			}
+			saga = f.waitForSaga(t, order.ID)
+
+			if saga.Status != tt.wantSaga {
+				t.Errorf("saga %s, want %s (last error %q)", saga.Status, tt.wantSaga, saga.LastError)
+			}
+			if order, _ = f.orders.GetById(order.ID, "u1"); order.Status != tt.wantOrder {
+				t.Errorf("order %s, want %s", order.Status, tt.wantOrder)
+			}
+			if got := f.stock(); got != tt.wantStock {
+				t.Errorf("stock %d, want %d", got, tt.wantStock)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+type OrderService struct {
+	orderRepository IOrderRepository
+}
+
+func NewOrderService(orderRepository IOrderRepository) *OrderService {
+	return &OrderService{orderRepository: orderRepository}
+}
+
+func (s *OrderService) Create(userId string, createOrder CreateOrder) (Order, error) {
+	if err := validateCreateOrder(createOrder); err != nil {
+		return Order{}, err
+	}
+
+	now := time.Now().UTC()
+	order := Order{
+		ID:        uuid.New().String(),
+		UserID:    userId,
+		Status:    StatusPending,
+		Currency:  strings.ToUpper(createOrder.Currency),
+		Items:     make([]OrderItem, 0, len(createOrder.Items)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	for _, item := range createOrder.Items {
+		order.Items = append(order.Items, OrderItem{
+			ID:        uuid.New().String(),
+			SKU:       item.SKU,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+		order.TotalAmount += int64(item.Quantity) * item.UnitPrice
+	}
+
+	change := StatusChange{
+		ID:        uuid.New().String(),
+		OrderID:   order.ID,
+		To:        StatusPending,
+		Actor:     userId,
+		Reason:    "order created",
+		CreatedAt: now,
+	}
+
+	if err := s.orderRepository.Save(order, change); err != nil {
+		return Order{}, err
+	}
+	return order, nil
+}
+
+// GetById only returns orders owned by the given user; other users' orders
+// are reported as not found so their existence is not leaked.
+func (s *OrderService) GetById(id, userId string) (Order, error) {
+	order, err := s.orderRepository.FindById(id)
+	if err != nil {
+		return Order{}, err
+	}
+	if order.UserID != userId {
+		return Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
+	}
+	return order, nil
+}
+
+func (s *OrderService) GetAllByUserId(userId string) ([]Order, error) {
+	return s.orderRepository.FindAllByUserId(userId)
+}
+
+func (s *OrderService) Cancel(id, userId, reason string) (Order, error) {
+	if _, err := s.GetById(id, userId); err != nil {
+		return Order{}, err
+	}
+	if reason == "" {
+		reason = "cancelled by customer"
+	}
+	return s.Transition(id, StatusCancelled, userId, reason)
+}
+
+// Transition moves an order to the given status on behalf of actor, which is
+// either a user id or the name of the component driving the change.
+func (s *OrderService) Transition(id string, to Status, actor, reason string) (Order, error) {
+	order, err := s.orderRepository.FindById(id)
+	if err != nil {
+		return Order{}, err
+	}
+
+	if err := order.Status.Transition(to); err != nil {
+		return Order{}, err
+	}
+
+	change := StatusChange{
+		ID:        uuid.New().String(),
+		OrderID:   order.ID,
+		From:      order.Status,
+		To:        to,
+		Actor:     actor,
+		Reason:    reason,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.orderRepository.UpdateStatus(change); err != nil {
+		return Order{}, err
+	}
+
+	order.Status = to
+	order.UpdatedAt = change.CreatedAt
+	return order, nil
+}
+
+func (s *OrderService) GetHistory(id, userId string) ([]StatusChange, error) {
+	if _, err := s.GetById(id, userId); err != nil {
+		return nil, err
+	}
+	return s.orderRepository.FindHistory(id)
+}
+
+func validateCreateOrder(createOrder CreateOrder) error {
+	if len(createOrder.Currency) != 3 {
+		return fmt.Errorf("%w: currency must be a 3-letter ISO 4217 code", ErrInvalidOrder)
+	}
+	if len(createOrder.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+	for _, item := range createOrder.Items {
+		if item.SKU == "" {
+			return fmt.Errorf("%w: item sku is required", ErrInvalidOrder)
+		}
+		if item.Quantity <= 0 {
+			return fmt.Errorf("%w: item quantity must be positive", ErrInvalidOrder)
+		}
+		if item.UnitPrice < 0 {
+			return fmt.Errorf("%w: item unit price must not be negative", ErrInvalidOrder)
+		}
+	}
+	return nil
+}
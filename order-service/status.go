@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusConfirmed Status = "confirmed"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+	StatusRefunded  Status = "refunded"
+)
+
+// transitions lists, for every status, the statuses an order may move to
+// next. Cancelled and refunded are terminal.
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusShipped, StatusRefunded},
+	StatusShipped:   {StatusDelivered},
+	StatusDelivered: {StatusRefunded},
+	StatusCancelled: {},
+	StatusRefunded:  {},
+}
+
+// TransitionError is returned when an order is asked to move to a status that
+// is not reachable from its current one.
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal status transition from %s to %s", e.From, e.To)
+}
+
+// StatusChange is a single entry of an order's status history. From is empty
+// for the entry recorded when the order is created.
+type StatusChange struct {
+	ID        string    `json:"id"`
+	OrderID   string    `json:"order_id"`
+	From      Status    `json:"from,omitempty"`
+	To        Status    `json:"to"`
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ParseStatus(s string) (Status, error) {
+	status := Status(s)
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("unknown order status: %q", s)
+	}
+	return status, nil
+}
+
+func (s Status) CanTransitionTo(to Status) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Status) Transition(to Status) error {
+	if !s.CanTransitionTo(to) {
+		return &TransitionError{From: s, To: to}
+	}
+	return nil
+}
+
+func (s Status) IsTerminal() bool {
+	return len(transitions[s]) == 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatusTransition(t *testing.T) {
+	tests := []struct {
+		from  Status
+		to    Status
+		legal bool
+	}{
+		{StatusPending, StatusConfirmed, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusConfirmed, StatusPaid, true},
+		{StatusConfirmed, StatusCancelled, true},
+		{StatusPaid, StatusShipped, true},
+		{StatusPaid, StatusRefunded, true},
+		{StatusShipped, StatusDelivered, true},
+		{StatusDelivered, StatusRefunded, true},
+
+		{StatusPending, StatusPaid, false},
+		{StatusPending, StatusPending, false},
+		{StatusConfirmed, StatusShipped, false},
+		{StatusPaid, StatusCancelled, false},
+		{StatusShipped, StatusCancelled, false},
+		{StatusDelivered, StatusPending, false},
+		{StatusCancelled, StatusShipped, false},
+		{StatusCancelled, StatusPending, false},
+		{StatusRefunded, StatusPaid, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			err := tt.from.Transition(tt.to)
+			if tt.legal {
+				if err != nil {
+					t.Errorf("Transition() = %v, want nil", err)
+				}
+				return
+			}
+
+			var transitionErr *TransitionError
+			if !errors.As(err, &transitionErr) || transitionErr.From != tt.from || transitionErr.To != tt.to {
+				t.Errorf("Transition() = %v, want a TransitionError from %s to %s", err, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestStatusIsTerminal(t *testing.T) {
+	for status := range transitions {
+		want := status == StatusCancelled || status == StatusRefunded
+		if got := status.IsTerminal(); got != want {
+			t.Errorf("%s.IsTerminal() = %t, want %t", status, got, want)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	if status, err := ParseStatus("shipped"); err != nil || status != StatusShipped {
+		t.Errorf("ParseStatus(shipped) = %q, %v", status, err)
+	}
+	if _, err := ParseStatus("lost"); err == nil {
+		t.Error("ParseStatus(lost) accepted an unknown status")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type IUserClient interface {
+	Exists(context.Context, string) error
+}
+
+type HTTPUserClient struct {
+	baseURL string
+	tokens  ITokenSource
+	client  *http.Client
+}
+
+func NewHTTPUserClient(baseURL string, tokens ITokenSource) *HTTPUserClient {
+	return &HTTPUserClient{
+		baseURL: baseURL,
+		tokens:  tokens,
+		client:  &http.Client{},
+	}
+}
+
+func (c *HTTPUserClient) Exists(ctx context.Context, userId string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/internal/users/"+userId, nil)
+	if err != nil {
+		return err
+	}
+
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to obtain service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach user service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrUserNotFound, userId)
+	default:
+		return fmt.Errorf("user service responded with %d", resp.StatusCode)
+	}
+}
+
+// FakeUserClient treats every user id as existing.
+type FakeUserClient struct {
+}
+
+func NewFakeUserClient() *FakeUserClient {
+	return &FakeUserClient{}
+}
+
+func (c *FakeUserClient) Exists(ctx context.Context, userId string) error {
+	return nil
+}
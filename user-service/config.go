@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/spf13/viper"
 	"os"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +13,26 @@ type Config struct {
 type ApplicationConfig struct {
 	Server   ServerConfig   `yaml:"server"`
 	Database DatabaseConfig `yaml:"database"`
+	Redis    RedisConfig    `yaml:"redis"`
+	Outbox   OutboxConfig   `yaml:"outbox"`
+	Broker   BrokerConfig   `yaml:"broker"`
+	Admin    AdminConfig    `yaml:"admin"`
+	Auth     AuthConfig     `yaml:"auth"`
+}
+
+// AuthConfig points user-service at the JWKS auth-service publishes, which
+// access tokens and the service tokens on the internal endpoints are
+// verified against.
+type AuthConfig struct {
+	JWKSURL         string        `yaml:"jwksUrl"`
+	Issuer          string        `yaml:"issuer"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// AdminConfig lists users that are granted the admin role at startup, which
+// is how the first admin gets in.
+type AdminConfig struct {
+	Emails []string `yaml:"emails"`
 }
 
 type ServerConfig struct {
@@ -26,6 +47,26 @@ type DatabaseConfig struct {
 	Name     string `yaml:"name"`
 }
 
+// RedisConfig is optional; it is only required by the redis broker.
+type RedisConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"pollInterval"`
+	BatchSize    int           `yaml:"batchSize"`
+	MaxAttempts  int           `yaml:"maxAttempts"`
+	RetryBackoff time.Duration `yaml:"retryBackoff"`
+}
+
+// BrokerConfig selects where outbox events are published: "redis" for a Redis
+// stream, anything else for the in-process broker.
+type BrokerConfig struct {
+	Type   string `yaml:"type"`
+	Stream string `yaml:"stream"`
+	MaxLen int64  `yaml:"maxLen"`
+}
+
 func NewConfiguration() *Config {
 	applicationConfig := &ApplicationConfig{}
 	applicationConfig.readApplicationConfig()
@@ -1,18 +1,23 @@
 package main
 
 import (
+	"authz"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	"net/http"
 )
 
 type UserController struct {
-	userService IUserService
+	userService   IUserService
+	serviceTokens *authz.TokenVerifier
 }
 
-func NewUserController(userService IUserService) *UserController {
+func NewUserController(userService IUserService, serviceTokens *authz.TokenVerifier) *UserController {
 	return &UserController{
-		userService: userService,
+		userService:   userService,
+		serviceTokens: serviceTokens,
 	}
 }
 
@@ -72,6 +77,116 @@ func (u *UserController) getByEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(UserCredentials{User: user, Password: user.Password}); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserController) update(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var update UpdateUser
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	user, err := u.userService.Update(id, update)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error updating user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserController) updatePassword(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var update UpdatePassword
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil || update.Password == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := u.userService.UpdatePassword(id, update); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error updating password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserController) markEmailVerified(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := u.userService.MarkEmailVerified(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserController) getRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := u.userService.GetRoles()
+	if err != nil {
+		http.Error(w, "Error fetching roles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(roles); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (u *UserController) assignRoles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var assign AssignRoles
+	if err := json.NewDecoder(r.Body).Decode(&assign); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	user, err := u.userService.AssignRoles(id, assign)
+	if err != nil {
+		if errors.Is(err, ErrUnknownRole) {
+			http.Error(w, "Unknown role", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error assigning roles", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(user); err != nil {
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
@@ -79,9 +194,36 @@ func (u *UserController) getByEmail(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (u *UserController) delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := u.userService.Delete(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error deleting user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (u *UserController) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/users", u.create).Methods("POST")
-	r.HandleFunc("/users", u.getAll).Methods("GET")
-	r.HandleFunc("/users/{id}", u.getById).Methods("GET")
-	r.HandleFunc("/users/email/{email}", u.getByEmail).Methods("GET")
+	read := authz.RequireScopes(u.serviceTokens, UsersReadScope)
+	write := authz.RequireScopes(u.serviceTokens, UsersWriteScope)
+	credentials := authz.RequireScopes(u.serviceTokens, UsersCredentialsScope)
+
+	r.Handle("/users", credentials(http.HandlerFunc(u.create))).Methods("POST")
+	r.Handle("/users", authz.RequirePermissions("users:read")(http.HandlerFunc(u.getAll))).Methods("GET")
+	r.Handle("/users/{id}", authz.RequireSelfOrPermissions("users:read")(http.HandlerFunc(u.getById))).Methods("GET")
+	r.Handle("/users/{id}", authz.RequirePermissions("users:write")(http.HandlerFunc(u.update))).Methods("PUT")
+	r.Handle("/users/{id}", authz.RequirePermissions("users:write")(http.HandlerFunc(u.delete))).Methods("DELETE")
+	r.Handle("/users/{id}/password", credentials(http.HandlerFunc(u.updatePassword))).Methods("PUT")
+	r.Handle("/users/{id}/email-verified", write(http.HandlerFunc(u.markEmailVerified))).Methods("PUT")
+	r.Handle("/users/email/{email}", credentials(http.HandlerFunc(u.getByEmail))).Methods("GET")
+	r.Handle("/internal/users/{id}", read(http.HandlerFunc(u.getById))).Methods("GET")
+	r.Handle("/admin/roles", authz.RequirePermissions("roles:read")(http.HandlerFunc(u.getRoles))).Methods("GET")
+	r.Handle("/admin/users/{id}/roles", authz.RequirePermissions("roles:assign")(http.HandlerFunc(u.assignRoles))).Methods("PUT")
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// HealthController reports whether the service can reach its database. The
+// gateway uses it for its active health checks.
+type HealthController struct {
+	db *sql.DB
+}
+
+func NewHealthController(db *sql.DB) *HealthController {
+	return &HealthController{db: db}
+}
+
+func (c *HealthController) health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status, code := "up", http.StatusOK
+	if err := c.db.PingContext(ctx); err != nil {
+		status, code = "down", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+func (c *HealthController) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/health", c.health).Methods("GET")
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"authz"
+	"context"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
@@ -14,15 +16,55 @@ func main() {
 		log.Fatalf("Error initializing database: %v", err)
 	}
 
+	outboxRelay := NewOutboxRelay(db, newBroker(cfg), cfg.Outbox)
+	outboxRelay.Start(context.Background())
+
 	router := mux.NewRouter()
 
 	userRepository := NewPostgresRepository(db)
 	userService := NewUserService(userRepository)
-	userController := NewUserController(userService)
+	for _, email := range cfg.Admin.Emails {
+		if err := userService.GrantRoleByEmail(email, "admin"); err != nil {
+			log.Printf("Could not grant admin role to %s: %v", email, err)
+		}
+	}
+	tokens := newTokenVerifier(cfg)
+	router.Use(authz.Authenticate(tokens))
+
+	userController := NewUserController(userService, tokens)
 	userController.RegisterRoutes(router)
 
+	mfaRepository := NewPostgresMFARepository(db)
+	mfaService := NewMFAService(mfaRepository)
+	mfaController := NewMFAController(mfaService, tokens)
+	mfaController.RegisterRoutes(router)
+
+	healthController := NewHealthController(db)
+	healthController.RegisterRoutes(router)
+
 	log.Printf("Server is running on port %s", cfg.Server.Port)
 	if err := http.ListenAndServe(":"+cfg.Server.Port, router); err != nil {
 		log.Fatalf("Could not start server: %v\n", err)
 	}
 }
+
+func newBroker(cfg *Config) IBroker {
+	if cfg.Broker.Type != "redis" {
+		log.Println("Publishing outbox events to the in-process broker")
+		return NewInProcessBroker()
+	}
+	return NewRedisStreamBroker(InitializeRedis(cfg.Redis), cfg.Broker.Stream, cfg.Broker.MaxLen)
+}
+
+// newTokenVerifier checks access tokens against the revocation list in Redis
+// when one is configured.
+func newTokenVerifier(cfg *Config) *authz.TokenVerifier {
+	var revocations authz.IRevocationList
+	if cfg.Redis.Addr != "" {
+		revocations = authz.NewRedisRevocationList(InitializeRedis(cfg.Redis))
+	} else {
+		log.Println("No Redis configured, revoked access tokens are accepted until they expire")
+	}
+	keySet := authz.NewJWKSKeySet(cfg.Auth.JWKSURL, cfg.Auth.RefreshInterval)
+	return authz.NewTokenVerifier(keySet, cfg.Auth.Issuer, revocations)
+}
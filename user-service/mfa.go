@@ -0,0 +1,62 @@
+package main
+
+import "errors"
+
+var ErrTOTPAlreadyEnabled = errors.New("totp already enabled")
+
+// MFA holds a user's second factor. The TOTP secret is only served on the
+// internal routes that auth-service calls, never on /users.
+type MFA struct {
+	UserID      string `json:"user_id"`
+	TOTPSecret  string `json:"totp_secret"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+}
+
+type SetTOTPSecret struct {
+	TOTPSecret string `json:"totp_secret"`
+}
+
+// RecoveryCodes carries hashes only, auth-service never sends the codes.
+type RecoveryCodes struct {
+	CodeHashes []string `json:"code_hashes"`
+}
+
+type ConsumeRecoveryCode struct {
+	CodeHash string `json:"code_hash"`
+}
+
+type IMFAService interface {
+	Get(string) (MFA, error)
+	SetTOTPSecret(string, SetTOTPSecret) error
+	EnableTOTP(string) error
+	ReplaceRecoveryCodes(string, RecoveryCodes) error
+	ConsumeRecoveryCode(string, ConsumeRecoveryCode) error
+}
+
+type MFAService struct {
+	mfaRepository IMFARepository
+}
+
+func NewMFAService(mfaRepository IMFARepository) *MFAService {
+	return &MFAService{mfaRepository: mfaRepository}
+}
+
+func (ms *MFAService) Get(userId string) (MFA, error) {
+	return ms.mfaRepository.FindByUserId(userId)
+}
+
+func (ms *MFAService) SetTOTPSecret(userId string, secret SetTOTPSecret) error {
+	return ms.mfaRepository.SaveTOTPSecret(userId, secret.TOTPSecret)
+}
+
+func (ms *MFAService) EnableTOTP(userId string) error {
+	return ms.mfaRepository.EnableTOTP(userId)
+}
+
+func (ms *MFAService) ReplaceRecoveryCodes(userId string, codes RecoveryCodes) error {
+	return ms.mfaRepository.ReplaceRecoveryCodes(userId, codes.CodeHashes)
+}
+
+func (ms *MFAService) ConsumeRecoveryCode(userId string, code ConsumeRecoveryCode) error {
+	return ms.mfaRepository.ConsumeRecoveryCode(userId, code.CodeHash)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"authz"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// MFAController serves the second factor data to auth-service. Its routes
+// live under /internal, which the gateway does not expose, and require a
+// service token with the users.credentials scope.
+type MFAController struct {
+	mfaService    IMFAService
+	serviceTokens *authz.TokenVerifier
+}
+
+func NewMFAController(mfaService IMFAService, serviceTokens *authz.TokenVerifier) *MFAController {
+	return &MFAController{
+		mfaService:    mfaService,
+		serviceTokens: serviceTokens,
+	}
+}
+
+func (m *MFAController) get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	mfa, err := m.mfaService.Get(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "MFA not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error fetching MFA", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(mfa); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (m *MFAController) setTOTPSecret(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var secret SetTOTPSecret
+	if err := json.NewDecoder(r.Body).Decode(&secret); err != nil || secret.TOTPSecret == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := m.mfaService.SetTOTPSecret(id, secret); err != nil {
+		if errors.Is(err, ErrTOTPAlreadyEnabled) {
+			http.Error(w, "TOTP already enabled", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error saving TOTP secret", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *MFAController) enableTOTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := m.mfaService.EnableTOTP(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "MFA not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error enabling TOTP", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *MFAController) replaceRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var codes RecoveryCodes
+	if err := json.NewDecoder(r.Body).Decode(&codes); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := m.mfaService.ReplaceRecoveryCodes(id, codes); err != nil {
+		http.Error(w, "Error saving recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *MFAController) consumeRecoveryCode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var code ConsumeRecoveryCode
+	if err := json.NewDecoder(r.Body).Decode(&code); err != nil || code.CodeHash == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := m.mfaService.ConsumeRecoveryCode(id, code); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Recovery code not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error consuming recovery code", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *MFAController) RegisterRoutes(r *mux.Router) {
+	credentials := authz.RequireScopes(m.serviceTokens, UsersCredentialsScope)
+
+	r.Handle("/internal/users/{id}/mfa", credentials(http.HandlerFunc(m.get))).Methods("GET")
+	r.Handle("/internal/users/{id}/mfa/totp", credentials(http.HandlerFunc(m.setTOTPSecret))).Methods("PUT")
+	r.Handle("/internal/users/{id}/mfa/totp/enabled", credentials(http.HandlerFunc(m.enableTOTP))).Methods("PUT")
+	r.Handle("/internal/users/{id}/mfa/recovery-codes", credentials(http.HandlerFunc(m.replaceRecoveryCodes))).Methods("PUT")
+	r.Handle("/internal/users/{id}/mfa/recovery-codes/consume", credentials(http.HandlerFunc(m.consumeRecoveryCode))).Methods("POST")
+}
@@ -0,0 +1,13 @@
+CREATE TABLE user_mfa (
+                          user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+                          totp_secret VARCHAR(64) NOT NULL,
+                          totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+                          updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE user_recovery_codes (
+                                     user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                                     code_hash VARCHAR(64) NOT NULL,
+                                     used_at TIMESTAMPTZ,
+                                     PRIMARY KEY (user_id, code_hash)
+);
\ No newline at end of file
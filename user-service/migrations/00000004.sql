@@ -0,0 +1,54 @@
+CREATE TABLE roles (
+                       name VARCHAR(64) PRIMARY KEY,
+                       description VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE permissions (
+                             name VARCHAR(64) PRIMARY KEY,
+                             description VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE role_permissions (
+                                  role VARCHAR(64) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+                                  permission VARCHAR(64) NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+                                  PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE user_roles (
+                            user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+                            role VARCHAR(64) NOT NULL REFERENCES roles (name),
+                            PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('customer', 'Places and manages their own orders'),
+    ('support', 'Looks up users and helps with account access'),
+    ('admin', 'Manages users, roles and security settings');
+
+INSERT INTO permissions (name, description) VALUES
+    ('orders:read', 'Read own orders'),
+    ('orders:write', 'Create, place and cancel own orders'),
+    ('users:read', 'Read any user'),
+    ('users:write', 'Update and delete any user'),
+    ('roles:read', 'List roles and their permissions'),
+    ('roles:assign', 'Assign roles to users'),
+    ('sessions:revoke', 'Revoke access tokens and sessions of any user'),
+    ('logins:unlock', 'Lift login lockouts');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('customer', 'orders:read'),
+    ('customer', 'orders:write'),
+    ('support', 'users:read'),
+    ('support', 'roles:read'),
+    ('support', 'sessions:revoke'),
+    ('support', 'logins:unlock'),
+    ('admin', 'orders:read'),
+    ('admin', 'orders:write'),
+    ('admin', 'users:read'),
+    ('admin', 'users:write'),
+    ('admin', 'roles:read'),
+    ('admin', 'roles:assign'),
+    ('admin', 'sessions:revoke'),
+    ('admin', 'logins:unlock');
+
+INSERT INTO user_roles (user_id, role) SELECT id, 'customer' FROM users;
\ No newline at end of file
@@ -0,0 +1,9 @@
+INSERT INTO roles (name, description) VALUES
+    ('tester', 'Tries out canary releases');
+
+INSERT INTO permissions (name, description) VALUES
+    ('canary:opt-in', 'Choose between the canary and stable targets of a route');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('tester', 'canary:opt-in'),
+    ('admin', 'canary:opt-in');
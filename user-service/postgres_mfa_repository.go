@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type PostgresMFARepository struct {
+	db *sql.DB
+}
+
+func NewPostgresMFARepository(db *sql.DB) *PostgresMFARepository {
+	return &PostgresMFARepository{db: db}
+}
+
+func (r *PostgresMFARepository) FindByUserId(userId string) (MFA, error) {
+	query := `SELECT user_id, totp_secret, totp_enabled FROM user_mfa WHERE user_id = $1`
+	row := r.db.QueryRow(query, userId)
+
+	var mfa MFA
+	if err := row.Scan(&mfa.UserID, &mfa.TOTPSecret, &mfa.TOTPEnabled); err != nil {
+		if err == sql.ErrNoRows {
+			return MFA{}, fmt.Errorf("mfa not found: %w", err)
+		}
+		return MFA{}, fmt.Errorf("failed to find mfa: %w", err)
+	}
+
+	return mfa, nil
+}
+
+// SaveTOTPSecret starts or restarts an enrollment. Once TOTP is enabled the
+// secret can no longer be replaced this way.
+func (r *PostgresMFARepository) SaveTOTPSecret(userId string, secret string) error {
+	query := `INSERT INTO user_mfa (user_id, totp_secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET totp_secret = EXCLUDED.totp_secret, updated_at = now()
+		WHERE user_mfa.totp_enabled = FALSE`
+	result, err := r.db.Exec(query, userId, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save totp secret: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+func (r *PostgresMFARepository) EnableTOTP(userId string) error {
+	result, err := r.db.Exec(`UPDATE user_mfa SET totp_enabled = TRUE, updated_at = now() WHERE user_id = $1`, userId)
+	if err != nil {
+		return fmt.Errorf("failed to enable totp: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("mfa not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (r *PostgresMFARepository) ReplaceRecoveryCodes(userId string, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, codeHash := range codeHashes {
+		_, err := tx.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userId, codeHash)
+		if err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit recovery codes: %w", err)
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode marks an unused code as used. The conditional update
+// makes sure a code works only once even under concurrent logins.
+func (r *PostgresMFARepository) ConsumeRecoveryCode(userId string, codeHash string) error {
+	query := `UPDATE user_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := r.db.Exec(query, userId, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("recovery code not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
@@ -4,9 +4,16 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// userRolesColumns selects the roles of a users row and the permissions
+// those roles grant, as two arrays.
+const userRolesColumns = `ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = users.id ORDER BY ur.role),
+	ARRAY(SELECT DISTINCT rp.permission FROM user_roles ur JOIN role_permissions rp ON rp.role = ur.role
+		WHERE ur.user_id = users.id ORDER BY rp.permission)`
+
 type PostgresRepository struct {
 	db *sql.DB
 }
@@ -17,17 +24,44 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 
 func (r *PostgresRepository) Save(user CreateUser) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
 	id := uuid.New().String()
+
+	event, err := NewOutboxEvent(UserAggregate, id, UserCreatedEvent, UserEvent{ID: id, Name: user.Name, Email: user.Email})
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO users (id, name, email, password) VALUES ($1, $2, $3, $4)`
-	_, err = r.db.Exec(query, id, user.Name, user.Email, hashedPassword)
+	_, err = tx.Exec(query, id, user.Name, user.Email, hashedPassword)
 	if err != nil {
 		return fmt.Errorf("failed to save user: %w", err)
 	}
+
+	if _, err := tx.Exec(`INSERT INTO user_roles (user_id, role) VALUES ($1, $2)`, id, DefaultRole); err != nil {
+		return fmt.Errorf("failed to assign default role: %w", err)
+	}
+
+	if err := saveOutboxEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user: %w", err)
+	}
 	return nil
 }
 
 func (r *PostgresRepository) FindAll() ([]User, error) {
-	query := `SELECT id, name, email, password FROM users`
+	query := `SELECT id, name, email, password, email_verified, ` + userRolesColumns + ` FROM users`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find all users: %w", err)
@@ -37,7 +71,8 @@ func (r *PostgresRepository) FindAll() ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var user User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Password); err != nil {
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.EmailVerified,
+			pq.Array(&user.Roles), pq.Array(&user.Permissions)); err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
 		users = append(users, user)
@@ -50,11 +85,12 @@ func (r *PostgresRepository) FindAll() ([]User, error) {
 }
 
 func (r *PostgresRepository) FindById(id string) (User, error) {
-	query := `SELECT id, name, email, password FROM users WHERE id = $1`
+	query := `SELECT id, name, email, password, email_verified, ` + userRolesColumns + ` FROM users WHERE id = $1`
 	row := r.db.QueryRow(query, id)
 
 	var user User
-	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password); err != nil {
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.EmailVerified,
+		pq.Array(&user.Roles), pq.Array(&user.Permissions)); err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, fmt.Errorf("user not found: %w", err)
 		}
@@ -65,11 +101,12 @@ func (r *PostgresRepository) FindById(id string) (User, error) {
 }
 
 func (r *PostgresRepository) FindByEmail(email string) (User, error) {
-	query := `SELECT id, name, email, password FROM users WHERE email = $1`
+	query := `SELECT id, name, email, password, email_verified, ` + userRolesColumns + ` FROM users WHERE email = $1`
 	row := r.db.QueryRow(query, email)
 
 	var user User
-	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password); err != nil {
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.EmailVerified,
+		pq.Array(&user.Roles), pq.Array(&user.Permissions)); err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, fmt.Errorf("user not found: %w", err)
 		}
@@ -78,3 +115,177 @@ func (r *PostgresRepository) FindByEmail(email string) (User, error) {
 
 	return user, nil
 }
+
+func (r *PostgresRepository) Update(id string, update UpdateUser) (User, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return User{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A changed email address has to be verified again.
+	query := `UPDATE users SET name = $2, email = $3, email_verified = (email_verified AND email = $3)
+		WHERE id = $1 RETURNING id, name, email, password, email_verified, ` + userRolesColumns
+	row := tx.QueryRow(query, id, update.Name, update.Email)
+
+	var user User
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.EmailVerified,
+		pq.Array(&user.Roles), pq.Array(&user.Permissions)); err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, fmt.Errorf("user not found: %w", err)
+		}
+		return User{}, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	event, err := NewOutboxEvent(UserAggregate, id, UserUpdatedEvent, UserEvent{ID: id, Name: user.Name, Email: user.Email})
+	if err != nil {
+		return User{}, err
+	}
+	if err := saveOutboxEvent(tx, event); err != nil {
+		return User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, fmt.Errorf("failed to commit user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *PostgresRepository) UpdatePassword(id string, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	result, err := r.db.Exec(`UPDATE users SET password = $2 WHERE id = $1`, id, hashedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) MarkEmailVerified(id string) error {
+	result, err := r.db.Exec(`UPDATE users SET email_verified = TRUE WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) FindAllRoles() ([]Role, error) {
+	query := `SELECT r.name, r.description,
+		ARRAY(SELECT rp.permission FROM role_permissions rp WHERE rp.role = r.name ORDER BY rp.permission)
+		FROM roles r ORDER BY r.name`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.Name, &role.Description, pq.Array(&role.Permissions)); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return roles, nil
+}
+
+// ReplaceRoles sets the roles of a user and records a user.roles_changed
+// event in the same transaction.
+func (r *PostgresRepository) ReplaceRoles(id string, roles []string) (User, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return User{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var known int
+	if err := tx.QueryRow(`SELECT count(*) FROM roles WHERE name = ANY($1)`, pq.Array(roles)).Scan(&known); err != nil {
+		return User{}, fmt.Errorf("failed to check roles: %w", err)
+	}
+	if known != len(roles) {
+		return User{}, ErrUnknownRole
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_roles WHERE user_id = $1`, id); err != nil {
+		return User{}, fmt.Errorf("failed to delete roles: %w", err)
+	}
+	query := `INSERT INTO user_roles (user_id, role) SELECT id, unnest($2::varchar[]) FROM users WHERE id = $1`
+	if _, err := tx.Exec(query, id, pq.Array(roles)); err != nil {
+		return User{}, fmt.Errorf("failed to assign roles: %w", err)
+	}
+
+	query = `SELECT id, name, email, password, email_verified, ` + userRolesColumns + ` FROM users WHERE id = $1`
+	var user User
+	if err := tx.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.EmailVerified,
+		pq.Array(&user.Roles), pq.Array(&user.Permissions)); err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, fmt.Errorf("user not found: %w", err)
+		}
+		return User{}, fmt.Errorf("failed to find user by id: %w", err)
+	}
+
+	event, err := NewOutboxEvent(UserAggregate, id, UserRolesChangedEvent, UserEvent{ID: id, Roles: user.Roles})
+	if err != nil {
+		return User{}, err
+	}
+	if err := saveOutboxEvent(tx, event); err != nil {
+		return User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, fmt.Errorf("failed to commit roles: %w", err)
+	}
+	return user, nil
+}
+
+// GrantRoleByEmail adds a role to a user if they do not have it yet.
+func (r *PostgresRepository) GrantRoleByEmail(email string, role string) error {
+	query := `INSERT INTO user_roles (user_id, role) SELECT id, $2 FROM users WHERE email = $1 ON CONFLICT DO NOTHING`
+	if _, err := r.db.Exec(query, email, role); err != nil {
+		return fmt.Errorf("failed to grant role: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresRepository) Delete(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+
+	event, err := NewOutboxEvent(UserAggregate, id, UserDeletedEvent, UserEvent{ID: id})
+	if err != nil {
+		return err
+	}
+	if err := saveOutboxEvent(tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user deletion: %w", err)
+	}
+	return nil
+}
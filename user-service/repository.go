@@ -5,4 +5,19 @@ type IUserRepository interface {
 	FindAll() ([]User, error)
 	FindById(string) (User, error)
 	FindByEmail(string) (User, error)
+	Update(string, UpdateUser) (User, error)
+	UpdatePassword(string, string) error
+	MarkEmailVerified(string) error
+	Delete(string) error
+	FindAllRoles() ([]Role, error)
+	ReplaceRoles(string, []string) (User, error)
+	GrantRoleByEmail(string, string) error
+}
+
+type IMFARepository interface {
+	FindByUserId(string) (MFA, error)
+	SaveTOTPSecret(string, string) error
+	EnableTOTP(string) error
+	ReplaceRecoveryCodes(string, []string) error
+	ConsumeRecoveryCode(string, string) error
 }
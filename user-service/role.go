@@ -0,0 +1,18 @@
+package main
+
+import "errors"
+
+// DefaultRole is given to every new user.
+const DefaultRole = "customer"
+
+var ErrUnknownRole = errors.New("unknown role")
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoles struct {
+	Roles []string `json:"roles"`
+}
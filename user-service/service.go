@@ -23,3 +23,39 @@ func (us *UserService) GetById(id string) (User, error) {
 func (us *UserService) GetByEmail(email string) (User, error) {
 	return us.userRepository.FindByEmail(email)
 }
+
+func (us *UserService) Update(id string, user UpdateUser) (User, error) {
+	return us.userRepository.Update(id, user)
+}
+
+func (us *UserService) UpdatePassword(id string, update UpdatePassword) error {
+	return us.userRepository.UpdatePassword(id, update.Password)
+}
+
+func (us *UserService) MarkEmailVerified(id string) error {
+	return us.userRepository.MarkEmailVerified(id)
+}
+
+func (us *UserService) GetRoles() ([]Role, error) {
+	return us.userRepository.FindAllRoles()
+}
+
+func (us *UserService) AssignRoles(id string, assign AssignRoles) (User, error) {
+	seen := make(map[string]bool)
+	roles := []string{}
+	for _, role := range assign.Roles {
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	return us.userRepository.ReplaceRoles(id, roles)
+}
+
+func (us *UserService) GrantRoleByEmail(email string, role string) error {
+	return us.userRepository.GrantRoleByEmail(email, role)
+}
+
+func (us *UserService) Delete(id string) error {
+	return us.userRepository.Delete(id)
+}
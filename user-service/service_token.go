@@ -0,0 +1,9 @@
+package main
+
+// Scopes a service token needs for the internal endpoints. users.credentials
+// covers password hashes and second factor data.
+const (
+	UsersReadScope        = "users.read"
+	UsersWriteScope       = "users.write"
+	UsersCredentialsScope = "users.credentials"
+)
@@ -1,10 +1,13 @@
 package main
 
 type User struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Email         string   `json:"email"`
+	Password      string   `json:"-"`
+	EmailVerified bool     `json:"email_verified"`
+	Roles         []string `json:"roles"`
+	Permissions   []string `json:"permissions"`
 }
 
 type IUserService interface {
@@ -12,6 +15,20 @@ type IUserService interface {
 	GetAll() ([]User, error)
 	GetById(string) (User, error)
 	GetByEmail(string) (User, error)
+	Update(string, UpdateUser) (User, error)
+	UpdatePassword(string, UpdatePassword) error
+	MarkEmailVerified(string) error
+	Delete(string) error
+	GetRoles() ([]Role, error)
+	AssignRoles(string, AssignRoles) (User, error)
+	GrantRoleByEmail(string, string) error
+}
+
+// UserCredentials is a user together with the password hash, returned only
+// to auth-service when it checks a login.
+type UserCredentials struct {
+	User
+	Password string `json:"password"`
 }
 
 type CreateUser struct {
@@ -19,3 +36,21 @@ type CreateUser struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+type UpdateUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type UpdatePassword struct {
+	Password string `json:"password"`
+}
+
+// UserEvent is the payload of user outbox events. It deliberately leaves out
+// the password hash.
+type UserEvent struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name,omitempty"`
+	Email string   `json:"email,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}